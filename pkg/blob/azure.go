@@ -19,16 +19,23 @@ package blob
 import (
 	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"golang.org/x/net/context"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	kv "github.com/Azure/azure-sdk-for-go/services/keyvault/2016-10-01/keyvault"
 	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
 	"github.com/Azure/azure-sdk-for-go/storage"
 
 	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/adal"
 
 	clientset "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -44,6 +51,14 @@ var (
 	DefaultAzureCredentialFileEnv = "AZURE_CREDENTIAL_FILE"
 	DefaultCredFilePath           = "/etc/kubernetes/azure.json"
 	storageService                = "Microsoft.Storage"
+	// x-ms-version of data lake storage REST API
+	dataLakeAPIVersion = "2021-06-08"
+	// http client of data lake storage REST API, requests time out so that CreateVolume does not hang on an unresponsive endpoint
+	dataLakeHTTPClient = &http.Client{Timeout: 30 * time.Second}
+	// api-version of Azure Monitor metrics REST API
+	monitorMetricsAPIVersion = "2018-01-01"
+	// resource of Azure AD token to access storage data plane, used if cloud environment does not specify it
+	defaultStorageTokenResource = "https://storage.azure.com/"
 )
 
 // IsAzureStackCloud decides whether the driver is running on Azure Stack Cloud.
@@ -167,9 +182,12 @@ func getCloudProvider(kubeconfig, nodeID, secretName, secretNamespace, userAgent
 	return az, nil
 }
 
-// getKeyVaultSecretContent get content of the keyvault secret
+// errKeyVaultSecretNotUsable is returned when the keyvault secret is disabled or expired
+var errKeyVaultSecretNotUsable = errors.New("keyvault secret is not usable")
+
+// getKeyVaultSecretContent get content of the keyvault secret, the latest version is used if secretVersion is empty
 func (d *Driver) getKeyVaultSecretContent(ctx context.Context, vaultURL string, secretName string, secretVersion string) (content string, err error) {
-	kvClient, err := d.initializeKvClient()
+	kvClient, err := d.getKeyVaultClient()
 	if err != nil {
 		return "", fmt.Errorf("failed to get keyvaultClient: %w", err)
 	}
@@ -179,7 +197,28 @@ func (d *Driver) getKeyVaultSecretContent(ctx context.Context, vaultURL string,
 	if err != nil {
 		return "", fmt.Errorf("get secret from vaultURL(%v), sercretName(%v), secretVersion(%v) failed with error: %w", vaultURL, secretName, secretVersion, err)
 	}
-	return *secret.Value, nil
+	if attributes := secret.Attributes; attributes != nil {
+		if !pointer.BoolDeref(attributes.Enabled, true) {
+			return "", fmt.Errorf("secret(%s) in key vault(%s) is disabled: %w", secretName, vaultURL, errKeyVaultSecretNotUsable)
+		}
+		if attributes.Expires != nil && time.Time(*attributes.Expires).Before(time.Now()) {
+			return "", fmt.Errorf("secret(%s) in key vault(%s) expired at %v: %w", secretName, vaultURL, time.Time(*attributes.Expires), errKeyVaultSecretNotUsable)
+		}
+	}
+	return strings.TrimSpace(pointer.StringDeref(secret.Value, "")), nil
+}
+
+// keyVaultSecretGetter gets secret from Azure Key Vault, it's implemented by keyvault BaseClient
+type keyVaultSecretGetter interface {
+	GetSecret(ctx context.Context, vaultBaseURL string, secretName string, secretVersion string) (kv.SecretBundle, error)
+}
+
+// getKeyVaultClient returns the keyvault client set for testing or a new client with service principal token
+func (d *Driver) getKeyVaultClient() (keyVaultSecretGetter, error) {
+	if d.keyVaultClient != nil {
+		return d.keyVaultClient, nil
+	}
+	return d.initializeKvClient()
 }
 
 func (d *Driver) initializeKvClient() (*kv.BaseClient, error) {
@@ -205,6 +244,144 @@ func (d *Driver) getKeyvaultToken() (authorizer autorest.Authorizer, err error)
 	return authorizer, nil
 }
 
+// getManagementToken returns an authorizer with the cached service principal token to access azure resource manager
+func (d *Driver) getManagementToken() (authorizer autorest.Authorizer, err error) {
+	servicePrincipalToken, err := d.getServicePrincipalToken(d.cloud.Environment.ServiceManagementEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	authorizer = autorest.NewBearerAuthorizer(servicePrincipalToken)
+	return authorizer, nil
+}
+
+// getStorageTokenCredential returns a credential with the cached service principal token to access storage data plane
+func (d *Driver) getStorageTokenCredential() (azcore.TokenCredential, error) {
+	resource := d.cloud.Environment.ResourceIdentifiers.Storage
+	if resource == "" {
+		resource = defaultStorageTokenResource
+	}
+	servicePrincipalToken, err := d.getServicePrincipalToken(resource)
+	if err != nil {
+		return nil, err
+	}
+	return &servicePrincipalTokenCredential{token: servicePrincipalToken}, nil
+}
+
+// getServicePrincipalToken returns the service principal token of driver identity for resource, the token is created
+// once and cached, it's safe for concurrent use and refreshed by its users when it's expired
+func (d *Driver) getServicePrincipalToken(resource string) (*adal.ServicePrincipalToken, error) {
+	if token, ok := d.servicePrincipalTokens.Load(resource); ok {
+		return token.(*adal.ServicePrincipalToken), nil
+	}
+	env := d.cloud.Environment
+	servicePrincipalToken, err := providerconfig.GetServicePrincipalToken(&d.cloud.Config.AzureAuthConfig, &env, resource)
+	if err != nil {
+		return nil, err
+	}
+	// keep the token stored by a concurrent request so that only one token is refreshed
+	token, _ := d.servicePrincipalTokens.LoadOrStore(resource, servicePrincipalToken)
+	return token.(*adal.ServicePrincipalToken), nil
+}
+
+// getWorkloadIdentityCredential returns a token credential of the workload identity, the projected service account
+// token of driver is exchanged for an Azure AD token of clientID, tenant of driver is used if tenantID is empty,
+// token file is aadFederatedTokenFile in cloud config, or AZURE_FEDERATED_TOKEN_FILE injected by workload identity webhook
+func (d *Driver) getWorkloadIdentityCredential(clientID, tenantID string) (azcore.TokenCredential, error) {
+	if tenantID == "" {
+		tenantID = d.cloud.TenantID
+	}
+	options := &azidentity.WorkloadIdentityCredentialOptions{
+		ClientID:      clientID,
+		TenantID:      tenantID,
+		TokenFilePath: d.cloud.AADFederatedTokenFile,
+	}
+	if d.cloud.Environment.ActiveDirectoryEndpoint != "" {
+		options.ClientOptions.Cloud = cloud.Configuration{ActiveDirectoryAuthorityHost: d.cloud.Environment.ActiveDirectoryEndpoint}
+	}
+	return azidentity.NewWorkloadIdentityCredential(options)
+}
+
+// servicePrincipalTokenCredential adapts service principal token to azcore.TokenCredential used by track2 SDK clients
+type servicePrincipalTokenCredential struct {
+	token *adal.ServicePrincipalToken
+}
+
+// GetToken refreshes the service principal token if it's expired, scopes are determined by the token resource
+func (c *servicePrincipalTokenCredential) GetToken(ctx context.Context, _ policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	if err := c.token.EnsureFreshWithContext(ctx); err != nil {
+		return azcore.AccessToken{}, err
+	}
+	token := c.token.Token()
+	return azcore.AccessToken{Token: token.AccessToken, ExpiresOn: token.Expires()}, nil
+}
+
+// monitorMetricsClient gets storage account metrics through Azure Monitor REST API
+type monitorMetricsClient struct {
+	autorest.Client
+	baseURI string
+}
+
+// monitorMetricsResponse is the subset of Azure Monitor metrics response used by driver
+type monitorMetricsResponse struct {
+	Value []struct {
+		Timeseries []struct {
+			Data []struct {
+				Average *float64 `json:"average"`
+			} `json:"data"`
+		} `json:"timeseries"`
+	} `json:"value"`
+}
+
+// GetUsedCapacity returns the latest UsedCapacity metric of the storage account in bytes
+func (c *monitorMetricsClient) GetUsedCapacity(ctx context.Context, subsID, resourceGroupName, accountName string) (int64, error) {
+	pathParameters := map[string]interface{}{
+		"subscriptionId":    autorest.Encode("path", subsID),
+		"resourceGroupName": autorest.Encode("path", resourceGroupName),
+		"accountName":       autorest.Encode("path", accountName),
+	}
+	queryParameters := map[string]interface{}{
+		"api-version": monitorMetricsAPIVersion,
+		"metricnames": "UsedCapacity",
+		"aggregation": "Average",
+		"interval":    "PT1H",
+	}
+	preparer := autorest.CreatePreparer(
+		autorest.AsGet(),
+		autorest.WithBaseURL(c.baseURI),
+		autorest.WithPathParameters("/subscriptions/{subscriptionId}/resourceGroups/{resourceGroupName}/providers/Microsoft.Storage/storageAccounts/{accountName}/providers/Microsoft.Insights/metrics", pathParameters),
+		autorest.WithQueryParameters(queryParameters))
+	req, err := preparer.Prepare((&http.Request{}).WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.Send(req, autorest.DoRetryForStatusCodes(c.RetryAttempts, c.RetryDuration, autorest.StatusCodesForRetry...))
+	if err != nil {
+		return 0, err
+	}
+	var result monitorMetricsResponse
+	if err := autorest.Respond(resp,
+		autorest.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&result),
+		autorest.ByClosing()); err != nil {
+		return 0, err
+	}
+	return getLatestMetricValue(result)
+}
+
+// getLatestMetricValue returns the value of the latest data point which has an average value
+func getLatestMetricValue(result monitorMetricsResponse) (int64, error) {
+	for _, value := range result.Value {
+		for _, timeseries := range value.Timeseries {
+			for i := len(timeseries.Data) - 1; i >= 0; i-- {
+				if timeseries.Data[i].Average != nil {
+					return int64(*timeseries.Data[i].Average), nil
+				}
+			}
+		}
+	}
+	return 0, fmt.Errorf("no data point found in metrics response")
+}
+
 func (d *Driver) updateSubnetServiceEndpoints(ctx context.Context, vnetResourceGroup, vnetName, subnetName string) error {
 	if d.cloud.SubnetsClient == nil {
 		return fmt.Errorf("SubnetsClient is nil")
@@ -272,6 +449,40 @@ func (d *Driver) updateSubnetServiceEndpoints(ctx context.Context, vnetResourceG
 	return nil
 }
 
+// setContainerRootAccessControl sets owner and group of the root directory of HNS enabled container
+// by data lake storage setAccessControl API, dfsEndpoint is like https://account.dfs.core.windows.net
+func setContainerRootAccessControl(ctx context.Context, client *http.Client, dfsEndpoint, containerName, sasToken, owner, group string) error {
+	if owner == "" && group == "" {
+		return nil
+	}
+	reqURL := fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(dfsEndpoint, "/"), containerName, sasToken)
+	if strings.Contains(reqURL, "?") {
+		reqURL += "&action=setAccessControl"
+	} else {
+		reqURL += "?action=setAccessControl"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, reqURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("x-ms-version", dataLakeAPIVersion)
+	if owner != "" {
+		req.Header.Set("x-ms-owner", owner)
+	}
+	if group != "" {
+		req.Header.Set("x-ms-group", group)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("setAccessControl on container(%s) failed with status(%s), error code: %s", containerName, resp.Status, resp.Header.Get("x-ms-error-code"))
+	}
+	return nil
+}
+
 func getKubeConfig(kubeconfig string) (config *rest.Config, err error) {
 	if kubeconfig != "" {
 		if config, err = clientcmd.BuildConfigFromFlags("", kubeconfig); err != nil {
@@ -18,16 +18,25 @@ package blob
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
 	"github.com/Azure/azure-sdk-for-go/storage"
 	"github.com/golang/mock/gomock"
 
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/adal"
 	"github.com/Azure/go-autorest/autorest/azure"
 	"github.com/stretchr/testify/assert"
 
@@ -375,6 +384,199 @@ func TestUpdateSubnetServiceEndpoints(t *testing.T) {
 	}
 }
 
+func TestSetContainerRootAccessControl(t *testing.T) {
+	tests := []struct {
+		desc        string
+		owner       string
+		group       string
+		statusCode  int
+		expectedErr error
+	}{
+		{
+			desc:       "set owner and group",
+			owner:      "1000",
+			group:      "2000",
+			statusCode: http.StatusOK,
+		},
+		{
+			desc:       "set owner only",
+			owner:      "b4c5a1a0-3c5b-4d2b-9a4f-6f1e2d3c4b5a",
+			statusCode: http.StatusOK,
+		},
+		{
+			desc:        "setAccessControl failure",
+			owner:       "1000",
+			statusCode:  http.StatusForbidden,
+			expectedErr: fmt.Errorf("setAccessControl on container(container) failed with status(403 Forbidden), error code: AuthorizationPermissionMismatch"),
+		},
+	}
+
+	for _, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPatch, r.Method)
+			assert.Equal(t, "/container/", r.URL.Path)
+			assert.Equal(t, "setAccessControl", r.URL.Query().Get("action"))
+			assert.Equal(t, "sastoken", r.URL.Query().Get("sig"))
+			assert.Equal(t, test.owner, r.Header.Get("x-ms-owner"))
+			assert.Equal(t, test.group, r.Header.Get("x-ms-group"))
+			if test.statusCode != http.StatusOK {
+				w.Header().Set("x-ms-error-code", "AuthorizationPermissionMismatch")
+			}
+			w.WriteHeader(test.statusCode)
+		}))
+		err := setContainerRootAccessControl(context.Background(), server.Client(), server.URL, "container", "?sig=sastoken", test.owner, test.group)
+		if !reflect.DeepEqual(err, test.expectedErr) {
+			t.Errorf("test(%s), actualErr: (%v), expectedErr: (%v)", test.desc, err, test.expectedErr)
+		}
+		server.Close()
+	}
+}
+
+func TestMonitorMetricsClientGetUsedCapacity(t *testing.T) {
+	tests := []struct {
+		desc          string
+		statusCode    int
+		body          string
+		expectedBytes int64
+		expectErr     bool
+	}{
+		{
+			desc:          "latest data point with average value is used",
+			statusCode:    http.StatusOK,
+			body:          `{"value":[{"timeseries":[{"data":[{"average":1024},{"average":2048},{}]}]}]}`,
+			expectedBytes: 2048,
+		},
+		{
+			desc:       "no data point",
+			statusCode: http.StatusOK,
+			body:       `{"value":[{"timeseries":[]}]}`,
+			expectErr:  true,
+		},
+		{
+			desc:       "metrics API failure",
+			statusCode: http.StatusForbidden,
+			body:       `{"code":"AuthorizationFailed"}`,
+			expectErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodGet, r.Method)
+			assert.Equal(t, "/subscriptions/subsID/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/account/providers/Microsoft.Insights/metrics", r.URL.Path)
+			assert.Equal(t, "UsedCapacity", r.URL.Query().Get("metricnames"))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(test.statusCode)
+			_, _ = w.Write([]byte(test.body))
+		}))
+		client := &monitorMetricsClient{Client: autorest.NewClientWithUserAgent(""), baseURI: server.URL}
+		client.RetryAttempts = 1
+		usedBytes, err := client.GetUsedCapacity(context.Background(), "subsID", "rg", "account")
+		if (err != nil) != test.expectErr {
+			t.Errorf("test(%s), unexpected error: %v", test.desc, err)
+		}
+		if usedBytes != test.expectedBytes {
+			t.Errorf("test(%s), actual used bytes: %d, expected used bytes: %d", test.desc, usedBytes, test.expectedBytes)
+		}
+		server.Close()
+	}
+}
+
+func TestGetStorageTokenCredential(t *testing.T) {
+	d := NewFakeDriver()
+	d.cloud = &azureprovider.Cloud{}
+	// no credential is configured in cloud config
+	if _, err := d.getStorageTokenCredential(); err == nil {
+		t.Errorf("expected error when no credential is configured")
+	}
+}
+
+func TestGetServicePrincipalTokenCached(t *testing.T) {
+	d := NewFakeDriver()
+	d.cloud = &azureprovider.Cloud{}
+	d.cloud.Environment = azure.PublicCloud
+	d.cloud.TenantID = "tenantID"
+	d.cloud.AADClientID = "clientID"
+	d.cloud.AADClientSecret = "clientSecret"
+
+	token, err := d.getServicePrincipalToken(azure.PublicCloud.ServiceManagementEndpoint)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cached, err := d.getServicePrincipalToken(azure.PublicCloud.ServiceManagementEndpoint); err != nil || cached != token {
+		t.Errorf("expected cached service principal token to be reused, error: %v", err)
+	}
+	if other, err := d.getServicePrincipalToken(defaultStorageTokenResource); err != nil || other == token {
+		t.Errorf("expected a different service principal token for another resource, error: %v", err)
+	}
+	if _, err := d.getManagementToken(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := d.getStorageTokenCredential(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	resources := 0
+	d.servicePrincipalTokens.Range(func(_, _ interface{}) bool {
+		resources++
+		return true
+	})
+	if resources != 2 {
+		t.Errorf("service principal tokens of %d resources are cached, expected 2", resources)
+	}
+}
+
+func TestGetWorkloadIdentityCredential(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("token"), 0600); err != nil {
+		t.Fatalf("failed to write token file: %v", err)
+	}
+	d := NewFakeDriver()
+	d.cloud = &azureprovider.Cloud{}
+	d.cloud.TenantID = "tenantID"
+	d.cloud.AADFederatedTokenFile = tokenFile
+
+	if _, err := d.getWorkloadIdentityCredential("clientID", ""); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := d.getWorkloadIdentityCredential("clientID", "otherTenantID"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	d.cloud.AADFederatedTokenFile = ""
+	// t.Setenv restores the original value after the test
+	t.Setenv("AZURE_FEDERATED_TOKEN_FILE", "")
+	os.Unsetenv("AZURE_FEDERATED_TOKEN_FILE")
+	if _, err := d.getWorkloadIdentityCredential("clientID", ""); err == nil {
+		t.Errorf("expected error when token file is not configured")
+	}
+}
+
+func TestServicePrincipalTokenCredentialGetToken(t *testing.T) {
+	expiresOn := time.Now().Add(time.Hour).Truncate(time.Second)
+	token := adal.Token{
+		AccessToken: "access-token",
+		ExpiresOn:   json.Number(strconv.FormatInt(expiresOn.Unix(), 10)),
+		Resource:    defaultStorageTokenResource,
+		Type:        "Bearer",
+	}
+	oauthConfig, err := adal.NewOAuthConfig(azure.PublicCloud.ActiveDirectoryEndpoint, "tenantID")
+	if err != nil {
+		t.Fatalf("failed to create oauth config: %v", err)
+	}
+	spt, err := adal.NewServicePrincipalTokenFromManualToken(*oauthConfig, "clientID", defaultStorageTokenResource, token)
+	if err != nil {
+		t.Fatalf("failed to create service principal token: %v", err)
+	}
+	credential := &servicePrincipalTokenCredential{token: spt}
+	accessToken, err := credential.GetToken(context.Background(), policy.TokenRequestOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if accessToken.Token != "access-token" || !accessToken.ExpiresOn.Equal(expiresOn) {
+		t.Errorf("unexpected access token: %v, expected token: access-token, expires on: %v", accessToken, expiresOn)
+	}
+}
+
 func TestGetKubeConfig(t *testing.T) {
 	emptyKubeConfig := "empty-Kube-Config"
 	validKubeConfig := "valid-Kube-Config"
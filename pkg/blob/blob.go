@@ -17,8 +17,16 @@ limitations under the License.
 package blob
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
@@ -34,7 +42,9 @@ import (
 	v1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
+	clientretry "k8s.io/client-go/util/retry"
 	"k8s.io/klog/v2"
 	k8sutil "k8s.io/kubernetes/pkg/volume/util"
 	mount "k8s.io/mount-utils"
@@ -52,8 +62,19 @@ const (
 	DefaultDriverName              = "blob.csi.azure.com"
 	blobCSIDriverName              = "blob_csi_driver"
 	separator                      = "#"
-	volumeIDTemplate               = "%s#%s#%s#%s#%s#%s"
+	volumeIDV2Template             = "v2#%s#%s#%s#%s#%s#%s#%s#%s#%s"
+	volumeIDVersionV2              = "v2"
+	volumeIDV2SegmentCount         = 9
+	volumeIDDataPlaneAPI           = "dataplane"
+	volumeIDLatestAccountKey       = "latestkey"
+	volumeIDImmutable              = "immutable"
+	volumeIDBlobInventory          = "inventory"
+	volumeIDLifecycle              = "lifecycle"
+	volumeIDPerVolumeSecret        = "volumesecret"
+	volumeIDFlagSeparator          = ","
+	snapshotIDTemplate             = "%s#%s#%s#%s#%s"
 	secretNameTemplate             = "azure-storage-account-%s-secret"
+	volumeSecretNameTemplate       = "azure-storage-account-%s-%s-secret"
 	serverNameField                = "server"
 	storageEndpointSuffixField     = "storageendpointsuffix"
 	tagsField                      = "tags"
@@ -71,6 +92,7 @@ const (
 	secretNamespaceField           = "secretnamespace"
 	containerNameField             = "containername"
 	containerNamePrefixField       = "containernameprefix"
+	containerNameTemplateField     = "containernametemplate"
 	storeAccountKeyField           = "storeaccountkey"
 	isHnsEnabledField              = "ishnsenabled"
 	softDeleteBlobsField           = "softdeleteblobs"
@@ -93,6 +115,9 @@ const (
 	defaultSecretAccountName       = "azurestorageaccountname"
 	defaultSecretAccountKey        = "azurestorageaccountkey"
 	accountSasTokenField           = "azurestorageaccountsastoken"
+	sourceSasURLField              = "sourcesasurl"
+	destinationSasURLField         = "destinationsasurl"
+	cloneSasTokenField             = "sastoken"
 	msiSecretField                 = "msisecret"
 	storageSPNClientSecretField    = "azurestoragespnclientsecret"
 	EcProtocol                     = "edgecache"
@@ -104,6 +129,7 @@ const (
 	vnetNameField                  = "vnetname"
 	subnetNameField                = "subnetname"
 	accessTierField                = "accesstier"
+	containerAccessTierField       = "containeraccesstier"
 	networkEndpointTypeField       = "networkendpointtype"
 	mountPermissionsField          = "mountpermissions"
 	useDataPlaneAPIField           = "usedataplaneapi"
@@ -115,6 +141,45 @@ const (
 	storageIdentityResourceIDField = "azurestorageidentityresourceid"
 	msiEndpointField               = "msiendpoint"
 	storageAADEndpointField        = "azurestorageaadendpoint"
+	enableLargeBlockBlobField      = "enablelargeblockblob"
+	waitForContainerReadyField     = "waitforcontainerready"
+	containerReadyTimeoutField     = "containerreadytimeout"
+	restoreDeletedContainerField   = "restoredeletedcontainer"
+	allowSharedKeyAccessField      = "allowsharedkeyaccess"
+	useUserDelegationSASField      = "useuserdelegationsas"
+	defaultToOAuthAuthField        = "defaulttooauthauthentication"
+	rootOwnerField                 = "rootowner"
+	rootGroupField                 = "rootgroup"
+	requesterField                 = "requester"
+	exposureField                  = "exposure"
+	azcopyRetryCountField          = "azcopyretrycount"
+	azcopyCopyTimeoutField         = "azcopycopytimeout"
+	azcopyPreservePermissionsField = "azcopypreservepermissions"
+	allowReservedNamesField        = "allowreservedcontainernames"
+	onSkuMismatchField             = "onskumismatch"
+	enableBlobInventoryField       = "enableblobinventory"
+	blobInventoryDestField         = "blobinventorydestination"
+	blobInventoryScheduleField     = "blobinventoryschedule"
+	blobInventoryFormatField       = "blobinventoryformat"
+	deletePolicyField              = "deletepolicy"
+	allowSoftDeletedField          = "allowsoftdeleted"
+	dryRunField                    = "dryrun"
+	storeMetadataField             = "storemetadata"
+	createContainerField           = "createcontainer"
+	minimumTLSVersionField         = "minimumtlsversion"
+	setSecretOwnerReferenceField   = "setsecretownerreference"
+	clientIDField                  = "clientid"
+	tenantIDField                  = "tenantid"
+	allowedIPRangesField           = "allowedipranges"
+	networkDefaultActionField      = "networkdefaultaction"
+	enableChangeFeedField          = "enablechangefeed"
+	changeFeedRetentionDaysField   = "changefeedretentiondays"
+	enableLastAccessTimeField      = "enablelastaccesstimetracking"
+	lifecyclePolicyField           = "lifecyclepolicy"
+	containerTagsField             = "containertags"
+	containerPublicAccessField     = "containerpublicaccess"
+	defaultEncryptionScopeField    = "defaultencryptionscope"
+	immutabilityPeriodDaysField    = "immutabilityperioddays"
 
 	// See https://docs.microsoft.com/en-us/rest/api/storageservices/naming-and-referencing-containers--blobs--and-metadata#container-names
 	containerNameMinLength = 3
@@ -123,10 +188,21 @@ const (
 	accountNotProvisioned                   = "StorageAccountIsNotProvisioned"
 	tooManyRequests                         = "TooManyRequests"
 	clientThrottled                         = "client throttled"
+	tooManyContainers                       = "TooManyContainers"
+	containerAlreadyExists                  = "ContainerAlreadyExists"
 	containerBeingDeletedDataplaneAPIError  = "ContainerBeingDeleted"
 	containerBeingDeletedManagementAPIError = "container is being deleted"
+	containerLegalHoldDataplaneAPIError     = "LegalHold"
+	containerLegalHoldManagementAPIError    = "legal hold"
 	statusCodeNotFound                      = "StatusCode=404"
 	httpCodeNotFound                        = "HTTPStatusCode: 404"
+	httpCodeForbidden                       = "HTTPStatusCode: 403"
+	authorizationFailed                     = "AuthorizationFailed"
+	resourceGroupNotFound                   = "ResourceGroupNotFound"
+	parentResourceNotFound                  = "ParentResourceNotFound"
+	storageAccountNotFound                  = "StorageAccountNotFound"
+	connectionResetError                    = "connection reset by peer"
+	tlsHandshakeTimeoutError                = "TLS handshake timeout"
 
 	// containerMaxSize is the max size of the blob container. See https://docs.microsoft.com/en-us/azure/storage/blobs/scalability-targets#scale-targets-for-blob-storage
 	containerMaxSize = 100 * util.TiB
@@ -142,14 +218,103 @@ const (
 	pvcNamespaceMetadata = "${pvc.metadata.namespace}"
 	pvNameMetadata       = "${pv.metadata.name}"
 
-	VolumeID = "volumeid"
+	// short hash of the volume name, keeps names generated from a template unique
+	volumeNameHashMetadata = "${hash}"
+
+	VolumeID   = "volumeid"
+	SnapshotID = "snapshotid"
 
 	defaultStorageEndPointSuffix = "core.windows.net"
+
+	exposurePrivate  = "private"
+	exposureInternal = "internal"
+	exposurePublic   = "public"
+
+	skuMismatchIgnore = "ignore"
+	skuMismatchWarn   = "warn"
+	skuMismatchFail   = "fail"
+
+	deletePolicyDelete = "delete"
+	deletePolicyRetain = "retain"
+
+	clusterNameTagKey = "k8s-azure-cluster-name"
+	requesterTagKey   = "k8s-azure-requester"
+	// hash of account options and settings of the storage account created with account settings
+	accountSettingsTagKey = "k8s-azure-blob-account-settings"
+	// container metadata name must be a valid C# identifier
+	requesterMetadataKey = "k8srequester"
+	// container metadata recording the blob inventory rule created by driver
+	blobInventoryRuleMetadataKey = "k8sblobinventoryrule"
+	lifecycleRuleMetadataKey     = "k8slifecyclerule"
+	blobInventoryRulePrefix      = "blobcsi"
+	lifecycleRulePrefix          = "blobcsilifecycle"
+	// lifecycle management rule filter allows up to 10 prefixes
+	maxLifecycleRulePrefixes = 10
+	// snapshot container is named as <source container>-snapshot-<hash of snapshot name>
+	snapshotContainerInfix = "-snapshot-"
+	// container metadata recording source volume and creation time of snapshot container,
+	// snapshot containers are recognized by the source volume metadata
+	snapshotSourceMetadataKey = "k8ssnapshotsource"
+	snapshotTimeMetadataKey   = "k8ssnapshotcreationtime"
+	// container metadata recording the source container copied into the container by driver, so that a copy
+	// interrupted before completion, e.g. by controller restart, is resumed instead of being rejected
+	copySourceMetadataKey = "k8scopysource"
+	// container metadata recording requested capacity of the volume in bytes
+	capacityMetadataKey = "k8scapacitybytes"
+	// container metadata recording hash of the CreateVolume request which created the container, so that a repeated
+	// request with incompatible parameters is still detected after controller restart
+	createRequestMetadataKey = "k8screaterequest"
+	// container metadata recording quota of the volume in GiB, updated in volume expansion
+	quotaMetadataKey = "quota"
+	// container metadata recording default access tier of the container, used by per PVC cost policies
+	accessTierMetadataKey = "k8saccesstier"
+	// container metadata recording pvc/pv of the volume when storeMetadata is true
+	pvcNameMetadataKey      = "pvcname"
+	pvcNamespaceMetadataKey = "pvcnamespace"
+	pvNameMetadataKey       = "pvname"
+	// See https://learn.microsoft.com/en-us/azure/storage/common/scalability-targets-standard-account
+	standardAccountCapacityBytes = 5 * 1024 * util.TiB
+	// See https://learn.microsoft.com/en-us/azure/storage/blobs/scalability-targets-premium-block-blobs
+	premiumAccountCapacityBytes = 100 * util.TiB
+	// returned in GetCapacity if storage account could not be resolved
+	unknownCapacityBytes = math.MaxInt64
+	// See https://learn.microsoft.com/en-us/azure/azure-resource-manager/management/tag-resources#limitations
+	maxTagsPerResource = 50
+	maxTagValueLength  = 256
+	// See https://learn.microsoft.com/en-us/rest/api/storageservices/setting-and-retrieving-properties-and-metadata-for-blob-resources
+	maxContainerMetadataBytes = 8 * 1024
+	// topology key of the region where node runs or storage account is located
+	topologyRegionKey = "topology.blob.csi.azure.com/region"
+	// label on account key secret created by driver, secrets without this label are never deleted by driver
+	secretManagedByLabel = "app.kubernetes.io/managed-by"
+	// annotation on account key secret created by driver recording a container referencing the secret
+	secretReferenceAnnotationPrefix = "volume.blob.csi.azure.com/"
 )
 
 var (
-	supportedProtocolList = []string{EcProtocol, Fuse, Fuse2, NFS}
-	retriableErrors       = []string{accountNotProvisioned, tooManyRequests, statusCodeNotFound, containerBeingDeletedDataplaneAPIError, containerBeingDeletedManagementAPIError, clientThrottled}
+	supportedProtocolList       = []string{EcProtocol, Fuse, Fuse2, NFS}
+	supportedExposureList       = []string{exposurePrivate, exposureInternal, exposurePublic}
+	supportedSkuMismatchActions = []string{skuMismatchIgnore, skuMismatchWarn, skuMismatchFail}
+	supportedDeletePolicies     = []string{deletePolicyDelete, deletePolicyRetain}
+	supportedPublicAccessList   = []string{string(storage.PublicAccessNone), string(storage.PublicAccessBlob), string(storage.PublicAccessContainer)}
+	supportedMinimumTLSVersions = []string{string(storage.MinimumTLSVersionTLS10), string(storage.MinimumTLSVersionTLS11), string(storage.MinimumTLSVersionTLS12)}
+	supportedDefaultActions     = []string{string(storage.DefaultActionAllow), string(storage.DefaultActionDeny)}
+	// sku names supported by the kind of storage account created by driver, premium block blob account does not support
+	// geo redundancy and Azure Stack only supports locally redundant storage
+	supportedSkuNamesByKind = map[string][]string{
+		string(storage.KindStorageV2):        {string(storage.SkuNameStandardLRS), string(storage.SkuNameStandardGRS), string(storage.SkuNameStandardRAGRS), string(storage.SkuNameStandardZRS), string(storage.SkuNameStandardGZRS), string(storage.SkuNameStandardRAGZRS)},
+		string(storage.KindBlockBlobStorage): {string(storage.SkuNamePremiumLRS), string(storage.SkuNamePremiumZRS)},
+		string(storage.KindStorage):          {string(storage.SkuNamePremiumLRS), string(storage.SkuNameStandardLRS)},
+	}
+	// See https://learn.microsoft.com/en-us/rest/api/storageservices/working-with-the-root-container
+	reservedContainerNames = []string{"$root", "$logs", "$web", "$blobchangefeed"}
+	// only transient 404 is retriable, parent resource is not found until a newly created storage account is propagated
+	retriableErrors = []string{accountNotProvisioned, tooManyRequests, parentResourceNotFound, containerBeingDeletedDataplaneAPIError, containerBeingDeletedManagementAPIError, clientThrottled, connectionResetError, tlsHandshakeTimeoutError}
+	// container metadata keys managed by driver, could not be set by containerTags
+	reservedContainerMetadataKeys = []string{requesterMetadataKey, blobInventoryRuleMetadataKey, lifecycleRuleMetadataKey, snapshotSourceMetadataKey, snapshotTimeMetadataKey, capacityMetadataKey, createRequestMetadataKey, quotaMetadataKey, accessTierMetadataKey, pvcNameMetadataKey, pvcNamespaceMetadataKey, pvNameMetadataKey}
+	// match "HTTPStatusCode: 429" and "RetryAfter: 16s" in errors returned by cloud provider
+	httpStatusCodeRegex = regexp.MustCompile(`HTTPStatusCode: (\d+)`)
+	retryAfterRegex     = regexp.MustCompile(`RetryAfter: (\d+)s`)
 )
 
 // DriverOptions defines driver parameters specified in driver deployment
@@ -179,6 +344,29 @@ type DriverOptions struct {
 	EnableAznfsMount                       bool
 	VolStatsCacheExpireInMinutes           int
 	SasTokenExpirationMinutes              int
+	ClusterName                            string
+	StrictVolumeIDParsing                  bool
+	DeleteMaxTotalDuration                 time.Duration
+	AzcopyPollInterval                     time.Duration
+	AzcopyPollMaxInterval                  time.Duration
+	AzcopyPollJitterFactor                 float64
+	AzcopyJobsLogInterval                  time.Duration
+	EnableBlobVersioningOnReuse            bool
+	EnableTopology                         bool
+	ListVolumesStorageAccounts             string
+	AzcopyConcurrencyValue                 int
+	AzcopyBlockSizeMB                      int
+	AzcopyLogLevel                         string
+	AzcopyLogDir                           string
+	AzcopyLogMaxAge                        time.Duration
+	UseContainerSasToken                   bool
+	MaxAccountFallbacks                    int
+	AccountBackoffJitterFactor             float64
+	PerVolumeSecretName                    bool
+	EnableVolumeIDV2                       bool
+	EnableListVolumes                      bool
+	MaxConcurrentVolumeOperations          int
+	AzureAPIProbeFailureThreshold          int
 }
 
 // Driver implements all interfaces of CSI drivers
@@ -211,20 +399,93 @@ type Driver struct {
 	// A map storing all volumes with ongoing operations so that additional operations
 	// for that same volume (as defined by VolumeID) return an Aborted error
 	volumeLocks *volumeLocks
+	// limits in-flight CreateVolume and DeleteVolume operations so that Azure API is not overwhelmed by a burst of requests
+	volumeOperationLimiter *volumeOperationLimiter
+	// Probe reports not ready once Azure API reachability check fails consecutively for threshold times, 0 disables the check
+	azureAPIProbeFailureThreshold int
+	// consecutive failures and time of the last Azure API reachability check, guarded by azureAPIProbeMutex
+	azureAPIProbeMutex     sync.Mutex
+	azureAPIProbeFailures  int
+	azureAPIProbeLastCheck time.Time
+	// service principal tokens of driver identity <resource, *adal.ServicePrincipalToken>, reused across requests
+	// so that Azure AD is not called per request, the token is refreshed on use when it's expired
+	servicePrincipalTokens sync.Map
 	// only for nfs feature
 	subnetLockMap *util.LockMap
+	// serializes read-modify-write of account wide policies, e.g. blob inventory policy
+	accountPolicyLockMap *util.LockMap
 	// a map storing all volumes created by this driver <volumeName, accountName>
 	volMap sync.Map
+	// a map storing request hash and result of volumes created by this driver <volumeName, *createdVolume>,
+	// used to detect repeated CreateVolume requests with incompatible parameters, the request hash is also
+	// recorded in container metadata so that the comparison does not depend on this map after restart
+	createdVolumes sync.Map
+	// a map indexing createdVolumes by volume id <volumeID, volumeName>, used to remove the volume in DeleteVolume
+	createdVolumeNames sync.Map
+	// destination containers of azcopy clone jobs in copyBlobContainer, used to list in-flight clone jobs
+	azcopyJobContainers sync.Map
 	// a timed cache storing all volumeIDs and storage accounts that are using data plane API
 	dataPlaneAPIVolCache azcache.Resource
 	// a timed cache storing account search history (solve account list throttling issue)
 	accountSearchCache azcache.Resource
+	// a short-lived timed cache storing failures of account search and creation <lockKey, error>
+	accountSearchFailureCache azcache.Resource
+	// a timed cache storing delete type of containers by container soft delete policy <subsID/rg/account, deleteType>
+	containerDeleteTypeCache azcache.Resource
 	// a timed cache storing volume stats <volumeID, volumeStats>
 	volStatsCache azcache.Resource
 	// sas expiry time for azcopy in volume clone
 	sasTokenExpirationMinutes int
+	// a timed cache storing sas tokens generated in volume clone, expires before the sas token
+	sasTokenCache azcache.Resource
+	// generate container scoped service sas token instead of account sas token in volume clone
+	useContainerSasToken bool
+	// max number of new storage accounts created when the account picked by driver is full
+	maxAccountFallbacks int
+	// jitter factor added to retry backoff of storage account search and creation, 0 means no jitter
+	accountBackoffJitterFactor float64
+	// store account key in a secret per volume instead of a secret shared by volumes on the same account
+	perVolumeSecretName bool
+	// return v2 volume id, v1 volume id is returned until node plugins of all nodes are able to parse v2 volume id
+	enableVolumeIDV2 bool
+	// report LIST_VOLUMES capability and record provisioned capacity in container metadata for ListVolumes
+	enableListVolumes bool
 	// azcopy for provide exec mock for ut
 	azcopy *util.Azcopy
+	// cluster name tagged on storage accounts created by driver
+	clusterName string
+	// return error instead of success on unparseable volume ID in DeleteVolume
+	strictVolumeIDParsing bool
+	// max total time spent on retrying container deletion, 0 means no limit
+	deleteMaxTotalDuration time.Duration
+	// azcopy job status polling interval in volume clone, polling is adaptive between interval and max interval with jitter
+	azcopyPollInterval     time.Duration
+	azcopyPollMaxInterval  time.Duration
+	azcopyPollJitterFactor float64
+	// interval of logging in-flight azcopy clone jobs, 0 means in-flight clone jobs are not logged
+	azcopyJobsLogInterval time.Duration
+	// enable blob versioning on existing storage account if enableBlobVersioning is requested
+	enableBlobVersioningOnReuse bool
+	// report region topology in NodeGetInfo and CreateVolume
+	enableTopology bool
+	// storage accounts in driver resource group listed in ListVolumes in addition to cached accounts
+	listVolumesAccounts []string
+	// blobInventoryPoliciesClient is only for testing, a new client is created per request if it's nil
+	blobInventoryPoliciesClient blobInventoryPoliciesClient
+	// managementPoliciesClient is only for testing, a new client is created per request if it's nil
+	managementPoliciesClient managementPoliciesClient
+	// blobContainersClient is only for testing, a new client is created per request if it's nil
+	blobContainersClient blobContainersClient
+	// storageAccountsClient is only for testing, a new client is created per request if it's nil
+	storageAccountsClient storageAccountsClient
+	// accountMetricsClient is only for testing, a new client is created per request if it's nil
+	accountMetricsClient accountMetricsClient
+	// containerRestorer is only for testing, a data plane client is created per request if it's nil
+	containerRestorer containerRestorer
+	// copyDestinationClient is only for testing, a data plane container reference is created per request if it's nil
+	copyDestinationClient copyDestinationClient
+	// keyVaultClient is only for testing, a new client is created per request if it's nil
+	keyVaultClient keyVaultSecretGetter
 }
 
 // NewDriver Creates a NewCSIDriver object. Assumes vendor version is equal to driver version &
@@ -233,7 +494,10 @@ func NewDriver(options *DriverOptions) *Driver {
 	d := Driver{
 		volLockMap:                             util.NewLockMap(),
 		subnetLockMap:                          util.NewLockMap(),
+		accountPolicyLockMap:                   util.NewLockMap(),
 		volumeLocks:                            newVolumeLocks(),
+		volumeOperationLimiter:                 newVolumeOperationLimiter(options.MaxConcurrentVolumeOperations),
+		azureAPIProbeFailureThreshold:          options.AzureAPIProbeFailureThreshold,
 		cloudConfigSecretName:                  options.CloudConfigSecretName,
 		cloudConfigSecretNamespace:             options.CloudConfigSecretNamespace,
 		customUserAgent:                        options.CustomUserAgent,
@@ -253,7 +517,27 @@ func NewDriver(options *DriverOptions) *Driver {
 		kubeAPIBurst:                           options.KubeAPIBurst,
 		enableAznfsMount:                       options.EnableAznfsMount,
 		sasTokenExpirationMinutes:              options.SasTokenExpirationMinutes,
-		azcopy:                                 &util.Azcopy{},
+		useContainerSasToken:                   options.UseContainerSasToken,
+		maxAccountFallbacks:                    options.MaxAccountFallbacks,
+		accountBackoffJitterFactor:             options.AccountBackoffJitterFactor,
+		perVolumeSecretName:                    options.PerVolumeSecretName,
+		enableVolumeIDV2:                       options.EnableVolumeIDV2,
+		enableListVolumes:                      options.EnableListVolumes,
+		azcopy:                                 &util.Azcopy{ConcurrencyValue: options.AzcopyConcurrencyValue, BlockSizeMB: options.AzcopyBlockSizeMB, LogLevel: options.AzcopyLogLevel, LogDir: options.AzcopyLogDir, LogMaxAge: options.AzcopyLogMaxAge},
+		clusterName:                            options.ClusterName,
+		strictVolumeIDParsing:                  options.StrictVolumeIDParsing,
+		deleteMaxTotalDuration:                 options.DeleteMaxTotalDuration,
+		azcopyPollInterval:                     options.AzcopyPollInterval,
+		azcopyPollMaxInterval:                  options.AzcopyPollMaxInterval,
+		azcopyPollJitterFactor:                 options.AzcopyPollJitterFactor,
+		azcopyJobsLogInterval:                  options.AzcopyJobsLogInterval,
+		enableBlobVersioningOnReuse:            options.EnableBlobVersioningOnReuse,
+		enableTopology:                         options.EnableTopology,
+	}
+	for _, account := range strings.Split(options.ListVolumesStorageAccounts, ",") {
+		if account = strings.TrimSpace(account); account != "" {
+			d.listVolumesAccounts = append(d.listVolumesAccounts, account)
+		}
 	}
 	d.Name = options.DriverName
 	d.Version = driverVersion
@@ -264,9 +548,15 @@ func NewDriver(options *DriverOptions) *Driver {
 	if d.accountSearchCache, err = azcache.NewTimedCache(time.Minute, getter, false); err != nil {
 		klog.Fatalf("%v", err)
 	}
+	if d.accountSearchFailureCache, err = azcache.NewTimedCache(accountSearchFailureCacheTTL, getter, false); err != nil {
+		klog.Fatalf("%v", err)
+	}
 	if d.dataPlaneAPIVolCache, err = azcache.NewTimedCache(10*time.Minute, getter, false); err != nil {
 		klog.Fatalf("%v", err)
 	}
+	if d.containerDeleteTypeCache, err = azcache.NewTimedCache(10*time.Minute, getter, false); err != nil {
+		klog.Fatalf("%v", err)
+	}
 
 	if options.VolStatsCacheExpireInMinutes <= 0 {
 		options.VolStatsCacheExpireInMinutes = 10 // default expire in 10 minutes
@@ -274,6 +564,12 @@ func NewDriver(options *DriverOptions) *Driver {
 	if d.volStatsCache, err = azcache.NewTimedCache(time.Duration(options.VolStatsCacheExpireInMinutes)*time.Minute, getter, false); err != nil {
 		klog.Fatalf("%v", err)
 	}
+
+	// refresh sas token when half of its lifetime has passed, cache is disabled if sas token expiration is not set
+	sasTokenCacheTTL := time.Duration(options.SasTokenExpirationMinutes) * time.Minute / 2
+	if d.sasTokenCache, err = azcache.NewTimedCache(sasTokenCacheTTL, getter, sasTokenCacheTTL <= 0); err != nil {
+		klog.Fatalf("%v", err)
+	}
 	return &d
 }
 
@@ -300,15 +596,21 @@ func (d *Driver) Run(endpoint, kubeconfig string, testBool bool) {
 	}
 
 	// Initialize default library driver
-	d.AddControllerServiceCapabilities(
-		[]csi.ControllerServiceCapability_RPC_Type{
-			csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
-			//csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
-			//csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS,
-			csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
-			csi.ControllerServiceCapability_RPC_SINGLE_NODE_MULTI_WRITER,
-			csi.ControllerServiceCapability_RPC_CLONE_VOLUME,
-		})
+	controllerCaps := []csi.ControllerServiceCapability_RPC_Type{
+		csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
+		csi.ControllerServiceCapability_RPC_GET_CAPACITY,
+		csi.ControllerServiceCapability_RPC_GET_VOLUME,
+		csi.ControllerServiceCapability_RPC_VOLUME_CONDITION,
+		csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
+		csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS,
+		csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
+		csi.ControllerServiceCapability_RPC_SINGLE_NODE_MULTI_WRITER,
+		csi.ControllerServiceCapability_RPC_CLONE_VOLUME,
+	}
+	if d.enableListVolumes {
+		controllerCaps = append(controllerCaps, csi.ControllerServiceCapability_RPC_LIST_VOLUMES)
+	}
+	d.AddControllerServiceCapabilities(controllerCaps)
 	d.AddVolumeCapabilityAccessModes([]csi.VolumeCapability_AccessMode_Mode{
 		csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
 		csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY,
@@ -328,14 +630,50 @@ func (d *Driver) Run(endpoint, kubeconfig string, testBool bool) {
 	}
 	d.AddNodeServiceCapabilities(nodeCap)
 
+	if d.azcopyJobsLogInterval > 0 {
+		go wait.Until(d.logAzcopyJobs, d.azcopyJobsLogInterval, wait.NeverStop)
+	}
+
 	s := csicommon.NewNonBlockingGRPCServer()
 	// Driver d act as IdentityServer, ControllerServer and NodeServer
 	s.Start(endpoint, d, d, d, testBool)
 	s.Wait()
 }
 
-// GetContainerInfo get container info according to volume id
-// the format of VolumeId is: rg#accountName#containerName#uuid#secretNamespace#subsID
+// getVolumeIDSegments splits volume id into segments in v1 format, version prefix of v2 volume id is removed
+// the format of v1 VolumeId is: rg#accountName#containerName#uuid#secretNamespace#subsID#deletePolicy#storageEndpointSuffix,
+// segments after containerName are optional
+// the format of v2 VolumeId is: v2#rg#accountName#containerName#uuid#secretNamespace#subsID#deletePolicy#storageEndpointSuffix#protocol[#flags],
+// segments up to storageEndpointSuffix are always present and new segments could only be appended,
+// flags is a comma separated list of volume options, e.g. "dataplane,latestkey"
+//
+// v1 volume id created by driver has the same segments as v2 volume id without version prefix, see formatVolumeID,
+// v1 volume id in resource group named "v2" is not parsed as v2 as long as it has at most 8 segments
+func getVolumeIDSegments(id string) []string {
+	segments := strings.Split(id, separator)
+	if len(segments) >= volumeIDV2SegmentCount && segments[0] == volumeIDVersionV2 {
+		return segments[1:]
+	}
+	return segments
+}
+
+// formatVolumeID returns v2 volume id as it is if --enable-volume-id-v2 is set, otherwise version prefix is removed
+// so that node plugin of old versions, which parses the first 6 segments in v1 format, is able to handle the volume,
+// segments after subsID are kept since they are ignored by old node plugin
+func (d *Driver) formatVolumeID(v2ID string) string {
+	if d.enableVolumeIDV2 {
+		return v2ID
+	}
+	segments := strings.Split(v2ID, separator)
+	if len(segments) < volumeIDV2SegmentCount || segments[0] != volumeIDVersionV2 || segments[1] == volumeIDVersionV2 {
+		// v1 volume id with trailing segments in resource group named "v2" would be parsed as v2
+		return v2ID
+	}
+	return strings.Join(segments[1:], separator)
+}
+
+// GetContainerInfo get container info according to volume id, both v1 and v2 volume id are supported,
+// see getVolumeIDSegments for the format of VolumeId
 //
 // e.g.
 // input: "rg#f5713de20cde511e8ba4900#containerName#uuid#"
@@ -344,8 +682,10 @@ func (d *Driver) Run(endpoint, kubeconfig string, testBool bool) {
 // output: rg, f5713de20cde511e8ba4900, containerName, namespace, ""
 // input: "rg#f5713de20cde511e8ba4900#containerName#uuid#namespace#subsID"
 // output: rg, f5713de20cde511e8ba4900, containerName, namespace, subsID
+// input: "v2#rg#f5713de20cde511e8ba4900#containerName#uuid#namespace#subsID#delete#"
+// output: rg, f5713de20cde511e8ba4900, containerName, namespace, subsID
 func GetContainerInfo(id string) (string, string, string, string, string, error) {
-	segments := strings.Split(id, separator)
+	segments := getVolumeIDSegments(id)
 	if len(segments) < 3 {
 		return "", "", "", "", "", fmt.Errorf("error parsing volume id: %q, should at least contain two #", id)
 	}
@@ -359,6 +699,174 @@ func GetContainerInfo(id string) (string, string, string, string, string, error)
 	return segments[0], segments[1], segments[2], secretNamespace, subsID, nil
 }
 
+// getDeletePolicy get delete policy according to volume id, the policy is appended
+// to volume id as an optional segment since volume context is not available in DeleteVolume
+//
+// e.g.
+// input: "rg#f5713de20cde511e8ba4900#containerName#uuid#namespace#subsID"
+// output: "delete"
+// input: "rg#f5713de20cde511e8ba4900#containerName#uuid#namespace#subsID#retain"
+// output: "retain"
+// input: "v2#rg#f5713de20cde511e8ba4900#containerName#uuid#namespace#subsID#retain#"
+// output: "retain"
+func getDeletePolicy(id string) string {
+	segments := getVolumeIDSegments(id)
+	if len(segments) > 6 && segments[6] != "" {
+		return segments[6]
+	}
+	return deletePolicyDelete
+}
+
+// getStorageEndpointSuffixFromVolumeID get storage endpoint suffix according to volume id, the suffix is appended
+// to volume id as an optional segment after delete policy when it's not the cloud default,
+// empty string is returned if the segment is missing so that the cloud default is used
+//
+// e.g.
+// input: "rg#f5713de20cde511e8ba4900#containerName#uuid#namespace#subsID#retain"
+// output: ""
+// input: "rg#f5713de20cde511e8ba4900#containerName#uuid#namespace#subsID##core.chinacloudapi.cn"
+// output: "core.chinacloudapi.cn"
+// input: "v2#rg#f5713de20cde511e8ba4900#containerName#uuid#namespace#subsID#delete#core.chinacloudapi.cn"
+// output: "core.chinacloudapi.cn"
+func getStorageEndpointSuffixFromVolumeID(id string) string {
+	segments := getVolumeIDSegments(id)
+	if len(segments) > 7 {
+		return segments[7]
+	}
+	return ""
+}
+
+// getProtocolFromVolumeID get protocol according to v2 volume id, empty string is returned if protocol is unknown,
+// e.g. volume id is in v1 format
+//
+// e.g.
+// input: "rg#f5713de20cde511e8ba4900#containerName#uuid#namespace#subsID"
+// output: ""
+// input: "v2#rg#f5713de20cde511e8ba4900#containerName#uuid#namespace#subsID#delete##nfs"
+// output: "nfs"
+func getProtocolFromVolumeID(id string) string {
+	segments := getVolumeIDSegments(id)
+	if len(segments) > 8 {
+		return segments[8]
+	}
+	return ""
+}
+
+// hasVolumeIDFlag returns whether the flag is in the optional flags segment after protocol of v2 volume id,
+// volume options are recorded as flags so that volume operations without volume context honor them as well
+//
+// e.g.
+// input: "v2#rg#f5713de20cde511e8ba4900#containerName#uuid#namespace#subsID#delete##fuse", "dataplane"
+// output: false
+// input: "v2#rg#f5713de20cde511e8ba4900#containerName#uuid#namespace#subsID#delete##fuse#dataplane,latestkey", "latestkey"
+// output: true
+func hasVolumeIDFlag(id, flag string) bool {
+	segments := getVolumeIDSegments(id)
+	if len(segments) <= 9 {
+		return false
+	}
+	for _, f := range strings.Split(segments[9], volumeIDFlagSeparator) {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// isDataPlaneAPIVolumeID returns whether the v2 volume id is created with useDataPlaneAPI
+func isDataPlaneAPIVolumeID(id string) bool {
+	return hasVolumeIDFlag(id, volumeIDDataPlaneAPI)
+}
+
+// isLatestAccountKeyVolumeID returns whether the v2 volume id is created with getLatestAccountKey
+func isLatestAccountKeyVolumeID(id string) bool {
+	return hasVolumeIDFlag(id, volumeIDLatestAccountKey)
+}
+
+// isImmutableVolumeID returns whether the v2 volume id is created with immutabilityPeriodDays
+func isImmutableVolumeID(id string) bool {
+	return hasVolumeIDFlag(id, volumeIDImmutable)
+}
+
+// isBlobInventoryVolumeID returns whether the v2 volume id is created with enableBlobInventory
+func isBlobInventoryVolumeID(id string) bool {
+	return hasVolumeIDFlag(id, volumeIDBlobInventory)
+}
+
+// isLifecycleVolumeID returns whether the v2 volume id is created with lifecyclePolicy
+func isLifecycleVolumeID(id string) bool {
+	return hasVolumeIDFlag(id, volumeIDLifecycle)
+}
+
+// isPerVolumeSecretVolumeID returns whether the v2 volume id is created with --per-volume-secret-name,
+// so that the account key secret is found by the same name after the driver flag is changed
+func isPerVolumeSecretVolumeID(id string) bool {
+	return hasVolumeIDFlag(id, volumeIDPerVolumeSecret)
+}
+
+// GetSnapshotInfo get snapshot container info according to snapshot id
+// the format of SnapshotId is: rg#accountName#snapshotContainerName#secretNamespace#subsID[#storageEndpointSuffix]
+//
+// e.g.
+// input: "rg#f5713de20cde511e8ba4900#snapshot-1234##"
+// output: rg, f5713de20cde511e8ba4900, snapshot-1234, "", ""
+// input: "rg#f5713de20cde511e8ba4900#snapshot-1234#namespace#subsID"
+// output: rg, f5713de20cde511e8ba4900, snapshot-1234, namespace, subsID
+func GetSnapshotInfo(id string) (string, string, string, string, string, error) {
+	segments := strings.Split(id, separator)
+	if len(segments) < 3 {
+		return "", "", "", "", "", fmt.Errorf("error parsing snapshot id: %q, should at least contain two #", id)
+	}
+	var secretNamespace, subsID string
+	if len(segments) > 3 {
+		secretNamespace = segments[3]
+	}
+	if len(segments) > 4 {
+		subsID = segments[4]
+	}
+	return segments[0], segments[1], segments[2], secretNamespace, subsID, nil
+}
+
+// getSnapshotID returns snapshot id of the snapshot container, storage endpoint suffix is only appended
+// when it's not the cloud default so that snapshot id of the default endpoint stays unchanged
+func getSnapshotID(resourceGroupName, accountName, containerName, secretNamespace, subsID, storageEndpointSuffix string) string {
+	snapshotID := fmt.Sprintf(snapshotIDTemplate, resourceGroupName, accountName, containerName, secretNamespace, subsID)
+	if storageEndpointSuffix != "" {
+		snapshotID += separator + storageEndpointSuffix
+	}
+	return snapshotID
+}
+
+// getStorageEndpointSuffixFromSnapshotID get storage endpoint suffix according to snapshot id,
+// empty string is returned if the segment is missing so that the cloud default is used
+//
+// e.g.
+// input: "rg#f5713de20cde511e8ba4900#snapshot-1234#namespace#subsID"
+// output: ""
+// input: "rg#f5713de20cde511e8ba4900#snapshot-1234#namespace#subsID#core.chinacloudapi.cn"
+// output: "core.chinacloudapi.cn"
+func getStorageEndpointSuffixFromSnapshotID(id string) string {
+	segments := strings.Split(id, separator)
+	if len(segments) > 5 {
+		return segments[5]
+	}
+	return ""
+}
+
+// getSnapshotContainerName returns snapshot container name of the snapshot,
+// source container name is truncated if it's too long, the name is deterministic for the same snapshot
+func getSnapshotContainerName(srcContainerName, snapshotName string) string {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(snapshotName))
+	suffix := fmt.Sprintf("%08x", hash.Sum32())
+	maxPrefixLength := containerNameMaxLength - len(snapshotContainerInfix) - len(suffix)
+	prefix := srcContainerName
+	if len(prefix) > maxPrefixLength {
+		prefix = strings.TrimRight(prefix[:maxPrefixLength], "-")
+	}
+	return prefix + snapshotContainerInfix + suffix
+}
+
 // A container name must be a valid DNS name, conforming to the following naming rules:
 //  1. Container names must start with a letter or number, and can contain only letters, numbers, and the dash (-) character.
 //  2. Every dash (-) character must be immediately preceded and followed by a letter or number; consecutive dashes are not permitted in container names.
@@ -423,8 +931,9 @@ func (d *Driver) GetAuthEnv(ctx context.Context, volumeID, protocol string, attr
 		azureStorageAuthType    string
 		authEnv                 []string
 		getAccountKeyFromSecret bool
-		getLatestAccountKey     bool
 	)
+	// getLatestAccountKey recorded in volume id could be overridden by volume context
+	getLatestAccountKey := isLatestAccountKeyVolumeID(volumeID)
 
 	for k, v := range attrib {
 		switch strings.ToLower(k) {
@@ -510,7 +1019,7 @@ func (d *Driver) GetAuthEnv(ctx context.Context, volumeID, protocol string, attr
 	} else {
 		if len(secrets) == 0 {
 			if secretName == "" && accountName != "" {
-				secretName = fmt.Sprintf(secretNameTemplate, accountName)
+				secretName = getAccountKeySecretName(accountName, containerName, isPerVolumeSecretVolumeID(volumeID))
 			}
 			if secretName != "" {
 				// read from k8s secret first
@@ -614,9 +1123,10 @@ func (d *Driver) GetStorageAccountAndContainer(ctx context.Context, volumeID str
 		keyVaultURL           string
 		keyVaultSecretName    string
 		keyVaultSecretVersion string
-		getLatestAccountKey   bool
 		err                   error
 	)
+	// getLatestAccountKey recorded in volume id could be overridden by volume context
+	getLatestAccountKey := isLatestAccountKeyVolumeID(volumeID)
 
 	for k, v := range attrib {
 		switch strings.ToLower(k) {
@@ -685,15 +1195,86 @@ func IsCorruptedDir(dir string) bool {
 	return pathErr != nil && mount.IsCorruptedMnt(pathErr)
 }
 
+// isRetriableError returns whether a retry loop around an Azure management or data plane API call should continue,
+// nil error and errors that retrying could not fix are not retriable
 func isRetriableError(err error) bool {
-	if err != nil {
-		for _, v := range retriableErrors {
-			if strings.Contains(strings.ToLower(err.Error()), strings.ToLower(v)) {
-				return true
-			}
+	retriable, _, _ := getRetriableErrorInfo(err)
+	return retriable
+}
+
+// isContainerBeingDeletedError checks whether the container with the same name is still being deleted
+func isContainerBeingDeletedError(err error) bool {
+	if err == nil {
+		return false
+	}
+	return strings.Contains(err.Error(), containerBeingDeletedDataplaneAPIError) ||
+		strings.Contains(err.Error(), containerBeingDeletedManagementAPIError)
+}
+
+// isContainerLegalHoldError checks whether the container could not be deleted since it has a legal hold
+func isContainerLegalHoldError(err error) bool {
+	if err == nil {
+		return false
+	}
+	return strings.Contains(err.Error(), containerLegalHoldDataplaneAPIError) ||
+		strings.Contains(strings.ToLower(err.Error()), containerLegalHoldManagementAPIError)
+}
+
+// getRetriableErrorInfo returns whether the error is retriable, along with the HTTP status code
+// and suggested retry interval if they are present in the error returned by cloud provider
+func getRetriableErrorInfo(err error) (bool, int, time.Duration) {
+	if err == nil {
+		return false, 0, 0
+	}
+	errMsg := err.Error()
+	// retrying could not help once the request is canceled or timed out
+	isContextError := errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+	var httpStatusCode int
+	if matches := httpStatusCodeRegex.FindStringSubmatch(errMsg); len(matches) == 2 {
+		httpStatusCode, _ = strconv.Atoi(matches[1])
+	}
+	var retryAfter time.Duration
+	if matches := retryAfterRegex.FindStringSubmatch(errMsg); len(matches) == 2 {
+		if seconds, err := strconv.Atoi(matches[1]); err == nil {
+			retryAfter = time.Duration(seconds) * time.Second
 		}
 	}
-	return false
+	for _, v := range retriableErrors {
+		if !isContextError && strings.Contains(strings.ToLower(errMsg), strings.ToLower(v)) {
+			return true, httpStatusCode, retryAfter
+		}
+	}
+	return false, httpStatusCode, retryAfter
+}
+
+// isThrottlingError checks whether the error is caused by Azure API throttling
+func isThrottlingError(err error, httpStatusCode int) bool {
+	if httpStatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	errMsg := strings.ToLower(err.Error())
+	return strings.Contains(errMsg, strings.ToLower(tooManyRequests)) || strings.Contains(errMsg, strings.ToLower(clientThrottled))
+}
+
+// isAccountFullError checks whether the storage account reaches its container limit
+func isAccountFullError(err error) bool {
+	if err == nil {
+		return false
+	}
+	// match both error code and error message, e.g. "TooManyContainers" and "too many containers"
+	return strings.Contains(strings.ToLower(strings.ReplaceAll(err.Error(), " ", "")), strings.ToLower(tooManyContainers))
+}
+
+// isAccountNotFoundError checks whether the storage account or its resource group does not exist,
+// e.g. the account is deleted out of band, so that nothing is left in it
+func isAccountNotFoundError(err error) bool {
+	if err == nil {
+		return false
+	}
+	errMsg := err.Error()
+	return strings.Contains(errMsg, resourceGroupNotFound) ||
+		strings.Contains(errMsg, parentResourceNotFound) ||
+		strings.Contains(errMsg, storageAccountNotFound)
 }
 
 func isSupportedProtocol(protocol string) bool {
@@ -720,6 +1301,16 @@ func isSupportedAccessTier(accessTier string) bool {
 	return false
 }
 
+// isReservedContainerName checks whether the container name is reserved by Azure, e.g. $root, $logs, $web
+func isReservedContainerName(containerName string) bool {
+	for _, name := range reservedContainerNames {
+		if strings.EqualFold(containerName, name) {
+			return true
+		}
+	}
+	return false
+}
+
 // container names can contain only lowercase letters, numbers, and hyphens,
 // and must begin and end with a letter or a number
 func isSupportedContainerNamePrefix(prefix string) bool {
@@ -740,6 +1331,62 @@ func isSupportedContainerNamePrefix(prefix string) bool {
 	return true
 }
 
+// validateContainerName checks whether the container name specified by user follows Azure container naming rules,
+// reserved container names are not supported on HNS enabled account, e.g. account of NFS protocol
+func validateContainerName(containerName string, isHnsEnabled, allowReservedContainerNames bool) error {
+	if isReservedContainerName(containerName) {
+		if isHnsEnabled {
+			return fmt.Errorf("containerName(%s) is reserved by Azure and not supported on HNS enabled account or NFS protocol", containerName)
+		}
+		if allowReservedContainerNames {
+			return nil
+		}
+	}
+	if !isValidContainerName(containerName) {
+		return fmt.Errorf("containerName(%s) is invalid, container name can only contain lowercase letters, numbers and single hyphens, must begin and end with a letter or number, and length should be between %d and %d", containerName, containerNameMinLength, containerNameMaxLength)
+	}
+	return nil
+}
+
+// isValidContainerName checks whether the container name follows Azure container naming rules
+func isValidContainerName(containerName string) bool {
+	if len(containerName) < containerNameMinLength || len(containerName) > containerNameMaxLength {
+		return false
+	}
+	if containerName[0] == '-' || containerName[len(containerName)-1] == '-' || strings.Contains(containerName, "--") {
+		return false
+	}
+	for _, v := range containerName {
+		if v != '-' && (v < '0' || v > '9') && (v < 'a' || v > 'z') {
+			return false
+		}
+	}
+	return true
+}
+
+// getBlobInventoryRuleName returns the name of blob inventory rule created by driver for the container,
+// rule name could only contain alphanumeric characters, so a hash of the container name is used
+func getBlobInventoryRuleName(containerName string) string {
+	hash := sha256.Sum256([]byte(containerName))
+	return blobInventoryRulePrefix + hex.EncodeToString(hash[:16])
+}
+
+// getLifecycleRuleName returns the name prefix of lifecycle management rules shared by containers with the same policy,
+// rule name only allows alphanumeric characters, so a hash of the policy is used
+func getLifecycleRuleName(policy *lifecyclePolicy) string {
+	value, _ := json.Marshal(policy)
+	hash := sha256.Sum256(value)
+	return lifecycleRulePrefix + hex.EncodeToString(hash[:16])
+}
+
+// owner or group of HNS path could be a POSIX UID/GID or an Azure AD object ID
+func isValidRootOwner(id string) bool {
+	if _, err := strconv.ParseUint(id, 10, 32); err == nil {
+		return true
+	}
+	return uuid.Parse(id) != nil
+}
+
 // get storage account from secrets map
 func getStorageAccount(secrets map[string]string) (string, string, error) {
 	if secrets == nil {
@@ -790,7 +1437,18 @@ func getContainerReference(containerName string, secrets map[string]string, env
 	return container, nil
 }
 
-func setAzureCredentials(ctx context.Context, kubeClient kubernetes.Interface, accountName, accountKey, secretNamespace string) (string, error) {
+// getAccountKeySecretName returns name of the secret storing account key of the volume, the secret is shared by
+// all volumes on the same account by default, and is per volume if the volume is created with --per-volume-secret-name
+func getAccountKeySecretName(accountName, containerName string, perVolume bool) string {
+	if perVolume && containerName != "" {
+		return fmt.Sprintf(volumeSecretNameTemplate, accountName, containerName)
+	}
+	return fmt.Sprintf(secretNameTemplate, accountName)
+}
+
+// setAzureCredentials stores account name and key in secret, secret name is generated from account name if it's empty,
+// secret created by driver is labeled as managed by driver and records containers referencing it in annotations
+func setAzureCredentials(ctx context.Context, kubeClient kubernetes.Interface, accountName, accountKey, secretName, secretNamespace, containerName string) (string, error) {
 	if kubeClient == nil {
 		klog.Warningf("could not create secret: kubeClient is nil")
 		return "", nil
@@ -798,11 +1456,14 @@ func setAzureCredentials(ctx context.Context, kubeClient kubernetes.Interface, a
 	if accountName == "" || accountKey == "" {
 		return "", fmt.Errorf("the account info is not enough, accountName(%v), accountKey(%v)", accountName, accountKey)
 	}
-	secretName := fmt.Sprintf(secretNameTemplate, accountName)
+	if secretName == "" {
+		secretName = fmt.Sprintf(secretNameTemplate, accountName)
+	}
 	secret := &v1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: secretNamespace,
 			Name:      secretName,
+			Labels:    map[string]string{secretManagedByLabel: DefaultDriverName},
 		},
 		Data: map[string][]byte{
 			defaultSecretAccountName: []byte(accountName),
@@ -810,9 +1471,12 @@ func setAzureCredentials(ctx context.Context, kubeClient kubernetes.Interface, a
 		},
 		Type: "Opaque",
 	}
+	if containerName != "" {
+		secret.Annotations = map[string]string{secretReferenceAnnotationPrefix + containerName: ""}
+	}
 	_, err := kubeClient.CoreV1().Secrets(secretNamespace).Create(ctx, secret, metav1.CreateOptions{})
 	if k8serrors.IsAlreadyExists(err) {
-		err = nil
+		err = addSecretReference(ctx, kubeClient, secretName, secretNamespace, containerName)
 	}
 	if err != nil {
 		return "", fmt.Errorf("couldn't create secret %w", err)
@@ -820,11 +1484,113 @@ func setAzureCredentials(ctx context.Context, kubeClient kubernetes.Interface, a
 	return secretName, err
 }
 
+// addSecretReference records container referencing the existing secret, secret not created by driver is left untouched
+func addSecretReference(ctx context.Context, kubeClient kubernetes.Interface, secretName, secretNamespace, containerName string) error {
+	if containerName == "" {
+		return nil
+	}
+	key := secretReferenceAnnotationPrefix + containerName
+	return clientretry.RetryOnConflict(clientretry.DefaultRetry, func() error {
+		secret, err := kubeClient.CoreV1().Secrets(secretNamespace).Get(ctx, secretName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if secret.Labels[secretManagedByLabel] != DefaultDriverName {
+			return nil
+		}
+		if _, ok := secret.Annotations[key]; ok {
+			return nil
+		}
+		if secret.Annotations == nil {
+			secret.Annotations = map[string]string{}
+		}
+		secret.Annotations[key] = ""
+		_, err = kubeClient.CoreV1().Secrets(secretNamespace).Update(ctx, secret, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// addSecretOwnerReference adds owner reference to the secret created by driver so that the secret is garbage collected
+// after all owners are deleted, secret not created by driver is left untouched
+func addSecretOwnerReference(ctx context.Context, kubeClient kubernetes.Interface, secretName, secretNamespace string, owner metav1.OwnerReference) error {
+	return clientretry.RetryOnConflict(clientretry.DefaultRetry, func() error {
+		secret, err := kubeClient.CoreV1().Secrets(secretNamespace).Get(ctx, secretName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if secret.Labels[secretManagedByLabel] != DefaultDriverName {
+			return nil
+		}
+		for _, ref := range secret.OwnerReferences {
+			if ref.UID == owner.UID {
+				return nil
+			}
+		}
+		secret.OwnerReferences = append(secret.OwnerReferences, owner)
+		_, err = kubeClient.CoreV1().Secrets(secretNamespace).Update(ctx, secret, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// releaseAzureCredentials removes the container from references of the secret created by driver,
+// the secret is deleted when it's not referenced by any container, secret not created by driver is never deleted
+func releaseAzureCredentials(ctx context.Context, kubeClient kubernetes.Interface, secretName, secretNamespace, containerName string) error {
+	if kubeClient == nil {
+		klog.Warningf("could not release secret: kubeClient is nil")
+		return nil
+	}
+	key := secretReferenceAnnotationPrefix + containerName
+	return clientretry.RetryOnConflict(clientretry.DefaultRetry, func() error {
+		secret, err := kubeClient.CoreV1().Secrets(secretNamespace).Get(ctx, secretName, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if secret.Labels[secretManagedByLabel] != DefaultDriverName {
+			return nil
+		}
+		if _, ok := secret.Annotations[key]; !ok {
+			return nil
+		}
+		delete(secret.Annotations, key)
+		for k := range secret.Annotations {
+			if strings.HasPrefix(k, secretReferenceAnnotationPrefix) {
+				klog.V(4).Infof("secret(%s) in namespace(%s) is still referenced by %s", secretName, secretNamespace, strings.TrimPrefix(k, secretReferenceAnnotationPrefix))
+				_, err = kubeClient.CoreV1().Secrets(secretNamespace).Update(ctx, secret, metav1.UpdateOptions{})
+				return err
+			}
+		}
+		klog.V(2).Infof("delete secret(%s) in namespace(%s) since it's not referenced by any volume", secretName, secretNamespace)
+		// precondition makes sure the secret is not referenced by a new volume since it's read
+		err = kubeClient.CoreV1().Secrets(secretNamespace).Delete(ctx, secretName, metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{ResourceVersion: &secret.ResourceVersion},
+		})
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	})
+}
+
+// keyVaultSecret refers to the secret storing the storage account key in Azure Key Vault
+type keyVaultSecret struct {
+	vaultURL      string
+	secretName    string
+	secretVersion string
+}
+
 // GetStorageAccesskey get Azure storage account key from
-//  1. secrets (if not empty)
-//  2. use k8s client identity to read from k8s secret
-//  3. use cluster identity to get from storage account directly
-func (d *Driver) GetStorageAccesskey(ctx context.Context, accountOptions *azure.AccountOptions, secrets map[string]string, secretName, secretNamespace string) (string, string, error) {
+//  1. key vault secret (if not nil)
+//  2. secrets (if not empty)
+//  3. use k8s client identity to read from k8s secret
+//  4. use cluster identity to get from storage account directly
+func (d *Driver) GetStorageAccesskey(ctx context.Context, accountOptions *azure.AccountOptions, secrets map[string]string, secretName, secretNamespace string, keyVault *keyVaultSecret) (string, string, error) {
+	if keyVault != nil {
+		accountKey, err := d.getAccountKeyFromKeyVault(ctx, keyVault.vaultURL, keyVault.secretName, keyVault.secretVersion)
+		return accountOptions.Name, accountKey, err
+	}
 	if len(secrets) > 0 {
 		return getStorageAccount(secrets)
 	}
@@ -865,6 +1631,53 @@ func (d *Driver) GetInfoFromSecret(ctx context.Context, secretName, secretNamesp
 	return accountName, accountKey, accountSasToken, msiSecret, spnClientSecret, spnClientID, spnTenantID, nil
 }
 
+// vnetSubnet is a pair of virtual network name and subnet name, empty name means the value in cloud provider config
+type vnetSubnet struct {
+	vnetName   string
+	subnetName string
+}
+
+// parseVnetSubnets parses comma separated subnetName and vnetName into vnet/subnet pairs,
+// a single vnetName applies to all subnets, otherwise vnetName and subnetName must have the same number of entries
+func parseVnetSubnets(vnetName, subnetName string) ([]vnetSubnet, error) {
+	subnets, err := splitNetworkNames(subnetNameField, subnetName)
+	if err != nil {
+		return nil, err
+	}
+	vnets, err := splitNetworkNames(vnetNameField, vnetName)
+	if err != nil {
+		return nil, err
+	}
+	if len(vnets) != 1 && len(vnets) != len(subnets) {
+		return nil, fmt.Errorf("vnetName(%s) must be a single virtual network or have the same number of entries as subnetName(%s)", vnetName, subnetName)
+	}
+	result := make([]vnetSubnet, 0, len(subnets))
+	for i, subnet := range subnets {
+		vnet := vnets[0]
+		if len(vnets) > 1 {
+			vnet = vnets[i]
+		}
+		result = append(result, vnetSubnet{vnetName: vnet, subnetName: subnet})
+	}
+	return result, nil
+}
+
+// splitNetworkNames splits comma separated vnet or subnet names, empty value is returned as a single empty name
+func splitNetworkNames(field, value string) ([]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return []string{""}, nil
+	}
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("invalid %s(%s), should be comma separated names", field, value)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
 // getSubnetResourceID get default subnet resource ID from cloud provider config
 func (d *Driver) getSubnetResourceID(vnetResourceGroup, vnetName, subnetName string) string {
 	subsID := d.cloud.SubscriptionID
@@ -889,7 +1702,12 @@ func (d *Driver) getSubnetResourceID(vnetResourceGroup, vnetName, subnetName str
 	return fmt.Sprintf(subnetTemplate, subsID, vnetResourceGroup, vnetName, subnetName)
 }
 
+// useDataPlaneAPI returns whether data plane API should be used for the volume, useDataPlaneAPI recorded in volume id
+// takes precedence, dataPlaneAPIVolCache is checked for volume ids without it, e.g. v1 volume id or snapshot id
 func (d *Driver) useDataPlaneAPI(volumeID, accountName string) bool {
+	if isDataPlaneAPIVolumeID(volumeID) {
+		return true
+	}
 	cache, err := d.dataPlaneAPIVolCache.Get(volumeID, azcache.CacheReadTypeDefault)
 	if err != nil {
 		klog.Errorf("get(%s) from dataPlaneAPIVolCache failed with error: %v", volumeID, err)
@@ -986,6 +1804,185 @@ func setKeyValueInMap(m map[string]string, key, value string) {
 	m[key] = value
 }
 
+// setTagIfNotExists set key/value pair in tags if key is not specified by user
+// return error if value is not a valid tag value or tags number exceeds the limit
+func setTagIfNotExists(tags map[string]string, key, value string) error {
+	if _, ok := tags[key]; ok {
+		return nil
+	}
+	if value == "" || len(value) > maxTagValueLength {
+		return fmt.Errorf("tag value(%s) of key(%s) should not be empty and its length should be no more than %d", value, key, maxTagValueLength)
+	}
+	if len(tags) >= maxTagsPerResource {
+		return fmt.Errorf("could not add tag(%s) since tags number(%d) reaches the limit(%d)", key, len(tags), maxTagsPerResource)
+	}
+	tags[key] = value
+	return nil
+}
+
+// getContainerMetadataFromTags parses containerTags in the same format as tags,
+// the tags are set as container metadata so the key must be a valid C# identifier
+func getContainerMetadataFromTags(containerTags string) (map[string]string, error) {
+	metadata, err := util.ConvertTagsToMap(containerTags)
+	if err != nil {
+		return nil, err
+	}
+	var size int
+	for k, v := range metadata {
+		for i, c := range k {
+			if !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && c != '_' && (i == 0 || !(c >= '0' && c <= '9')) {
+				return nil, fmt.Errorf("container tag key(%s) should start with a letter or underscore and contain only letters, digits and underscores", k)
+			}
+		}
+		if util.ContainsString(reservedContainerMetadataKeys, strings.ToLower(k), nil) {
+			return nil, fmt.Errorf("container tag key(%s) is reserved by driver", k)
+		}
+		for _, c := range v {
+			if c < ' ' || c > '~' {
+				return nil, fmt.Errorf("container tag value of key(%s) contains invalid character %q", k, c)
+			}
+		}
+		size += len(k) + len(v)
+	}
+	if size > maxContainerMetadataBytes {
+		return nil, fmt.Errorf("total size(%d) of container tags exceeds the limit(%d)", size, maxContainerMetadataBytes)
+	}
+	return metadata, nil
+}
+
+// isValidEncryptionScopeName checks whether the encryption scope name is 3 to 63 alphanumeric characters
+// See https://learn.microsoft.com/en-us/azure/storage/blobs/encryption-scope-manage
+func isValidEncryptionScopeName(name string) bool {
+	if len(name) < 3 || len(name) > 63 {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// getStorageEndpointSuffix returns the storage endpoint suffix of the cloud environment, e.g. core.usgovcloudapi.net
+// in AzureUSGovernmentCloud and core.chinacloudapi.cn in AzureChinaCloud, default suffix is used if it's not set
+func (d *Driver) getStorageEndpointSuffix() string {
+	if d.cloud != nil && d.cloud.Environment.StorageEndpointSuffix != "" {
+		return d.cloud.Environment.StorageEndpointSuffix
+	}
+	return defaultStorageEndPointSuffix
+}
+
+// getStorageEnvironment returns cloud environment of the driver, storage endpoint suffix is overridden if it's not empty
+func (d *Driver) getStorageEnvironment(storageEndpointSuffix string) az.Environment {
+	env := d.cloud.Environment
+	if storageEndpointSuffix != "" {
+		env.StorageEndpointSuffix = storageEndpointSuffix
+	}
+	return env
+}
+
+// getBlobEndpoint returns the blob service endpoint of the storage account without trailing slash,
+// default storage endpoint suffix is used if storageEndpointSuffix is empty
+func getBlobEndpoint(accountName, storageEndpointSuffix string) string {
+	if storageEndpointSuffix == "" {
+		storageEndpointSuffix = defaultStorageEndPointSuffix
+	}
+	return fmt.Sprintf("https://%s.blob.%s", accountName, storageEndpointSuffix)
+}
+
+// normalizeStorageEndpointSuffix strips scheme, path and dots around the storage endpoint suffix,
+// as well as the leading "blob." service name, so that it could be used in "https://{account}.blob.{suffix}",
+// e.g. "https://account.blob.core.windows.net/" and ".blob.core.windows.net" are both normalized to "core.windows.net"
+func normalizeStorageEndpointSuffix(suffix string) string {
+	suffix = strings.TrimSpace(suffix)
+	if i := strings.Index(suffix, "://"); i >= 0 {
+		suffix = suffix[i+len("://"):]
+	}
+	if i := strings.Index(suffix, "/"); i >= 0 {
+		suffix = suffix[:i]
+	}
+	suffix = strings.Trim(suffix, ".")
+	if i := strings.Index(strings.ToLower(suffix), "blob."); i >= 0 && (i == 0 || suffix[i-1] == '.') {
+		suffix = suffix[i+len("blob."):]
+	}
+	return strings.Trim(suffix, ".")
+}
+
+// getValidRequester trims the requester identity and makes sure it's a stable identity string,
+// e.g. user name, service account or object ID, rather than a credential
+func getValidRequester(requester string) (string, error) {
+	requester = strings.TrimSpace(requester)
+	if requester == "" || len(requester) > maxTagValueLength {
+		return "", fmt.Errorf("requester should not be empty and its length should be no more than %d", maxTagValueLength)
+	}
+	for _, c := range requester {
+		if !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') && !strings.ContainsRune("-_.:@/", c) {
+			// not logging requester value here in case it's a credential
+			return "", fmt.Errorf("requester contains invalid character %q", c)
+		}
+	}
+	// reject JWT tokens which are three base64url segments separated by dots
+	if strings.HasPrefix(requester, "eyJ") && strings.Count(requester, ".") == 2 {
+		return "", fmt.Errorf("requester should be an identity instead of a token")
+	}
+	return requester, nil
+}
+
+// getContainerNameFromTemplate resolves placeholders in containerNameTemplate, hash of the volume name is appended
+// if there is no placeholder unique per volume in the template so that volumes do not share the same container,
+// returns error if there is any unresolved placeholder or the resolved name is not a valid container name
+func getContainerNameFromTemplate(template, volName, protocol string, replaceMap map[string]string) (string, error) {
+	hash := getVolumeNameHash(volName)
+	m := map[string]string{volumeNameHashMetadata: hash}
+	for k, v := range replaceMap {
+		m[k] = v
+	}
+	containerName := strings.ToLower(replaceWithMap(template, m))
+	if strings.Contains(containerName, "${") {
+		return "", fmt.Errorf("unresolved placeholder in %s(%s), resolved name: %s", containerNameTemplateField, template, containerName)
+	}
+	if !strings.Contains(template, volumeNameHashMetadata) && !strings.Contains(template, pvNameMetadata) {
+		if maxPrefixLength := containerNameMaxLength - len(hash) - 1; len(containerName) > maxPrefixLength {
+			containerName = strings.TrimRight(containerName[:maxPrefixLength], "-")
+		}
+		containerName = containerName + "-" + hash
+	}
+	if containerName == "" || !checkContainerNameBeginAndEnd(containerName) {
+		return "", fmt.Errorf("%s(%s) resolves to an invalid container name(%s), container name should begin and end with a lowercase letter or number", containerNameTemplateField, template, containerName)
+	}
+	containerName = getValidContainerName(containerName, protocol)
+	if !isValidContainerName(containerName) {
+		return "", fmt.Errorf("%s(%s) resolves to an invalid container name(%s), container name can only contain lowercase letters, numbers and single hyphens, and length should be between %d and %d", containerNameTemplateField, template, containerName, containerNameMinLength, containerNameMaxLength)
+	}
+	return containerName, nil
+}
+
+// getVolumeNameHash returns a short deterministic hash of the volume name
+func getVolumeNameHash(volName string) string {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(volName))
+	return fmt.Sprintf("%08x", hash.Sum32())
+}
+
+// getCachedAccount returns the storage account recorded in account search cache without populating the cache
+func (d *Driver) getCachedAccount(lockKey string) string {
+	obj, exists, err := d.accountSearchCache.GetStore().GetByKey(lockKey)
+	if err != nil || !exists {
+		return ""
+	}
+	entry, ok := obj.(*azcache.AzureCacheEntry)
+	if !ok {
+		return ""
+	}
+	entry.Lock.Lock()
+	defer entry.Lock.Unlock()
+	if accountName, ok := entry.Data.(string); ok {
+		return accountName
+	}
+	return ""
+}
+
 // replaceWithMap replace key with value for str
 func replaceWithMap(str string, m map[string]string) string {
 	for k, v := range m {
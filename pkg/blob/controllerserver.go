@@ -18,31 +18,51 @@ package blob
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"net"
+	"net/http"
 	"net/url"
-	"os/exec"
+	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
 	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2021-09-01/storage"
 	azstorage "github.com/Azure/azure-sdk-for-go/storage"
+	"github.com/Azure/go-autorest/autorest"
+	az "github.com/Azure/go-autorest/autorest/azure"
 	"github.com/container-storage-interface/spec/lib/go/csi"
 
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/klog/v2"
 	"k8s.io/utils/pointer"
 
 	csicommon "sigs.k8s.io/blob-csi-driver/pkg/csi-common"
+	cv "sigs.k8s.io/blob-csi-driver/pkg/edgecache/cachevolume"
 	"sigs.k8s.io/blob-csi-driver/pkg/util"
 	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
 	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
 	"sigs.k8s.io/cloud-provider-azure/pkg/provider"
 	azure "sigs.k8s.io/cloud-provider-azure/pkg/provider"
@@ -53,12 +73,54 @@ const (
 
 	waitForCopyInterval = 5 * time.Second
 	waitForCopyTimeout  = 3 * time.Minute
+
+	// max retry count of azcopy copy on failure in volume cloning
+	maxAzcopyRetryCount = 10
+
+	waitForContainerReadyInterval       = 2 * time.Second
+	defaultWaitForContainerReadyTimeout = time.Minute
+
+	// types of sas token generated in volume cloning
+	accountSASType        = "account"
+	containerSASType      = "container"
+	userDelegationSASType = "userdelegation"
+
+	// suggested backoff of retriable Azure errors without RetryAfter
+	defaultRetryAfter = 10 * time.Second
+
+	// reason of ErrorInfo attached to the FailedPrecondition status of a dry run
+	dryRunErrorReason = "DRY_RUN"
+
+	// initial retry interval of container deletion bounded by --delete-max-total-duration if cloud provider backoff is disabled
+	defaultDeleteRetryInterval = time.Second
+
+	// failure of EnsureStorageAccount is returned to requests with the same lockKey until it expires
+	accountSearchFailureCacheTTL = 30 * time.Second
+
+	// tolerance of clock skew when checking whether a storage account is created by EnsureStorageAccount
+	accountCreationTimeTolerance = 5 * time.Second
+
+	// max retention days of blob change feed
+	maxChangeFeedRetentionDays = 146000
+	// max days of time-based retention immutability policy of container
+	maxImmutabilityPeriodDays = 146000
+	// max days of actions in lifecycle management rule
+	maxLifecycleDays = 99999
+
+	// volume cloning and snapshot copy blob container with azcopy and sas token, which is not supported on Azure Stack Hub
+	azureStackCloneNotSupportedMsg = "volume cloning and snapshot are not supported on Azure Stack Hub, blob container is copied by azcopy which does not work with Azure Stack Hub storage endpoints"
 )
 
+// errDeleteMaxTotalDurationExceeded is returned when container deletion retries exceed --delete-max-total-duration
+var errDeleteMaxTotalDurationExceeded = errors.New("delete max total duration exceeded")
+
+// errImmutabilityPolicyLocked is returned when the immutability policy of a container is locked and could not be deleted
+var errImmutabilityPolicyLocked = errors.New("immutability policy is locked")
+
 // CreateVolume provisions a volume
 func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
 	if err := d.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME); err != nil {
-		klog.Errorf("invalid create volume req: %v", req)
+		klog.ErrorS(err, "invalid create volume request", volumeLogFields("CreateVolume", "", "", "", "volumeName", req.GetName())...)
 		return nil, err
 	}
 
@@ -71,267 +133,327 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
+	// sas urls for volume cloning are not storage account secrets, they must not switch CreateVolume to use secrets
+	userSecrets, cloneSasURLs, err := splitCloneSasURLs(req.GetSecrets())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if acquired := d.volumeOperationLimiter.TryAcquire(); !acquired {
+		return nil, status.Errorf(codes.Aborted, volumeOperationsExceededFmt, d.volumeOperationLimiter.max, volName)
+	}
+	defer d.volumeOperationLimiter.Release()
+
 	if acquired := d.volumeLocks.TryAcquire(volName); !acquired {
-		// logging the job status if it's volume cloning
+		// return the job status if it's volume cloning so that copy progress is shown in provisioner retries
 		if req.GetVolumeContentSource() != nil {
-			jobState, percent, err := d.azcopy.GetAzcopyJob(volName)
-			klog.V(2).Infof("azcopy job status: %s, copy percent: %s%%, error: %v", jobState, percent, err)
+			jobState, percent, _, err := d.azcopy.GetAzcopyJob(volName)
+			klog.V(2).InfoS("azcopy job status", volumeLogFields("CreateVolume", "", "", "", "volumeName", volName, "jobState", jobState, "percent", percent, "err", err)...)
+			return nil, status.Errorf(codes.Aborted, volumeCloneInProgressFmt, volName, jobState, percent)
 		}
 		return nil, status.Errorf(codes.Aborted, volumeOperationAlreadyExistsFmt, volName)
 	}
 	defer d.volumeLocks.Release(volName)
 
+	if v, ok := d.createdVolumes.Load(volName); ok {
+		created := v.(*createdVolume)
+		if !created.isCompatible(req) {
+			return nil, status.Errorf(codes.AlreadyExists, "volume(%s) already exists with different parameters, capacity or content source", volName)
+		}
+		klog.V(2).InfoS("volume already exists", volumeLogFields("CreateVolume", created.volume.GetVolumeId(), "", "", "volumeName", volName)...)
+		return &csi.CreateVolumeResponse{Volume: created.volume}, nil
+	}
+
 	volSizeBytes := int64(req.GetCapacityRange().GetRequiredBytes())
 	requestGiB := int(util.RoundUpGiB(volSizeBytes))
+	capacityBytes := getProvisionedCapacityBytes(volSizeBytes, req.GetCapacityRange().GetLimitBytes())
 
+	// parameters are updated as volume context below, hash the request before that
+	requestHash := getCreateVolumeRequestHash(req)
 	parameters := req.GetParameters()
 	if parameters == nil {
 		parameters = make(map[string]string)
 	}
-	var storageAccountType, subsID, resourceGroup, location, account, containerName, containerNamePrefix, protocol, customTags, secretName, secretNamespace, pvcNamespace string
-	var isHnsEnabled, requireInfraEncryption, enableBlobVersioning, createPrivateEndpoint, enableNfsV3 *bool
-	var vnetResourceGroup, vnetName, subnetName, accessTier, networkEndpointType, storageEndpointSuffix string
-	var matchTags, useDataPlaneAPI, getLatestAccountKey bool
-	var softDeleteBlobs, softDeleteContainers int32
-	var vnetResourceIDs []string
-	var err error
-	// set allowBlobPublicAccess as false by default
-	allowBlobPublicAccess := pointer.Bool(false)
-
-	containerNameReplaceMap := map[string]string{}
-
-	// store account key to k8s secret by default
-	storeAccountKey := true
+	p, err := parseCreateVolumeParameters(parameters)
+	if err != nil {
+		return nil, err
+	}
+	p.isCrossSubscription = p.subsID != "" && p.subsID != d.cloud.SubscriptionID
+	p.isAzureStackCloud = IsAzureStackCloud(d.cloud)
+	p.hasSecrets = len(userSecrets) > 0
+	p.hasContentSource = req.GetVolumeContentSource() != nil
+	if err := validateCreateVolumeParameters(p); err != nil {
+		return nil, err
+	}
 
-	// Apply ProvisionerParameters (case-insensitive). We leave validation of
-	// the values to the cloud provider.
-	for k, v := range parameters {
-		switch strings.ToLower(k) {
-		case skuNameField:
-			storageAccountType = v
-		case storageAccountTypeField:
-			storageAccountType = v
-		case locationField:
-			location = v
-		case storageAccountField:
-			account = v
-		case subscriptionIDField:
-			subsID = v
-		case resourceGroupField:
-			resourceGroup = v
-		case containerNameField:
-			containerName = v
-		case containerNamePrefixField:
-			containerNamePrefix = v
-		case protocolField:
-			protocol = v
-		case tagsField:
-			customTags = v
-		case matchTagsField:
-			matchTags = strings.EqualFold(v, trueValue)
-		case secretNameField:
-			secretName = v
-		case secretNamespaceField:
-			secretNamespace = v
-		case isHnsEnabledField:
-			if strings.EqualFold(v, trueValue) {
-				isHnsEnabled = pointer.Bool(true)
-			}
-		case softDeleteBlobsField:
-			days, err := parseDays(v)
-			if err != nil {
-				return nil, err
-			}
-			softDeleteBlobs = days
-		case softDeleteContainersField:
-			days, err := parseDays(v)
-			if err != nil {
-				return nil, err
-			}
-			softDeleteContainers = days
-		case enableBlobVersioningField:
-			enableBlobVersioning = pointer.Bool(strings.EqualFold(v, trueValue))
-		case storeAccountKeyField:
-			if strings.EqualFold(v, falseValue) {
-				storeAccountKey = false
-			}
-		case getLatestAccountKeyField:
-			if getLatestAccountKey, err = strconv.ParseBool(v); err != nil {
-				return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s in volume context", getLatestAccountKeyField, v)
-			}
-		case allowBlobPublicAccessField:
-			if strings.EqualFold(v, trueValue) {
-				allowBlobPublicAccess = pointer.Bool(true)
-			}
-		case requireInfraEncryptionField:
-			if strings.EqualFold(v, trueValue) {
-				requireInfraEncryption = pointer.Bool(true)
-			}
-		case pvcNamespaceKey:
-			pvcNamespace = v
-			containerNameReplaceMap[pvcNamespaceMetadata] = v
-		case pvcNameKey:
-			containerNameReplaceMap[pvcNameMetadata] = v
-		case pvNameKey:
-			containerNameReplaceMap[pvNameMetadata] = v
-		case serverNameField:
-		case storageAuthTypeField:
-		case storageIentityClientIDField:
-		case storageIdentityObjectIDField:
-		case storageIdentityResourceIDField:
-		case msiEndpointField:
-		case storageAADEndpointField:
-			// no op, only used in NodeStageVolume
-		case storageEndpointSuffixField:
-			storageEndpointSuffix = v
-		case vnetResourceGroupField:
-			vnetResourceGroup = v
-		case vnetNameField:
-			vnetName = v
-		case subnetNameField:
-			subnetName = v
-		case accessTierField:
-			accessTier = v
-		case networkEndpointTypeField:
-			networkEndpointType = v
-		case EcStrgAuthenticationField:
-			containerNameReplaceMap[EcStrgAuthenticationField] = v
-		case mountPermissionsField:
-			// only do validations here, used in NodeStageVolume, NodePublishVolume
-			if v != "" {
-				if _, err := strconv.ParseUint(v, 8, 32); err != nil {
-					return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("invalid mountPermissions %s in storage class", v))
-				}
-			}
-		case useDataPlaneAPIField:
-			useDataPlaneAPI = strings.EqualFold(v, trueValue)
-		default:
-			return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("invalid parameter %q in storage class", k))
+	var createPrivateEndpoint, enableNfsV3 *bool
+	var vnetResourceIDs []string
+	var keyVault *keyVaultSecret
+	if p.keyVaultURL != "" {
+		keyVault = &keyVaultSecret{vaultURL: p.keyVaultURL, secretName: p.keyVaultSecretName, secretVersion: p.keyVaultSecretVersion}
+	}
+	// volume options which DeleteVolume needs are recorded as volume id flags
+	var volumeIDFlags []string
+	if p.useDataPlaneAPI {
+		volumeIDFlags = append(volumeIDFlags, volumeIDDataPlaneAPI)
+	}
+	if p.getLatestAccountKey {
+		volumeIDFlags = append(volumeIDFlags, volumeIDLatestAccountKey)
+	}
+	if p.immutabilityPeriodDays != nil {
+		volumeIDFlags = append(volumeIDFlags, volumeIDImmutable)
+	}
+	if p.enableBlobInventory {
+		volumeIDFlags = append(volumeIDFlags, volumeIDBlobInventory)
+	}
+	if p.lifecyclePolicy != nil {
+		volumeIDFlags = append(volumeIDFlags, volumeIDLifecycle)
+	}
+	if d.perVolumeSecretName {
+		volumeIDFlags = append(volumeIDFlags, volumeIDPerVolumeSecret)
+	}
+	if p.deletePolicy == "" {
+		p.deletePolicy = deletePolicyDelete
+		if p.skipContainerCreation {
+			// container is not created by driver, keep it when volume is deleted
+			p.deletePolicy = deletePolicyRetain
 		}
 	}
 
-	if pointer.BoolDeref(enableBlobVersioning, false) {
-		if protocol == NFS || pointer.BoolDeref(isHnsEnabled, false) {
-			return nil, status.Errorf(codes.InvalidArgument, "enableBlobVersioning is not supported for NFS protocol or HNS enabled account")
+	if p.setSecretOwnerReference && p.pvcName != "" && p.pvcNamespace != "" {
+		// check before anything is created since the PV inherits reclaim policy from the storage class
+		if err := d.checkSecretOwnerReclaimPolicy(ctx, p.pvcNamespace, p.pvcName); err != nil {
+			return nil, err
 		}
 	}
 
-	if matchTags && account != "" {
-		return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("matchTags must set as false when storageAccount(%s) is provided", account))
+	var workloadIdentityCredential azcore.TokenCredential
+	if p.clientID != "" {
+		if workloadIdentityCredential, err = d.getWorkloadIdentityCredential(p.clientID, p.tenantID); err != nil {
+			return nil, status.Errorf(codes.FailedPrecondition, "failed to get workload identity credential of clientID(%s), error: %v", p.clientID, err)
+		}
+		// container is created with workload identity, account key is neither fetched nor stored
+		p.storeAccountKey = false
 	}
 
-	if subsID != "" && subsID != d.cloud.SubscriptionID {
-		if protocol == NFS {
-			return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("NFS protocol is not supported in cross subscription(%s)", subsID))
+	inventorySchedule := storage.ScheduleDaily
+	inventoryFormat := storage.FormatCsv
+	if p.enableBlobInventory {
+		if p.blobInventorySchedule != "" {
+			if inventorySchedule, err = getBlobInventorySchedule(p.blobInventorySchedule); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, err.Error())
+			}
 		}
-		if !storeAccountKey {
-			return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("storeAccountKey must set as true in cross subscription(%s)", subsID))
+		if p.blobInventoryFormat != "" {
+			if inventoryFormat, err = getBlobInventoryFormat(p.blobInventoryFormat); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, err.Error())
+			}
 		}
 	}
 
-	if resourceGroup == "" {
-		resourceGroup = d.cloud.ResourceGroup
+	if p.resourceGroup == "" {
+		p.resourceGroup = d.cloud.ResourceGroup
 	}
 
-	if secretNamespace == "" {
-		if pvcNamespace == "" {
-			secretNamespace = defaultNamespace
+	if p.secretNamespace == "" {
+		if p.pvcNamespace == "" {
+			p.secretNamespace = defaultNamespace
 		} else {
-			secretNamespace = pvcNamespace
+			p.secretNamespace = p.pvcNamespace
 		}
 	}
 
-	if protocol == "" {
-		protocol = Fuse
+	if p.protocol == "" {
+		p.protocol = Fuse
+	}
+	if !isSupportedProtocol(p.protocol) {
+		return nil, status.Errorf(codes.InvalidArgument, "protocol(%s) is not supported, supported protocol list: %v", p.protocol, supportedProtocolList)
 	}
-	if !isSupportedProtocol(protocol) {
-		return nil, status.Errorf(codes.InvalidArgument, "protocol(%s) is not supported, supported protocol list: %v", protocol, supportedProtocolList)
+	if !isSupportedAccessTier(p.accessTier) {
+		return nil, status.Errorf(codes.InvalidArgument, "accessTier(%s) is not supported, supported AccessTier list: %v", p.accessTier, storage.PossibleAccessTierValues())
 	}
-	if !isSupportedAccessTier(accessTier) {
-		return nil, status.Errorf(codes.InvalidArgument, "accessTier(%s) is not supported, supported AccessTier list: %v", accessTier, storage.PossibleAccessTierValues())
+	if !isSupportedAccessTier(p.containerAccessTier) {
+		return nil, status.Errorf(codes.InvalidArgument, "containerAccessTier(%s) is not supported, supported AccessTier list: %v", p.containerAccessTier, storage.PossibleAccessTierValues())
 	}
 
-	if containerName != "" && containerNamePrefix != "" {
-		return nil, status.Errorf(codes.InvalidArgument, "containerName(%s) and containerNamePrefix(%s) could not be specified together", containerName, containerNamePrefix)
+	if isReservedContainerName(p.containerName) && !p.allowReservedContainerNames {
+		return nil, status.Errorf(codes.InvalidArgument, "containerName(%s) is reserved by Azure for special purposes, set allowReservedContainerNames as true if it's intended, reserved container names: %v", p.containerName, reservedContainerNames)
 	}
-	if !isSupportedContainerNamePrefix(containerNamePrefix) {
-		return nil, status.Errorf(codes.InvalidArgument, "containerNamePrefix(%s) can only contain lowercase letters, numbers, hyphens, and length should be less than 21", containerNamePrefix)
+	if !isSupportedContainerNamePrefix(p.containerNamePrefix) {
+		return nil, status.Errorf(codes.InvalidArgument, "containerNamePrefix(%s) can only contain lowercase letters, numbers, hyphens, and length should be less than 21", p.containerNamePrefix)
 	}
-	if protocol == EcProtocol {
-		// TODO: call out to edgecache to validate sku
-		klog.V(2).Info("ecprotocol specified, validating storage SKU")
+	if p.protocol == EcProtocol {
+		klog.V(2).InfoS("ecprotocol specified, validating storage SKU", volumeLogFields("CreateVolume", "", p.account, p.containerName, "volumeName", volName, "skuName", p.storageAccountType)...)
+		if err := d.validateEdgeCacheSku(p.storageAccountType, p.containerNameReplaceMap[EcStrgAuthenticationField]); err != nil {
+			return nil, err
+		}
 	}
 
 	enableHTTPSTrafficOnly := true
-	if strings.EqualFold(networkEndpointType, privateEndpoint) {
+	if strings.EqualFold(p.networkEndpointType, privateEndpoint) {
 		createPrivateEndpoint = pointer.BoolPtr(true)
 	}
-	accountKind := string(storage.KindStorageV2)
-	if protocol == NFS {
-		isHnsEnabled = pointer.Bool(true)
+	accountKind := getAccountKind(p.storageAccountType, IsAzureStackCloud(d.cloud))
+	if p.protocol == NFS {
+		p.isHnsEnabled = pointer.Bool(true)
 		enableNfsV3 = pointer.Bool(true)
 		// NFS protocol does not need account key
-		storeAccountKey = false
+		p.storeAccountKey = false
+	}
+	vnetSubnets, err := parseVnetSubnets(p.vnetName, p.subnetName)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if len(vnetSubnets) > 1 && pointer.BoolDeref(createPrivateEndpoint, false) {
+		return nil, status.Errorf(codes.InvalidArgument, "multiple subnets(%s) are not supported with private endpoint", p.subnetName)
+	}
+	if p.protocol == NFS || p.exposure == exposureInternal {
+		// storage account firewall denies public network access with private endpoint, vnet rules are only
+		// needed when the account is accessed through service endpoint of the vnet
 		if !pointer.BoolDeref(createPrivateEndpoint, false) {
 			// set VirtualNetworkResourceIDs for storage account firewall setting
-			vnetResourceID := d.getSubnetResourceID(vnetResourceGroup, vnetName, subnetName)
-			klog.V(2).Infof("set vnetResourceID(%s) for NFS protocol", vnetResourceID)
-			vnetResourceIDs = []string{vnetResourceID}
-			if err := d.updateSubnetServiceEndpoints(ctx, vnetResourceGroup, vnetName, subnetName); err != nil {
-				return nil, status.Errorf(codes.Internal, "update service endpoints failed with error: %v", err)
+			for _, s := range vnetSubnets {
+				vnetResourceID := d.getSubnetResourceID(p.vnetResourceGroup, s.vnetName, s.subnetName)
+				if util.ContainsString(vnetResourceIDs, strings.ToLower(vnetResourceID), strings.ToLower) {
+					continue
+				}
+				klog.V(2).InfoS("set vnetResourceID", volumeLogFields("CreateVolume", "", p.account, p.containerName, "volumeName", volName, "vnetResourceID", vnetResourceID, "protocol", p.protocol, "exposure", p.exposure)...)
+				vnetResourceIDs = append(vnetResourceIDs, vnetResourceID)
+				if p.dryRun {
+					klog.V(2).InfoS("dry run: skip updating service endpoints of subnet", volumeLogFields("CreateVolume", "", p.account, p.containerName, "volumeName", volName, "subnet", s.subnetName, "vnet", s.vnetName)...)
+				} else if err := d.updateSubnetServiceEndpoints(ctx, p.vnetResourceGroup, s.vnetName, s.subnetName); err != nil {
+					return nil, status.Errorf(codes.Internal, "update service endpoints failed with error: %v", err)
+				}
 			}
 		}
 	}
 
-	if strings.HasPrefix(strings.ToLower(storageAccountType), "premium") {
-		accountKind = string(storage.KindBlockBlobStorage)
+	if maxSize := getContainerMaxSize(accountKind); volSizeBytes > maxSize {
+		return nil, status.Errorf(codes.OutOfRange, "required bytes (%d) exceeds the maximum supported bytes (%d) of account kind(%s)", volSizeBytes, maxSize, accountKind)
 	}
-	if IsAzureStackCloud(d.cloud) {
-		accountKind = string(storage.KindStorage)
-		if storageAccountType != "" && storageAccountType != string(storage.SkuNameStandardLRS) && storageAccountType != string(storage.SkuNamePremiumLRS) {
-			return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("Invalid skuName value: %s, as Azure Stack only supports %s and %s Storage Account types.", storageAccountType, storage.SkuNamePremiumLRS, storage.SkuNameStandardLRS))
+
+	if p.enableLargeBlockBlob {
+		// ARM does not expose a dedicated large block blob property, large blocks are supported by
+		// block blob capable account kinds, so only validate the account kind here and pass the
+		// setting to node server via VolumeContext for mount tuning
+		if accountKind != string(storage.KindStorageV2) && accountKind != string(storage.KindBlockBlobStorage) {
+			return nil, status.Errorf(codes.InvalidArgument, "enableLargeBlockBlob is only supported for %s or %s account kind, current account kind: %s", storage.KindStorageV2, storage.KindBlockBlobStorage, accountKind)
 		}
+		setKeyValueInMap(parameters, enableLargeBlockBlobField, trueValue)
 	}
 
-	tags, err := util.ConvertTagsToMap(customTags)
+	tags, err := util.ConvertTagsToMap(p.customTags)
 	if err != nil {
 		return nil, status.Errorf(codes.InvalidArgument, err.Error())
 	}
+	if d.clusterName != "" {
+		if err := setTagIfNotExists(tags, clusterNameTagKey, d.clusterName); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "failed to set cluster name tag: %v", err)
+		}
+	}
+	// container tags are set as container metadata, unlike tags which are applied to storage account
+	containerMetadata, err := getContainerMetadataFromTags(p.containerTags)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %v", containerTagsField, err)
+	}
+	if p.requester != "" {
+		if p.requester, err = getValidRequester(p.requester); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %v", requesterField, err)
+		}
+		if err := setTagIfNotExists(tags, requesterTagKey, p.requester); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "failed to set requester tag: %v", err)
+		}
+		containerMetadata[requesterMetadataKey] = p.requester
+	}
+	if p.storeMetadata {
+		// record pvc/pv of the volume so that container could be traced back to kubernetes objects
+		for k, v := range map[string]string{pvcNameMetadataKey: p.pvcName, pvcNamespaceMetadataKey: p.pvcNamespace, pvNameMetadataKey: p.pvName} {
+			if v != "" {
+				containerMetadata[k] = v
+			}
+		}
+	}
 
-	if strings.TrimSpace(storageEndpointSuffix) == "" {
-		if d.cloud.Environment.StorageEndpointSuffix != "" {
-			storageEndpointSuffix = d.cloud.Environment.StorageEndpointSuffix
+	// replace pv/pvc name namespace metadata in subDir
+	p.containerName = replaceWithMap(p.containerName, p.containerNameReplaceMap)
+	if p.containerName != "" {
+		// container name specified by user is passed to Azure as is, fail early instead of after account creation
+		if err := validateContainerName(p.containerName, pointer.BoolDeref(p.isHnsEnabled, false), p.allowReservedContainerNames); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+	}
+	validContainerName := p.containerName
+	if validContainerName == "" {
+		if p.containerNameTemplate != "" {
+			if validContainerName, err = getContainerNameFromTemplate(p.containerNameTemplate, volName, p.protocol, p.containerNameReplaceMap); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+			}
 		} else {
-			storageEndpointSuffix = defaultStorageEndPointSuffix
+			validContainerName = volName
+			if p.containerNamePrefix != "" {
+				validContainerName = p.containerNamePrefix + "-" + volName
+			}
+			validContainerName = getValidContainerName(validContainerName, p.protocol)
+		}
+		setKeyValueInMap(parameters, containerNameField, validContainerName)
+	}
+
+	if p.enableBlobInventory {
+		if p.blobInventoryDestination == validContainerName {
+			return nil, status.Errorf(codes.InvalidArgument, "%s(%s) could not be the same as the provisioned container", blobInventoryDestField, p.blobInventoryDestination)
 		}
+		// record the rule in container metadata so that the rule could be cleaned up in DeleteVolume
+		containerMetadata[blobInventoryRuleMetadataKey] = getBlobInventoryRuleName(validContainerName)
+	}
+	if p.lifecyclePolicy != nil {
+		// record the rule in container metadata so that the rule could be cleaned up in DeleteVolume
+		containerMetadata[lifecycleRuleMetadataKey] = getLifecycleRuleName(p.lifecyclePolicy)
+	}
+
+	if strings.TrimSpace(p.storageEndpointSuffix) == "" {
+		p.storageEndpointSuffix = d.getStorageEndpointSuffix()
+	}
+	// storage endpoint suffix is recorded in volume id only when it's not the cloud default,
+	// so that volume id of the default endpoint stays unchanged
+	var volumeStorageEndpointSuffix string
+	if !strings.EqualFold(p.storageEndpointSuffix, d.getStorageEndpointSuffix()) {
+		volumeStorageEndpointSuffix = p.storageEndpointSuffix
+	}
+
+	if d.enableTopology && p.location == "" {
+		// pick or create storage account in the region of preferred topology so that the volume is close to the workload
+		p.location = getTopologyRegion(req.GetAccessibilityRequirements())
 	}
 
+	settings := p.accountSettings()
+
 	accountOptions := &azure.AccountOptions{
-		Name:                            account,
-		Type:                            storageAccountType,
+		Name:                            p.account,
+		Type:                            p.storageAccountType,
 		Kind:                            accountKind,
-		SubscriptionID:                  subsID,
-		ResourceGroup:                   resourceGroup,
-		Location:                        location,
+		SubscriptionID:                  p.subsID,
+		ResourceGroup:                   p.resourceGroup,
+		Location:                        p.location,
 		EnableHTTPSTrafficOnly:          enableHTTPSTrafficOnly,
 		VirtualNetworkResourceIDs:       vnetResourceIDs,
 		Tags:                            tags,
-		MatchTags:                       matchTags,
-		IsHnsEnabled:                    isHnsEnabled,
+		MatchTags:                       p.matchTags,
+		IsHnsEnabled:                    p.isHnsEnabled,
 		EnableNfsV3:                     enableNfsV3,
-		AllowBlobPublicAccess:           allowBlobPublicAccess,
-		RequireInfrastructureEncryption: requireInfraEncryption,
-		VNetResourceGroup:               vnetResourceGroup,
-		VNetName:                        vnetName,
-		SubnetName:                      subnetName,
-		AccessTier:                      accessTier,
+		AllowBlobPublicAccess:           p.allowBlobPublicAccess,
+		RequireInfrastructureEncryption: p.requireInfraEncryption,
+		AllowSharedKeyAccess:            p.allowSharedKeyAccess,
+		VNetResourceGroup:               p.vnetResourceGroup,
+		VNetName:                        p.vnetName,
+		SubnetName:                      p.subnetName,
+		AccessTier:                      p.accessTier,
 		CreatePrivateEndpoint:           createPrivateEndpoint,
 		StorageType:                     provider.StorageTypeBlob,
-		StorageEndpointSuffix:           storageEndpointSuffix,
-		EnableBlobVersioning:            enableBlobVersioning,
-		SoftDeleteBlobs:                 softDeleteBlobs,
-		SoftDeleteContainers:            softDeleteContainers,
-		GetLatestAccountKey:             getLatestAccountKey,
+		StorageEndpointSuffix:           p.storageEndpointSuffix,
+		EnableBlobVersioning:            p.enableBlobVersioning,
+		SoftDeleteBlobs:                 pointer.Int32Deref(p.softDeleteBlobs, 0),
+		SoftDeleteContainers:            pointer.Int32Deref(p.softDeleteContainers, 0),
+		GetLatestAccountKey:             p.getLatestAccountKey,
 	}
 
 	var volumeID string
@@ -350,450 +472,4555 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 		mc.ObserveOperationWithResult(isOperationSucceeded, VolumeID, volumeID)
 	}()
 
-	var accountKey string
-	accountName := account
-	secrets := req.GetSecrets()
+	var accountKey, lockKey string
+	accountName := p.account
+	secrets := userSecrets
 	if len(secrets) == 0 && accountName == "" {
+		// accounts with different settings are never shared
+		lockKey = fmt.Sprintf("%s%s%s%s%s%v%v%s", p.storageAccountType, accountKind, p.resourceGroup, p.location, p.protocol, pointer.BoolDeref(createPrivateEndpoint, false), pointer.BoolDeref(p.allowSharedKeyAccess, true), settings.key())
 		if v, ok := d.volMap.Load(volName); ok {
 			accountName = v.(string)
 		} else {
-			lockKey := fmt.Sprintf("%s%s%s%s%s%v", storageAccountType, accountKind, resourceGroup, location, protocol, pointer.BoolDeref(createPrivateEndpoint, false))
-			// search in cache first
-			cache, err := d.accountSearchCache.Get(lockKey, azcache.CacheReadTypeDefault)
-			if err != nil {
+			// search in cache first, account search cache is not populated in dry run
+			var cache interface{}
+			if p.dryRun {
+				if cachedAccount := d.getCachedAccount(lockKey); cachedAccount != "" {
+					cache = cachedAccount
+				}
+			} else if cache, err = d.accountSearchCache.Get(lockKey, azcache.CacheReadTypeDefault); err != nil {
 				return nil, status.Errorf(codes.Internal, err.Error())
 			}
 			if cache != nil {
 				accountName = cache.(string)
+			} else if p.dryRun {
+				klog.V(2).InfoS("dry run: no matching storage account in cache, a storage account would be picked or created by EnsureStorageAccount", volumeLogFields("CreateVolume", "", "", validContainerName, "volumeName", volName)...)
 			} else {
-				d.volLockMap.LockEntry(lockKey)
-				err = wait.ExponentialBackoff(d.cloud.RequestBackoff(), func() (bool, error) {
-					var retErr error
-					accountName, accountKey, retErr = d.cloud.EnsureStorageAccount(ctx, accountOptions, protocol)
-					if isRetriableError(retErr) {
-						klog.Warningf("EnsureStorageAccount(%s) failed with error(%v), waiting for retrying", account, retErr)
-						return false, nil
-					}
-					return true, retErr
-				})
-				d.volLockMap.UnlockEntry(lockKey)
-				if err != nil {
-					return nil, status.Errorf(codes.Internal, "ensure storage account failed with %v", err)
+				if accountName, accountKey, err = d.ensureStorageAccount(ctx, accountOptions, p.protocol, lockKey, settings); err != nil {
+					return nil, azureErrorStatus(err, "ensure storage account failed with %v", err)
 				}
-				d.accountSearchCache.Set(lockKey, accountName)
 				d.volMap.Store(volName, accountName)
 			}
 		}
 	}
 
-	if pointer.BoolDeref(createPrivateEndpoint, false) && protocol == NFS {
-		// As for blobfuse/blobfuse2, serverName, i.e.,AZURE_STORAGE_BLOB_ENDPOINT env variable can't include
-		// "privatelink", issue: https://github.com/Azure/azure-storage-fuse/issues/1014
-		//
-		// And use public endpoint will be befine to blobfuse/blobfuse2, because it will be resolved to private endpoint
-		// by private dns zone, which includes CNAME record, documented here:
-		// https://learn.microsoft.com/en-us/azure/storage/common/storage-private-endpoints?toc=%2Fazure%2Fstorage%2Fblobs%2Ftoc.json&bc=%2Fazure%2Fstorage%2Fblobs%2Fbreadcrumb%2Ftoc.json#dns-changes-for-private-endpoints
-		setKeyValueInMap(parameters, serverNameField, fmt.Sprintf("%s.privatelink.blob.%s", accountName, storageEndpointSuffix))
+	if pointer.BoolDeref(createPrivateEndpoint, false) {
+		setPrivateEndpointServerName(parameters, p.protocol, p.serverName, accountName, p.storageEndpointSuffix)
 	}
 
 	accountOptions.Name = accountName
-	if len(secrets) == 0 && useDataPlaneAPI {
+	// properties of the existing account fetched in sku check, reused to get location of the account
+	var existingAccount *storage.Account
+	if p.account != "" && len(secrets) == 0 && p.storageAccountType != "" && p.onSkuMismatch != skuMismatchIgnore {
+		// EnsureStorageAccount is skipped when storage account is specified, check sku of the existing account
+		if existingAccount, err = d.checkAccountSku(ctx, p.subsID, p.resourceGroup, accountName, p.storageAccountType, p.onSkuMismatch); err != nil {
+			return nil, err
+		}
+	}
+	if p.dryRun {
+		// stop before any change is made on storage account or container, volume is not recorded either
+		volumeID = d.formatVolumeID(getCreateVolumeID(p.resourceGroup, accountName, validContainerName, p.containerName, volName, p.secretNamespace, p.subsID, p.deletePolicy, volumeStorageEndpointSuffix, p.protocol, volumeIDFlags...))
+		setKeyValueInMap(parameters, secretNamespaceField, p.secretNamespace)
+		klog.V(2).InfoS("dry run: container would be created", volumeLogFields("CreateVolume", volumeID, accountName, validContainerName, "volumeName", volName, "resourceGroup", p.resourceGroup, "volumeContext", parameters)...)
+		// a successful response would make CO bind a volume which does not exist, return the planned result as error instead
+		return nil, dryRunStatus(fmt.Sprintf("dry run: volume(%s) would be created in container(%s) on account(%s) rg(%s) with volumeID(%s) capacity(%d) volumeContext(%s), remove %s parameter to create the volume",
+			volName, validContainerName, accountName, p.resourceGroup, volumeID, capacityBytes, formatVolumeContext(parameters), dryRunField), parameters)
+	}
+	if keyVault != nil {
+		// account key is read from key vault instead of k8s secret or listKeys API
+		if _, accountKey, err = d.GetStorageAccesskey(ctx, accountOptions, secrets, p.secretName, p.secretNamespace, keyVault); err != nil {
+			return nil, err
+		}
+	}
+	if p.account != "" && len(secrets) == 0 && pointer.BoolDeref(p.enableBlobVersioning, false) {
+		// EnsureStorageAccount is skipped when storage account is specified, make sure blob versioning is enabled on the existing account
+		if err := d.ensureBlobVersioning(ctx, p.subsID, p.resourceGroup, accountName); err != nil {
+			return nil, err
+		}
+	}
+	if len(secrets) == 0 && p.useDataPlaneAPI {
 		if accountKey == "" {
-			if accountName, accountKey, err = d.GetStorageAccesskey(ctx, accountOptions, secrets, secretName, secretNamespace); err != nil {
+			if accountName, accountKey, err = d.GetStorageAccesskey(ctx, accountOptions, secrets, p.secretName, p.secretNamespace, keyVault); err != nil {
 				return nil, status.Errorf(codes.Internal, "failed to GetStorageAccesskey on account(%s) rg(%s), error: %v", accountOptions.Name, accountOptions.ResourceGroup, err)
 			}
 		}
 		secrets = createStorageAccountSecret(accountName, accountKey)
 	}
 
-	// replace pv/pvc name namespace metadata in subDir
-	containerName = replaceWithMap(containerName, containerNameReplaceMap)
-	validContainerName := containerName
-	if validContainerName == "" {
-		validContainerName = volName
-		if containerNamePrefix != "" {
-			validContainerName = containerNamePrefix + "-" + volName
+	if volSizeBytes > 0 && d.enableListVolumes {
+		// record provisioned capacity in container metadata so that it could be reported in ListVolumes
+		containerMetadata[capacityMetadataKey] = strconv.FormatInt(capacityBytes, 10)
+	}
+
+	if p.containerAccessTier != "" {
+		// container does not have access tier property, record it in container metadata
+		// so that lifecycle or cost policies could apply different tiers per volume
+		containerMetadata[accessTierMetadataKey] = p.containerAccessTier
+	}
+
+	if workloadIdentityCredential == nil {
+		// createdVolumes is lost on controller restart, compare with the request recorded in the existing container instead
+		if err := d.checkContainerCreateRequest(ctx, p.subsID, p.resourceGroup, accountName, validContainerName, p.storageEndpointSuffix, secrets, volName, requestHash); err != nil {
+			return nil, err
 		}
-		validContainerName = getValidContainerName(validContainerName, protocol)
-		setKeyValueInMap(parameters, containerNameField, validContainerName)
 	}
 
 	if req.GetVolumeContentSource() != nil {
-		if accountKey == "" {
-			if _, accountKey, err = d.GetStorageAccesskey(ctx, accountOptions, secrets, secretName, secretNamespace); err != nil {
+		// account key is not needed if sas urls are supplied in secrets or user delegation sas is used
+		if accountKey == "" && cloneSasURLs == nil && !p.useUserDelegationSAS {
+			if p.useExternalSecret {
+				return nil, status.Errorf(codes.InvalidArgument, "account key is not fetched when storeAccountKey is false and secretName(%s) is provided, set useUserDelegationSAS or supply %s, or %s and %s in secrets for volume cloning", p.secretName, cloneSasTokenField, sourceSasURLField, destinationSasURLField)
+			}
+			if _, accountKey, err = d.GetStorageAccesskey(ctx, accountOptions, secrets, p.secretName, p.secretNamespace, keyVault); err != nil {
 				return nil, status.Errorf(codes.Internal, "failed to GetStorageAccesskey on account(%s) rg(%s), error: %v", accountOptions.Name, accountOptions.ResourceGroup, err)
 			}
 		}
-		if err := d.copyVolume(ctx, req, accountKey, validContainerName, storageEndpointSuffix); err != nil {
+		if err := d.copyVolume(ctx, req, accountName, accountKey, validContainerName, p.storageEndpointSuffix, p.useUserDelegationSAS, p.azcopyRetryCount, p.azcopyCopyTimeout, p.azcopyPreservePermissions); err != nil {
 			return nil, err
 		}
+	} else if p.skipContainerCreation {
+		// container is created in advance by user, only make sure it exists
+		klog.V(2).InfoS("check existence of container since "+createContainerField+" is false", volumeLogFields("CreateVolume", "", accountName, validContainerName, "volumeName", volName, "resourceGroup", p.resourceGroup)...)
+		exist, err := d.containerExists(ctx, p.subsID, p.resourceGroup, accountName, validContainerName, p.storageEndpointSuffix, secrets)
+		if err != nil {
+			return nil, azureErrorStatus(err, "failed to check existence of container(%s) on account(%s) rg(%s), error: %v", validContainerName, accountName, p.resourceGroup, err)
+		}
+		if !exist {
+			return nil, status.Errorf(codes.NotFound, "container(%s) does not exist on account(%s) rg(%s), it should be created in advance when %s is false", validContainerName, accountName, p.resourceGroup, createContainerField)
+		}
 	} else {
-		klog.V(2).Infof("begin to create container(%s) on account(%s) type(%s) subsID(%s) rg(%s) location(%s) size(%d)", validContainerName, accountName, storageAccountType, subsID, resourceGroup, location, requestGiB)
+		klog.V(2).InfoS("begin to create container", volumeLogFields("CreateVolume", "", accountName, validContainerName, "volumeName", volName, "accountType", p.storageAccountType, "subsID", p.subsID, "resourceGroup", p.resourceGroup, "location", p.location, "sizeGiB", requestGiB)...)
 		csicommon.SendKubeEvent(v1.EventTypeNormal, csicommon.CreatingBlobContainer, csicommon.CSIEventSourceStr,
 			fmt.Sprintf("Controller CreateVolume: Creating blob container %s in %q storage account", validContainerName, accountName))
 
-		if err := d.CreateBlobContainer(ctx, subsID, resourceGroup, accountName, validContainerName, secrets); err != nil {
-			return nil, status.Errorf(codes.Internal, "failed to create container(%s) on account(%s) type(%s) rg(%s) location(%s) size(%d), error: %v", validContainerName, accountName, storageAccountType, resourceGroup, location, requestGiB, err)
+		containerMetadata[createRequestMetadataKey] = requestHash
+		var err error
+		if workloadIdentityCredential != nil {
+			err = createContainerWithTokenCredential(ctx, workloadIdentityCredential, accountName, p.storageEndpointSuffix, validContainerName, containerMetadata, string(p.containerPublicAccess), p.defaultEncryptionScope)
+		} else {
+			err = d.CreateBlobContainer(ctx, p.subsID, p.resourceGroup, accountName, validContainerName, p.storageEndpointSuffix, secrets, containerMetadata, string(p.containerPublicAccess), p.defaultEncryptionScope, p.restoreDeletedContainer)
+		}
+		// fall back to a new storage account if the account picked by driver reaches its container limit
+		for i := 0; isAccountFullError(err) && lockKey != "" && i < d.maxAccountFallbacks; i++ {
+			klog.Warningf("storage account(%s) is full, error: %v, creating a new storage account(%d/%d)", accountName, err, i+1, d.maxAccountFallbacks)
+			// evict the full account so that it would not be picked by other volumes
+			if err := d.accountSearchCache.Delete(lockKey); err != nil {
+				klog.Warningf("failed to delete account search cache(%s): %v", lockKey, err)
+			}
+			d.volMap.Delete(volName)
+			accountOptions.Name = ""
+			accountOptions.CreateAccount = true
+			if accountName, accountKey, err = d.ensureStorageAccount(ctx, accountOptions, p.protocol, lockKey, settings); err != nil {
+				return nil, azureErrorStatus(err, "ensure storage account failed with %v", err)
+			}
+			d.volMap.Store(volName, accountName)
+			accountOptions.Name = accountName
+			if pointer.BoolDeref(createPrivateEndpoint, false) {
+				setPrivateEndpointServerName(parameters, p.protocol, p.serverName, accountName, p.storageEndpointSuffix)
+			}
+			if p.useDataPlaneAPI {
+				secrets = createStorageAccountSecret(accountName, accountKey)
+			}
+			err = d.CreateBlobContainer(ctx, p.subsID, p.resourceGroup, accountName, validContainerName, p.storageEndpointSuffix, secrets, containerMetadata, string(p.containerPublicAccess), p.defaultEncryptionScope, p.restoreDeletedContainer)
+		}
+		if err != nil && p.defaultEncryptionScope != "" {
+			return nil, azureErrorStatus(err, "failed to create container(%s) with defaultEncryptionScope(%s) on account(%s) rg(%s), make sure the encryption scope exists and is enabled on the account, error: %v", validContainerName, p.defaultEncryptionScope, accountName, p.resourceGroup, err)
+		}
+		if err != nil {
+			return nil, azureErrorStatus(err, "failed to create container(%s) on account(%s) type(%s) rg(%s) location(%s) size(%d), error: %v", validContainerName, accountName, p.storageAccountType, p.resourceGroup, p.location, requestGiB, err)
+		}
+
+		// NFS mount is sensitive to the container not being visible right after creation,
+		// so wait for container readiness by default for NFS protocol
+		if pointer.BoolDeref(p.waitForContainerReady, p.protocol == NFS) {
+			if err := d.waitForContainerReady(ctx, p.subsID, p.resourceGroup, accountName, validContainerName, p.storageEndpointSuffix, secrets, p.containerReadyTimeout); err != nil {
+				return nil, status.Errorf(codes.Internal, "container(%s) on account(%s) is not ready after %v, error: %v", validContainerName, accountName, p.containerReadyTimeout, err)
+			}
+		}
+	}
+
+	if p.enableBlobInventory {
+		klog.V(2).InfoS("set blob inventory rule for container", volumeLogFields("CreateVolume", "", accountName, validContainerName, "volumeName", volName, "resourceGroup", p.resourceGroup, "destination", p.blobInventoryDestination)...)
+		if err := d.setBlobInventoryRule(ctx, p.subsID, p.resourceGroup, accountName, validContainerName, p.blobInventoryDestination, inventorySchedule, inventoryFormat); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to set blob inventory rule for container(%s) on account(%s) rg(%s), error: %v", validContainerName, accountName, p.resourceGroup, err)
+		}
+	}
+	if p.lifecyclePolicy != nil {
+		klog.V(2).InfoS("set lifecycle rule for container", volumeLogFields("CreateVolume", "", accountName, validContainerName, "volumeName", volName, "resourceGroup", p.resourceGroup)...)
+		if err := d.setLifecycleRule(ctx, p.subsID, p.resourceGroup, accountName, validContainerName, p.lifecyclePolicy); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to set lifecycle rule for container(%s) on account(%s) rg(%s), error: %v", validContainerName, accountName, p.resourceGroup, err)
+		}
+	}
+	if p.immutabilityPeriodDays != nil {
+		klog.V(2).InfoS("set immutability policy for container", volumeLogFields("CreateVolume", "", accountName, validContainerName, "volumeName", volName, "resourceGroup", p.resourceGroup, "immutabilityPeriodDays", *p.immutabilityPeriodDays)...)
+		if err := d.setContainerImmutabilityPolicy(ctx, p.subsID, p.resourceGroup, accountName, validContainerName, *p.immutabilityPeriodDays); err != nil {
+			if !p.skipContainerCreation {
+				// the policy is unlocked if it's ever set, so the container created above could be cleaned up to avoid leaking it when CreateVolume is not retried
+				if delErr := d.DeleteBlobContainer(ctx, p.subsID, p.resourceGroup, accountName, validContainerName, p.storageEndpointSuffix, secrets); delErr != nil {
+					klog.Warningf("failed to clean up container(%s) on account(%s) rg(%s) after setting immutability policy failed, error: %v", validContainerName, accountName, p.resourceGroup, delErr)
+				}
+			}
+			return nil, azureErrorStatus(err, "failed to set immutability policy(%d days) for container(%s) on account(%s) rg(%s), error: %v", *p.immutabilityPeriodDays, validContainerName, accountName, p.resourceGroup, err)
 		}
 	}
 
-	if storeAccountKey && len(req.GetSecrets()) == 0 {
+	if p.rootOwner != "" || p.rootGroup != "" {
 		if accountKey == "" {
-			if accountName, accountKey, err = d.GetStorageAccesskey(ctx, accountOptions, secrets, secretName, secretNamespace); err != nil {
+			if _, accountKey, err = d.GetStorageAccesskey(ctx, accountOptions, secrets, p.secretName, p.secretNamespace, keyVault); err != nil {
 				return nil, status.Errorf(codes.Internal, "failed to GetStorageAccesskey on account(%s) rg(%s), error: %v", accountOptions.Name, accountOptions.ResourceGroup, err)
 			}
 		}
-
-		secretName, err := setAzureCredentials(ctx, d.cloud.KubeClient, accountName, accountKey, secretNamespace)
+		sasToken, err := generateSASToken(accountName, accountKey, p.storageEndpointSuffix, d.sasTokenExpirationMinutes)
 		if err != nil {
-			return nil, status.Errorf(codes.Internal, "failed to store storage account key: %v", err)
+			return nil, err
 		}
-		if secretName != "" {
-			klog.V(2).Infof("store account key to k8s secret(%v) in %s namespace", secretName, secretNamespace)
+		dfsEndpoint := fmt.Sprintf("https://%s.dfs.%s", accountName, p.storageEndpointSuffix)
+		klog.V(2).InfoS("set owner and group on root of container", volumeLogFields("CreateVolume", "", accountName, validContainerName, "volumeName", volName, "owner", p.rootOwner, "group", p.rootGroup)...)
+		if err := setContainerRootAccessControl(ctx, dataLakeHTTPClient, dfsEndpoint, validContainerName, sasToken, p.rootOwner, p.rootGroup); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to set owner(%s) group(%s) on container(%s) on account(%s), error: %v", p.rootOwner, p.rootGroup, validContainerName, accountName, err)
 		}
 	}
 
-	var uuid string
-	if containerName != "" {
-		// add volume name as suffix to differentiate volumeID since "containerName" is specified
-		// not necessary for dynamic container name creation since volumeID already contains volume name
-		uuid = volName
-	}
-	volumeID = fmt.Sprintf(volumeIDTemplate, resourceGroup, accountName, validContainerName, uuid, secretNamespace, subsID)
-	klog.V(2).Infof("created container %s on storage account %s successfully", validContainerName, accountName)
+	// account key in key vault is read by node with keyVaultURL in volume context, it's not stored in k8s secret
+	if p.storeAccountKey && len(userSecrets) == 0 && p.keyVaultURL == "" {
+		if accountKey == "" {
+			if accountName, accountKey, err = d.GetStorageAccesskey(ctx, accountOptions, secrets, p.secretName, p.secretNamespace, keyVault); err != nil {
+				return nil, status.Errorf(codes.Internal, "failed to GetStorageAccesskey on account(%s) rg(%s), error: %v", accountOptions.Name, accountOptions.ResourceGroup, err)
+			}
+		}
+
+		storedSecretName, err := setAzureCredentials(ctx, d.cloud.KubeClient, accountName, accountKey, getAccountKeySecretName(accountName, validContainerName, d.perVolumeSecretName), p.secretNamespace, validContainerName)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to store storage account key: %v", err)
+		}
+		if storedSecretName != "" {
+			klog.V(2).InfoS("store account key to k8s secret", volumeLogFields("CreateVolume", "", accountName, validContainerName, "volumeName", volName, "secretName", storedSecretName, "secretNamespace", p.secretNamespace)...)
+			if p.secretName == "" {
+				// return secret reference (not the key) in VolumeContext so that node could use it directly,
+				// secret is stored in secretNamespace which defaults to pvc namespace
+				setKeyValueInMap(parameters, secretNameField, storedSecretName)
+				setKeyValueInMap(parameters, secretNamespaceField, p.secretNamespace)
+			}
+			if p.setSecretOwnerReference {
+				// PV is created by external-provisioner after CreateVolume returns, so PVC which exists in the same namespace
+				// is set as owner, secret shared by other volumes on the account must not be garbage collected with one PVC
+				switch {
+				case !d.perVolumeSecretName:
+					klog.Warningf("skip setting owner reference of secret(%s) since it's shared by volumes on account(%s), set --per-volume-secret-name on driver", storedSecretName, accountName)
+				case p.pvcName == "" || p.pvcNamespace == "":
+					klog.Warningf("skip setting owner reference of secret(%s) since pvc name is not available, set --extra-create-metadata on csi-provisioner", storedSecretName)
+				case p.pvcNamespace != p.secretNamespace:
+					klog.Warningf("skip setting owner reference of secret(%s) since pvc namespace(%s) is different from secret namespace(%s)", storedSecretName, p.pvcNamespace, p.secretNamespace)
+				default:
+					if err := d.setSecretOwnerReference(ctx, storedSecretName, p.secretNamespace, p.pvcName); err != nil {
+						return nil, status.Errorf(codes.Internal, "failed to set pvc(%s) as owner of secret(%s) in namespace(%s), error: %v", p.pvcName, storedSecretName, p.secretNamespace, err)
+					}
+				}
+			}
+		}
+	}
+
+	var accessibleTopology []*csi.Topology
+	if d.enableTopology {
+		region, err := d.getAccountRegion(ctx, p.subsID, p.resourceGroup, accountName, p.location, userSecrets, existingAccount)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to get location of account(%s) rg(%s), error: %v", accountName, p.resourceGroup, err)
+		}
+		if region != "" {
+			accessibleTopology = []*csi.Topology{{Segments: map[string]string{topologyRegionKey: region}}}
+		}
+	}
+
+	volumeID = d.formatVolumeID(getCreateVolumeID(p.resourceGroup, accountName, validContainerName, p.containerName, volName, p.secretNamespace, p.subsID, p.deletePolicy, volumeStorageEndpointSuffix, p.protocol, volumeIDFlags...))
+	klog.V(2).InfoS("created container successfully", volumeLogFields("CreateVolume", volumeID, accountName, validContainerName, "volumeName", volName)...)
 	csicommon.SendKubeEvent(v1.EventTypeNormal, csicommon.CreatedBlobContainer, csicommon.CSIEventSourceStr,
 		fmt.Sprintf("Controller CreateVolume: Created blob container %s in %q storage account", validContainerName, accountName))
 
-	if useDataPlaneAPI {
-		d.dataPlaneAPIVolCache.Set(volumeID, "")
-		d.dataPlaneAPIVolCache.Set(accountName, "")
+	if p.useDataPlaneAPI {
+		d.dataPlaneAPIVolCache.Set(volumeID, "")
+		d.dataPlaneAPIVolCache.Set(accountName, "")
+	}
+
+	isOperationSucceeded = true
+	// reset secretNamespace field in VolumeContext
+	setKeyValueInMap(parameters, secretNamespaceField, p.secretNamespace)
+	volume := &csi.Volume{
+		VolumeId:           volumeID,
+		CapacityBytes:      capacityBytes,
+		VolumeContext:      parameters,
+		ContentSource:      req.GetVolumeContentSource(),
+		AccessibleTopology: accessibleTopology,
+	}
+	d.createdVolumes.Store(volName, &createdVolume{
+		requestHash: requestHash,
+		volume:      volume,
+	})
+	d.createdVolumeNames.Store(volumeID, volName)
+	return &csi.CreateVolumeResponse{Volume: volume}, nil
+}
+
+// getTopologyRegion returns the region of the first preferred topology, requisite topologies are used if there is no preferred one
+func getTopologyRegion(requirements *csi.TopologyRequirement) string {
+	for _, topologies := range [][]*csi.Topology{requirements.GetPreferred(), requirements.GetRequisite()} {
+		for _, topology := range topologies {
+			if region := topology.GetSegments()[topologyRegionKey]; region != "" {
+				return region
+			}
+		}
+	}
+	return ""
+}
+
+// getAccountRegion returns the region of storage account, location of the account is read through management API
+// unless secrets are provided, only region is returned since storage account is not zonal and zone redundant
+// account is spread across availability zones of the region, account is the properties already fetched, nil if not
+func (d *Driver) getAccountRegion(ctx context.Context, subsID, resourceGroupName, accountName, location string, secrets map[string]string, account *storage.Account) (string, error) {
+	if len(secrets) > 0 || (account == nil && d.cloud.StorageAccountClient == nil) {
+		return strings.ToLower(location), nil
+	}
+	if account == nil {
+		if subsID == "" {
+			subsID = d.cloud.SubscriptionID
+		}
+		if resourceGroupName == "" {
+			resourceGroupName = d.cloud.ResourceGroup
+		}
+		properties, rerr := d.cloud.StorageAccountClient.GetProperties(ctx, subsID, resourceGroupName, accountName)
+		if rerr != nil {
+			return "", rerr.Error()
+		}
+		account = &properties
+	}
+	if account.Location != nil && *account.Location != "" {
+		return strings.ToLower(*account.Location), nil
+	}
+	if location == "" {
+		location = d.cloud.Location
+	}
+	return strings.ToLower(location), nil
+}
+
+// getProvisionedCapacityBytes returns capacity of the volume in bytes rounded up to GiB, which matches the quota
+// enforced by blobfuse, requested bytes are returned if rounded capacity exceeds the limit
+func getProvisionedCapacityBytes(requiredBytes, limitBytes int64) int64 {
+	capacityBytes := util.RoundUpBytes(requiredBytes)
+	if limitBytes > 0 && capacityBytes > limitBytes {
+		return requiredBytes
+	}
+	return capacityBytes
+}
+
+// getCreateVolumeID returns v2 volume id of the container created in CreateVolume,
+// storageEndpointSuffix should be empty if it's the cloud default
+func getCreateVolumeID(resourceGroup, accountName, validContainerName, containerName, volName, secretNamespace, subsID, deletePolicy, storageEndpointSuffix, protocol string, flags ...string) string {
+	var uuid string
+	if containerName != "" {
+		// add volume name as suffix to differentiate volumeID since "containerName" is specified
+		// not necessary for dynamic container name creation since volumeID already contains volume name
+		uuid = volName
+	}
+	// DeleteVolume has no volume context, so delete policy, storage endpoint suffix, protocol and volume options are recorded in volume id
+	volumeID := fmt.Sprintf(volumeIDV2Template, resourceGroup, accountName, validContainerName, uuid, secretNamespace, subsID, deletePolicy, storageEndpointSuffix, protocol)
+	if len(flags) > 0 {
+		volumeID = volumeID + separator + strings.Join(flags, volumeIDFlagSeparator)
+	}
+	return volumeID
+}
+
+// volumeLogFields returns key/value pairs of operation, volumeID, account and container for structured logs,
+// empty values are omitted and keysAndValues are appended
+func volumeLogFields(operation, volumeID, accountName, containerName string, keysAndValues ...interface{}) []interface{} {
+	fields := []interface{}{"operation", operation}
+	if volumeID != "" {
+		fields = append(fields, "volumeID", volumeID)
+	}
+	if accountName != "" {
+		fields = append(fields, "account", accountName)
+	}
+	if containerName != "" {
+		fields = append(fields, "container", containerName)
+	}
+	return append(fields, keysAndValues...)
+}
+
+// getVolumeIDOfContainer returns v2 volume id of an existing container, uuid, delete policy, storage endpoint suffix
+// and protocol are not recorded on the container, they are left empty so that defaults are used
+func getVolumeIDOfContainer(resourceGroupName, accountName, containerName, secretNamespace, subsID string) string {
+	return fmt.Sprintf(volumeIDV2Template, resourceGroupName, accountName, containerName, "", secretNamespace, subsID, "", "", "")
+}
+
+// azureErrorStatus returns gRPC status error of a failed Azure API call, throttling errors are returned as
+// ResourceExhausted and other retriable errors as Unavailable with a RetryInfo detail carrying the suggested
+// backoff so that sidecars could honor it, non-retriable errors are returned as Internal
+func azureErrorStatus(err error, format string, a ...interface{}) error {
+	msg := fmt.Sprintf(format, a...)
+	retriable, httpStatusCode, retryAfter := getRetriableErrorInfo(err)
+	if !retriable {
+		return status.Error(codes.Internal, msg)
+	}
+	code := codes.Unavailable
+	if isThrottlingError(err, httpStatusCode) {
+		code = codes.ResourceExhausted
+	}
+	if retryAfter <= 0 {
+		retryAfter = defaultRetryAfter
+	}
+	st, detailErr := status.New(code, msg).WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)})
+	if detailErr != nil {
+		klog.Warningf("failed to add retry info to status: %v", detailErr)
+		return status.Error(code, msg)
+	}
+	return st.Err()
+}
+
+// dryRunStatus returns FailedPrecondition status of a dry run with the resolved volume context attached as ErrorInfo metadata,
+// so that it could be consumed without parsing the message
+func dryRunStatus(msg string, volumeContext map[string]string) error {
+	st, detailErr := status.New(codes.FailedPrecondition, msg).WithDetails(&errdetails.ErrorInfo{
+		Reason:   dryRunErrorReason,
+		Domain:   DefaultDriverName,
+		Metadata: volumeContext,
+	})
+	if detailErr != nil {
+		klog.Warningf("failed to add volume context to status: %v", detailErr)
+		return status.Error(codes.FailedPrecondition, msg)
+	}
+	return st.Err()
+}
+
+// formatVolumeContext returns volume context as comma separated key=value pairs sorted by key
+func formatVolumeContext(volumeContext map[string]string) string {
+	pairs := make([]string, 0, len(volumeContext))
+	for k, v := range volumeContext {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// ensureStorageAccount finds or creates a storage account matching accountOptions and records it in account search cache,
+// account search is serialized per lockKey so that concurrent requests with the same account attributes share one account
+func (d *Driver) ensureStorageAccount(ctx context.Context, accountOptions *azure.AccountOptions, protocol, lockKey string, settings *accountSettings) (string, string, error) {
+	var accountName, accountKey string
+	d.volLockMap.LockEntry(lockKey)
+	if !accountOptions.CreateAccount {
+		// the account may be found or created by the previous holder of the lock, reuse it instead of
+		// searching accounts again so that requests waiting on the same lockKey proceed right away
+		if cache, err := d.accountSearchCache.Get(lockKey, azcache.CacheReadTypeDefault); err == nil && cache != nil {
+			d.volLockMap.UnlockEntry(lockKey)
+			accountName = cache.(string)
+			klog.V(2).Infof("use storage account(%s) found by a concurrent request", accountName)
+			if accountKey, err = d.getEnsuredAccountKey(ctx, accountOptions, accountName); err != nil {
+				return "", "", err
+			}
+			return accountName, accountKey, nil
+		}
+	}
+	// a recent failure is likely to happen again, e.g. quota is exhausted, return it instead of calling Azure API again
+	if cache, err := d.accountSearchFailureCache.Get(lockKey, azcache.CacheReadTypeDefault); err == nil && cache != nil {
+		d.volLockMap.UnlockEntry(lockKey)
+		return "", "", fmt.Errorf("skip ensuring storage account since it failed within %v: %w", accountSearchFailureCacheTTL, cache.(error))
+	}
+	// accounts created by a previous holder of the lock are not counted as new
+	start := time.Now()
+	err := wait.ExponentialBackoff(getJitteredBackoff(d.cloud.RequestBackoff(), d.accountBackoffJitterFactor), func() (bool, error) {
+		var retErr error
+		if settings.isEmpty() {
+			accountName, accountKey, retErr = d.cloud.EnsureStorageAccount(ctx, accountOptions, protocol)
+		} else {
+			accountName, accountKey, retErr = d.ensureStorageAccountWithSettings(ctx, accountOptions, protocol, settings)
+		}
+		if isRetriableError(retErr) {
+			klog.Warningf("EnsureStorageAccount(%s) failed with error(%v), waiting for retrying", accountOptions.Name, retErr)
+			return false, nil
+		}
+		return true, retErr
+	})
+	if err == nil {
+		// record the account before releasing the lock so that waiting requests could find it
+		d.accountSearchCache.Set(lockKey, accountName)
+		if err := d.accountSearchFailureCache.Delete(lockKey); err != nil {
+			klog.Warningf("failed to delete account search failure cache(%s): %v", lockKey, err)
+		}
+	} else if ctx.Err() == nil {
+		// canceled requests are not recorded since the failure is not caused by Azure API
+		d.accountSearchFailureCache.Set(lockKey, err)
+	}
+	d.volLockMap.UnlockEntry(lockKey)
+	if err != nil {
+		return "", "", err
+	}
+	if d.isNewStorageAccount(ctx, accountOptions, accountName, start) {
+		klog.V(2).Infof("created new storage account(%s) type(%s) kind(%s) rg(%s)", accountName, accountOptions.Type, accountOptions.Kind, accountOptions.ResourceGroup)
+		storageAccountCreatedCount.WithLabelValues(accountOptions.Type, accountOptions.Kind).Inc()
+		csicommon.SendKubeEvent(v1.EventTypeNormal, csicommon.CreatedStorageAccount, csicommon.CSIEventSourceStr,
+			fmt.Sprintf("Controller CreateVolume: Created storage account %s in resource group %s", accountName, accountOptions.ResourceGroup))
+	}
+	if accountKey == "" {
+		// key is not returned when an existing account is found by account settings
+		if accountKey, err = d.getEnsuredAccountKey(ctx, accountOptions, accountName); err != nil {
+			return "", "", err
+		}
+	}
+	return accountName, accountKey, nil
+}
+
+// getEnsuredAccountKey returns the key of the storage account found by ensureStorageAccount,
+// an error is returned instead of an empty key so that callers never use an account without key
+func (d *Driver) getEnsuredAccountKey(ctx context.Context, accountOptions *azure.AccountOptions, accountName string) (string, error) {
+	subsID := accountOptions.SubscriptionID
+	if subsID == "" {
+		subsID = d.cloud.SubscriptionID
+	}
+	accountKey, err := d.cloud.GetStorageAccesskey(ctx, subsID, accountName, accountOptions.ResourceGroup, accountOptions.GetLatestAccountKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to get key of storage account(%s) rg(%s): %w", accountName, accountOptions.ResourceGroup, err)
+	}
+	if accountKey == "" {
+		return "", fmt.Errorf("empty key of storage account(%s) rg(%s)", accountName, accountOptions.ResourceGroup)
+	}
+	return accountKey, nil
+}
+
+// ensureStorageAccountWithSettings finds the storage account created by driver with the same account options and settings,
+// or creates a new one and applies the settings on it. The account is tagged with skip-matching so that it's never picked by
+// EnsureStorageAccount for other storage classes, and settings are never applied on accounts which are not created by driver
+func (d *Driver) ensureStorageAccountWithSettings(ctx context.Context, accountOptions *azure.AccountOptions, protocol string, settings *accountSettings) (string, string, error) {
+	if d.cloud.StorageAccountClient == nil {
+		return "", "", fmt.Errorf("StorageAccountClient is nil")
+	}
+	subsID := accountOptions.SubscriptionID
+	if subsID == "" {
+		subsID = d.cloud.SubscriptionID
+	}
+	settingsTag := getAccountSettingsTag(accountOptions, settings)
+	if !accountOptions.CreateAccount {
+		accounts, rerr := d.cloud.StorageAccountClient.ListByResourceGroup(ctx, subsID, accountOptions.ResourceGroup)
+		if rerr != nil {
+			return "", "", rerr.Error()
+		}
+		for _, account := range accounts {
+			if account.Name != nil && account.Tags != nil && pointer.StringDeref(account.Tags[accountSettingsTagKey], "") == settingsTag {
+				klog.V(2).Infof("found storage account(%s) created with the same settings(%s)", *account.Name, settingsTag)
+				return *account.Name, "", nil
+			}
+		}
+	}
+
+	options := *accountOptions
+	options.Name = ""
+	options.CreateAccount = true
+	options.Tags = make(map[string]string, len(accountOptions.Tags)+2)
+	for k, v := range accountOptions.Tags {
+		options.Tags[k] = v
+	}
+	options.Tags[azure.SkipMatchingTag] = ""
+	options.Tags[accountSettingsTagKey] = settingsTag
+	accountName, accountKey, err := d.cloud.EnsureStorageAccount(ctx, &options, protocol)
+	if err != nil {
+		return "", "", err
+	}
+	if err := d.applyAccountSettings(ctx, subsID, options.ResourceGroup, accountName, settings); err != nil {
+		// the account has no container yet, delete it so that it would not be found with incomplete settings
+		if rerr := d.cloud.StorageAccountClient.Delete(ctx, subsID, options.ResourceGroup, accountName); rerr != nil {
+			klog.Warningf("failed to delete storage account(%s) rg(%s) after applying settings failed, error: %v", accountName, options.ResourceGroup, rerr.Error())
+		}
+		return "", "", err
+	}
+	return accountName, accountKey, nil
+}
+
+// getAccountSettingsTag returns a hash of account options and settings, which is tagged on the storage account created with
+// the settings so that the account is only reused by volumes with the same account options and settings
+func getAccountSettingsTag(accountOptions *azure.AccountOptions, settings *accountSettings) string {
+	options := *accountOptions
+	options.Name = ""
+	options.CreateAccount = false
+	options.PickRandomMatchingAccount = false
+	options.GetLatestAccountKey = false
+	options.Tags = nil
+	if accountOptions.MatchTags {
+		options.Tags = map[string]string{}
+		for k, v := range accountOptions.Tags {
+			if k != consts.CreatedByTag && k != azure.SkipMatchingTag && k != accountSettingsTagKey {
+				options.Tags[k] = v
+			}
+		}
+	}
+	data, err := json.Marshal(&options)
+	if err != nil {
+		klog.Warningf("failed to marshal account options: %v", err)
+	}
+	sum := sha256.Sum256(append(data, settings.key()...))
+	return hex.EncodeToString(sum[:16])
+}
+
+// isNewStorageAccount checks whether the account returned by EnsureStorageAccount is created after since,
+// EnsureStorageAccount does not tell whether a matching account is reused, so creation time of the account is checked
+func (d *Driver) isNewStorageAccount(ctx context.Context, accountOptions *azure.AccountOptions, accountName string, since time.Time) bool {
+	if accountOptions.CreateAccount && accountOptions.Name == "" {
+		// matching accounts are not searched, a new account is always created
+		return true
+	}
+	if d.cloud.StorageAccountClient == nil {
+		return false
+	}
+	subsID := accountOptions.SubscriptionID
+	if subsID == "" {
+		subsID = d.cloud.SubscriptionID
+	}
+	account, rerr := d.cloud.StorageAccountClient.GetProperties(ctx, subsID, accountOptions.ResourceGroup, accountName)
+	if rerr != nil {
+		klog.Warningf("failed to get properties of account(%s) rg(%s), error: %v", accountName, accountOptions.ResourceGroup, rerr.Error())
+		return false
+	}
+	if account.AccountProperties == nil || account.CreationTime == nil {
+		return false
+	}
+	return account.CreationTime.Time.After(since.Add(-accountCreationTimeTolerance))
+}
+
+// setPrivateEndpointServerName sets server name of storage account with private endpoint in volume context
+func setPrivateEndpointServerName(parameters map[string]string, protocol, serverName, accountName, storageEndpointSuffix string) {
+	if protocol == NFS {
+		setKeyValueInMap(parameters, serverNameField, fmt.Sprintf("%s.privatelink.blob.%s", accountName, storageEndpointSuffix))
+	} else if (protocol == Fuse || protocol == Fuse2) && serverName == "" {
+		// As for blobfuse/blobfuse2, serverName, i.e.,AZURE_STORAGE_BLOB_ENDPOINT env variable can't include
+		// "privatelink", issue: https://github.com/Azure/azure-storage-fuse/issues/1014
+		//
+		// And use public endpoint will be befine to blobfuse/blobfuse2, because it will be resolved to private endpoint
+		// by private dns zone, which includes CNAME record, documented here:
+		// https://learn.microsoft.com/en-us/azure/storage/common/storage-private-endpoints?toc=%2Fazure%2Fstorage%2Fblobs%2Ftoc.json&bc=%2Fazure%2Fstorage%2Fblobs%2Fbreadcrumb%2Ftoc.json#dns-changes-for-private-endpoints
+		setKeyValueInMap(parameters, serverNameField, fmt.Sprintf("%s.blob.%s", accountName, storageEndpointSuffix))
+	}
+}
+
+// createVolumeParameters holds parsed CreateVolume parameters, some of them could conflict with each other
+type createVolumeParameters struct {
+	protocol                     string
+	storageAccountType           string
+	account                      string
+	subsID                       string
+	isCrossSubscription          bool
+	isAzureStackCloud            bool
+	isHnsEnabled                 *bool
+	enableBlobVersioning         *bool
+	enableChangeFeed             bool
+	changeFeedRetentionDays      *int32
+	immutabilityPeriodDays       *int32
+	enableLastAccessTimeTracking bool
+	lifecyclePolicy              *lifecyclePolicy
+	enableLargeBlockBlob         bool
+	allowSharedKeyAccess         *bool
+	defaultToOAuthAuthentication *bool
+	minimumTLSVersion            storage.MinimumTLSVersion
+	useDataPlaneAPI              bool
+	useUserDelegationSAS         bool
+	storeAccountKey              bool
+	secretName                   string
+	useExternalSecret            bool
+	clientID                     string
+	tenantID                     string
+	keyVaultURL                  string
+	keyVaultSecretName           string
+	allowedIPRanges              []string
+	networkDefaultAction         storage.DefaultAction
+	exposure                     string
+	networkEndpointType          string
+	softDeleteBlobs              *int32
+	softDeleteContainers         *int32
+	matchTags                    bool
+	hasSecrets                   bool
+	hasContentSource             bool
+	rootOwner                    string
+	rootGroup                    string
+	enableBlobInventory          bool
+	blobInventoryDestination     string
+	blobInventorySchedule        string
+	blobInventoryFormat          string
+	containerName                string
+	containerNamePrefix          string
+	containerNameTemplate        string
+	defaultEncryptionScope       string
+	skipContainerCreation        bool
+	deletePolicy                 string
+	setSecretOwnerReference      bool
+	resourceGroup                string
+	location                     string
+	customTags                   string
+	secretNamespace              string
+	pvcNamespace                 string
+	requireInfraEncryption       *bool
+	vnetResourceGroup            string
+	vnetName                     string
+	subnetName                   string
+	accessTier                   string
+	storageEndpointSuffix        string
+	requester                    string
+	serverName                   string
+	containerAccessTier          string
+	onSkuMismatch                string
+	getLatestAccountKey          bool
+	allowReservedContainerNames  bool
+	dryRun                       bool
+	storeMetadata                bool
+	pvcName                      string
+	pvName                       string
+	keyVaultSecretVersion        string
+	containerTags                string
+	azcopyRetryCount             int
+	azcopyPreservePermissions    bool
+	azcopyCopyTimeout            time.Duration
+	waitForContainerReady        *bool
+	allowBlobPublicAccess        *bool
+	restoreDeletedContainer      bool
+	containerReadyTimeout        time.Duration
+	containerNameReplaceMap      map[string]string
+	containerPublicAccess        storage.PublicAccess
+}
+
+// parseCreateVolumeParameters parses storage class parameters of CreateVolume, parameter names are case-insensitive,
+// parameters could be updated in place, e.g. normalized storage endpoint suffix is set back as volume context
+func parseCreateVolumeParameters(parameters map[string]string) (*createVolumeParameters, error) {
+	var err error
+	var storageAccountType, subsID, resourceGroup, location, account, containerName, containerNamePrefix, containerNameTemplate, protocol, customTags, secretName, secretNamespace, pvcNamespace string
+	var isHnsEnabled, requireInfraEncryption, enableBlobVersioning *bool
+	var allowSharedKeyAccess, defaultToOAuthAuthentication *bool
+	var minimumTLSVersion storage.MinimumTLSVersion
+	var allowedIPRanges []string
+	var networkDefaultAction storage.DefaultAction
+	var vnetResourceGroup, vnetName, subnetName, accessTier, networkEndpointType, storageEndpointSuffix string
+	var rootOwner, rootGroup, requester, exposure, serverName, containerAccessTier string
+	onSkuMismatch := skuMismatchWarn
+	var deletePolicy string
+	var matchTags, useDataPlaneAPI, getLatestAccountKey, enableLargeBlockBlob, allowReservedContainerNames, enableBlobInventory bool
+	var enableChangeFeed, enableLastAccessTimeTracking bool
+	var lifecycle *lifecyclePolicy
+	var changeFeedRetentionDays, immutabilityPeriodDays *int32
+	var useUserDelegationSAS, dryRun, setSecretOwnerReference, storeMetadata bool
+	var pvcName, pvName, clientID, tenantID string
+	var keyVaultURL, keyVaultSecretName, keyVaultSecretVersion string
+	createContainer := true
+	var blobInventoryDestination string
+	var blobInventorySchedule, blobInventoryFormat string
+	var containerTags, publicAccess, defaultEncryptionScope string
+	// nil means the soft delete policy is not specified, 0 means the policy is disabled explicitly
+	var softDeleteBlobs, softDeleteContainers *int32
+	var azcopyRetryCount int
+	var azcopyPreservePermissions bool
+	azcopyCopyTimeout := waitForCopyTimeout
+	var waitForContainerReady, allowBlobPublicAccess *bool
+	var restoreDeletedContainer bool
+	containerReadyTimeout := defaultWaitForContainerReadyTimeout
+
+	containerNameReplaceMap := map[string]string{}
+
+	// store account key to k8s secret by default
+	storeAccountKey := true
+
+	// Apply ProvisionerParameters (case-insensitive). We leave validation of
+	// the values to the cloud provider.
+	for k, v := range parameters {
+		switch strings.ToLower(k) {
+		case skuNameField:
+			storageAccountType = v
+		case storageAccountTypeField:
+			storageAccountType = v
+		case locationField:
+			location = v
+		case storageAccountField:
+			account = v
+		case subscriptionIDField:
+			subsID = v
+		case resourceGroupField:
+			resourceGroup = v
+		case containerNameField:
+			containerName = v
+		case containerNamePrefixField:
+			containerNamePrefix = v
+		case containerNameTemplateField:
+			containerNameTemplate = v
+		case protocolField:
+			protocol = v
+		case tagsField:
+			customTags = v
+		case containerTagsField:
+			containerTags = v
+		case containerPublicAccessField:
+			publicAccess = v
+		case defaultEncryptionScopeField:
+			if !isValidEncryptionScopeName(v) {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s in storage class, encryption scope name should be 3 to 63 alphanumeric characters", defaultEncryptionScopeField, v)
+			}
+			defaultEncryptionScope = v
+		case matchTagsField:
+			matchTags = strings.EqualFold(v, trueValue)
+		case secretNameField:
+			secretName = v
+		case secretNamespaceField:
+			secretNamespace = v
+		case isHnsEnabledField:
+			if strings.EqualFold(v, trueValue) {
+				isHnsEnabled = pointer.Bool(true)
+			}
+		case softDeleteBlobsField:
+			if softDeleteBlobs, err = parseDays(k, v); err != nil {
+				return nil, err
+			}
+		case softDeleteContainersField:
+			if softDeleteContainers, err = parseDays(k, v); err != nil {
+				return nil, err
+			}
+		case enableBlobVersioningField:
+			enableBlobVersioning = pointer.Bool(strings.EqualFold(v, trueValue))
+		case enableChangeFeedField:
+			if enableChangeFeed, err = strconv.ParseBool(v); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s in storage class", enableChangeFeedField, v)
+			}
+		case enableLastAccessTimeField:
+			if enableLastAccessTimeTracking, err = strconv.ParseBool(v); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s in storage class", enableLastAccessTimeField, v)
+			}
+		case lifecyclePolicyField:
+			if lifecycle, err = parseLifecyclePolicy(v); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+			}
+		case changeFeedRetentionDaysField:
+			days, err := strconv.Atoi(v)
+			if err != nil || days < 1 || days > maxChangeFeedRetentionDays {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s in storage class, should be in range [1, %d]", changeFeedRetentionDaysField, v, maxChangeFeedRetentionDays)
+			}
+			changeFeedRetentionDays = pointer.Int32(int32(days))
+		case immutabilityPeriodDaysField:
+			days, err := strconv.Atoi(v)
+			if err != nil || days < 1 || days > maxImmutabilityPeriodDays {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s in storage class, should be in range [1, %d]", immutabilityPeriodDaysField, v, maxImmutabilityPeriodDays)
+			}
+			immutabilityPeriodDays = pointer.Int32(int32(days))
+		case storeAccountKeyField:
+			if strings.EqualFold(v, falseValue) {
+				storeAccountKey = false
+			}
+		case getLatestAccountKeyField:
+			if getLatestAccountKey, err = strconv.ParseBool(v); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s in volume context", getLatestAccountKeyField, v)
+			}
+		case allowBlobPublicAccessField:
+			allowBlobPublicAccess = pointer.Bool(strings.EqualFold(v, trueValue))
+		case exposureField:
+			exposure = strings.ToLower(v)
+		case requireInfraEncryptionField:
+			if strings.EqualFold(v, trueValue) {
+				requireInfraEncryption = pointer.Bool(true)
+			}
+		case allowSharedKeyAccessField:
+			value, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s in storage class", allowSharedKeyAccessField, v)
+			}
+			allowSharedKeyAccess = pointer.Bool(value)
+		case useUserDelegationSASField:
+			if useUserDelegationSAS, err = strconv.ParseBool(v); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s in storage class", useUserDelegationSASField, v)
+			}
+		case allowSoftDeletedField:
+			// only used in ValidateVolumeCapabilities
+			if _, err := strconv.ParseBool(v); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s in storage class", allowSoftDeletedField, v)
+			}
+		case createContainerField:
+			if createContainer, err = strconv.ParseBool(v); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s in storage class", createContainerField, v)
+			}
+		case dryRunField:
+			if dryRun, err = strconv.ParseBool(v); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s in storage class", dryRunField, v)
+			}
+		case storeMetadataField:
+			if storeMetadata, err = strconv.ParseBool(v); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s in storage class", storeMetadataField, v)
+			}
+		case rootOwnerField:
+			if !isValidRootOwner(v) {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s in storage class, should be a POSIX UID or an object ID", rootOwnerField, v)
+			}
+			rootOwner = v
+		case rootGroupField:
+			if !isValidRootOwner(v) {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s in storage class, should be a POSIX GID or an object ID", rootGroupField, v)
+			}
+			rootGroup = v
+		case onSkuMismatchField:
+			onSkuMismatch = strings.ToLower(v)
+			if !util.ContainsString(supportedSkuMismatchActions, onSkuMismatch, nil) {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s in storage class, supported values: %v", onSkuMismatchField, v, supportedSkuMismatchActions)
+			}
+		case allowReservedNamesField:
+			allowReservedContainerNames = strings.EqualFold(v, trueValue)
+		case azcopyRetryCountField:
+			if azcopyRetryCount, err = strconv.Atoi(v); err != nil || azcopyRetryCount < 0 || azcopyRetryCount > maxAzcopyRetryCount {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s in storage class, should be an integer in range [0, %d]", azcopyRetryCountField, v, maxAzcopyRetryCount)
+			}
+		case azcopyPreservePermissionsField:
+			if azcopyPreservePermissions, err = strconv.ParseBool(v); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s in storage class", azcopyPreservePermissionsField, v)
+			}
+		case azcopyCopyTimeoutField:
+			if azcopyCopyTimeout, err = time.ParseDuration(v); err != nil || azcopyCopyTimeout <= 0 {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s in storage class, should be a positive duration, e.g. 30m", azcopyCopyTimeoutField, v)
+			}
+		case requesterField:
+			requester = v
+		case enableBlobInventoryField:
+			if enableBlobInventory, err = strconv.ParseBool(v); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s in storage class", enableBlobInventoryField, v)
+			}
+		case blobInventoryDestField:
+			blobInventoryDestination = v
+		case blobInventoryScheduleField:
+			blobInventorySchedule = v
+		case blobInventoryFormatField:
+			blobInventoryFormat = v
+		case deletePolicyField:
+			deletePolicy = strings.ToLower(v)
+			if !util.ContainsString(supportedDeletePolicies, deletePolicy, nil) {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s in storage class, supported values: %v", deletePolicyField, v, supportedDeletePolicies)
+			}
+		case defaultToOAuthAuthField:
+			value, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s in storage class", defaultToOAuthAuthField, v)
+			}
+			defaultToOAuthAuthentication = pointer.Bool(value)
+		case minimumTLSVersionField:
+			if minimumTLSVersion, err = getMinimumTLSVersion(v); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+			}
+		case allowedIPRangesField:
+			if allowedIPRanges, err = parseAllowedIPRanges(v); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+			}
+		case networkDefaultActionField:
+			if networkDefaultAction, err = getNetworkDefaultAction(v); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+			}
+		case pvcNamespaceKey:
+			pvcNamespace = v
+			containerNameReplaceMap[pvcNamespaceMetadata] = v
+		case pvcNameKey:
+			pvcName = v
+			containerNameReplaceMap[pvcNameMetadata] = v
+		case pvNameKey:
+			pvName = v
+			containerNameReplaceMap[pvNameMetadata] = v
+		case keyVaultURLField:
+			keyVaultURL = v
+		case keyVaultSecretNameField:
+			keyVaultSecretName = v
+		case keyVaultSecretVersionField:
+			keyVaultSecretVersion = v
+		case clientIDField:
+			clientID = v
+		case tenantIDField:
+			tenantID = v
+		case setSecretOwnerReferenceField:
+			if setSecretOwnerReference, err = strconv.ParseBool(v); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s in storage class", setSecretOwnerReferenceField, v)
+			}
+		case serverNameField:
+			serverName = v
+		case storageAuthTypeField:
+		case storageIentityClientIDField:
+		case storageIdentityObjectIDField:
+		case storageIdentityResourceIDField:
+		case msiEndpointField:
+		case storageAADEndpointField:
+			// no op, only used in NodeStageVolume
+		case storageEndpointSuffixField:
+			storageEndpointSuffix = normalizeStorageEndpointSuffix(v)
+			if storageEndpointSuffix != "" {
+				// volume context is used in NodeStageVolume, store the normalized value
+				setKeyValueInMap(parameters, storageEndpointSuffixField, storageEndpointSuffix)
+			}
+		case vnetResourceGroupField:
+			vnetResourceGroup = v
+		case vnetNameField:
+			vnetName = v
+		case subnetNameField:
+			subnetName = v
+		case accessTierField:
+			accessTier = v
+		case containerAccessTierField:
+			containerAccessTier = v
+		case networkEndpointTypeField:
+			networkEndpointType = v
+		case EcStrgAuthenticationField:
+			containerNameReplaceMap[EcStrgAuthenticationField] = v
+		case mountPermissionsField:
+			// only do validations here, used in NodeStageVolume, NodePublishVolume
+			if v != "" {
+				if _, err := strconv.ParseUint(v, 8, 32); err != nil {
+					return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("invalid mountPermissions %s in storage class", v))
+				}
+			}
+		case useDataPlaneAPIField:
+			useDataPlaneAPI = strings.EqualFold(v, trueValue)
+		case enableLargeBlockBlobField:
+			enableLargeBlockBlob = strings.EqualFold(v, trueValue)
+		case waitForContainerReadyField:
+			waitForContainerReady = pointer.Bool(strings.EqualFold(v, trueValue))
+		case restoreDeletedContainerField:
+			if restoreDeletedContainer, err = strconv.ParseBool(v); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s in storage class", restoreDeletedContainerField, v)
+			}
+		case containerReadyTimeoutField:
+			if containerReadyTimeout, err = time.ParseDuration(v); err != nil || containerReadyTimeout <= 0 {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s in storage class", containerReadyTimeoutField, v)
+			}
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("invalid parameter %q in storage class", k))
+		}
+	}
+
+	if exposure != "" {
+		if err := applyExposurePreset(exposure, protocol, &networkEndpointType, &allowBlobPublicAccess); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, err.Error())
+		}
+	}
+	if allowBlobPublicAccess == nil {
+		// set allowBlobPublicAccess as false by default
+		allowBlobPublicAccess = pointer.Bool(false)
+	}
+	containerPublicAccess := storage.PublicAccessNone
+	if exposure == exposurePublic {
+		containerPublicAccess = storage.PublicAccessBlob
+	}
+	if publicAccess != "" {
+		if containerPublicAccess, err = getContainerPublicAccess(publicAccess); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, err.Error())
+		}
+		if containerPublicAccess != storage.PublicAccessNone && !*allowBlobPublicAccess {
+			return nil, status.Errorf(codes.InvalidArgument, "containerPublicAccess(%s) is not allowed when allowBlobPublicAccess is false", publicAccess)
+		}
+	}
+
+	// account key is managed by user in a pre-created secret, driver neither fetches nor stores the key
+	// and only returns the secret reference in VolumeContext
+	useExternalSecret := !storeAccountKey && secretName != ""
+
+	if !pointer.BoolDeref(allowSharedKeyAccess, true) {
+		// account key could not be used when shared key access is disallowed,
+		// azure AD is the only authorization method left on the account
+		storeAccountKey = false
+	}
+
+	if storageAccountType != "" {
+		storageAccountType = normalizeSkuName(storageAccountType)
+	}
+
+	return &createVolumeParameters{
+		storageAccountType:           storageAccountType,
+		subsID:                       subsID,
+		resourceGroup:                resourceGroup,
+		location:                     location,
+		account:                      account,
+		containerName:                containerName,
+		containerNamePrefix:          containerNamePrefix,
+		containerNameTemplate:        containerNameTemplate,
+		protocol:                     protocol,
+		customTags:                   customTags,
+		secretName:                   secretName,
+		secretNamespace:              secretNamespace,
+		pvcNamespace:                 pvcNamespace,
+		isHnsEnabled:                 isHnsEnabled,
+		requireInfraEncryption:       requireInfraEncryption,
+		enableBlobVersioning:         enableBlobVersioning,
+		allowSharedKeyAccess:         allowSharedKeyAccess,
+		defaultToOAuthAuthentication: defaultToOAuthAuthentication,
+		minimumTLSVersion:            minimumTLSVersion,
+		allowedIPRanges:              allowedIPRanges,
+		networkDefaultAction:         networkDefaultAction,
+		vnetResourceGroup:            vnetResourceGroup,
+		vnetName:                     vnetName,
+		subnetName:                   subnetName,
+		accessTier:                   accessTier,
+		networkEndpointType:          networkEndpointType,
+		storageEndpointSuffix:        storageEndpointSuffix,
+		rootOwner:                    rootOwner,
+		rootGroup:                    rootGroup,
+		requester:                    requester,
+		exposure:                     exposure,
+		serverName:                   serverName,
+		containerAccessTier:          containerAccessTier,
+		onSkuMismatch:                onSkuMismatch,
+		deletePolicy:                 deletePolicy,
+		matchTags:                    matchTags,
+		useDataPlaneAPI:              useDataPlaneAPI,
+		getLatestAccountKey:          getLatestAccountKey,
+		enableLargeBlockBlob:         enableLargeBlockBlob,
+		allowReservedContainerNames:  allowReservedContainerNames,
+		enableBlobInventory:          enableBlobInventory,
+		enableChangeFeed:             enableChangeFeed,
+		enableLastAccessTimeTracking: enableLastAccessTimeTracking,
+		lifecyclePolicy:              lifecycle,
+		changeFeedRetentionDays:      changeFeedRetentionDays,
+		immutabilityPeriodDays:       immutabilityPeriodDays,
+		useUserDelegationSAS:         useUserDelegationSAS,
+		dryRun:                       dryRun,
+		setSecretOwnerReference:      setSecretOwnerReference,
+		storeMetadata:                storeMetadata,
+		pvcName:                      pvcName,
+		pvName:                       pvName,
+		clientID:                     clientID,
+		tenantID:                     tenantID,
+		keyVaultURL:                  keyVaultURL,
+		keyVaultSecretName:           keyVaultSecretName,
+		keyVaultSecretVersion:        keyVaultSecretVersion,
+		skipContainerCreation:        !createContainer,
+		blobInventoryDestination:     blobInventoryDestination,
+		blobInventorySchedule:        blobInventorySchedule,
+		blobInventoryFormat:          blobInventoryFormat,
+		containerTags:                containerTags,
+		defaultEncryptionScope:       defaultEncryptionScope,
+		softDeleteBlobs:              softDeleteBlobs,
+		softDeleteContainers:         softDeleteContainers,
+		azcopyRetryCount:             azcopyRetryCount,
+		azcopyPreservePermissions:    azcopyPreservePermissions,
+		azcopyCopyTimeout:            azcopyCopyTimeout,
+		waitForContainerReady:        waitForContainerReady,
+		allowBlobPublicAccess:        allowBlobPublicAccess,
+		restoreDeletedContainer:      restoreDeletedContainer,
+		containerReadyTimeout:        containerReadyTimeout,
+		containerNameReplaceMap:      containerNameReplaceMap,
+		storeAccountKey:              storeAccountKey,
+		containerPublicAccess:        containerPublicAccess,
+		useExternalSecret:            useExternalSecret,
+	}, nil
+}
+
+// accountSettings returns the settings applied on storage account created by driver
+func (p *createVolumeParameters) accountSettings() *accountSettings {
+	return &accountSettings{
+		defaultToOAuthAuthentication: p.defaultToOAuthAuthentication,
+		minimumTLSVersion:            p.minimumTLSVersion,
+		allowedIPRanges:              p.allowedIPRanges,
+		networkDefaultAction:         p.networkDefaultAction,
+		disableSoftDeleteBlobs:       isDisabledDays(p.softDeleteBlobs),
+		disableSoftDeleteContainers:  isDisabledDays(p.softDeleteContainers),
+		enableChangeFeed:             p.enableChangeFeed,
+		changeFeedRetentionDays:      p.changeFeedRetentionDays,
+		enableLastAccessTimeTracking: p.enableLastAccessTimeTracking,
+	}
+}
+
+// validateCreateVolumeParameters checks mutually exclusive parameter combinations in CreateVolume,
+// returns InvalidArgument error on the first conflict found
+func validateCreateVolumeParameters(p *createVolumeParameters) error {
+	isNFS := p.protocol == NFS
+	isHNS := pointer.BoolDeref(p.isHnsEnabled, false)
+	allowSharedKeyAccess := pointer.BoolDeref(p.allowSharedKeyAccess, true)
+
+	if pointer.BoolDeref(p.enableBlobVersioning, false) && (isNFS || isHNS) {
+		return status.Errorf(codes.InvalidArgument, "enableBlobVersioning is not supported for NFS protocol or HNS enabled account")
+	}
+	if p.enableChangeFeed {
+		if isNFS || isHNS {
+			return status.Errorf(codes.InvalidArgument, "enableChangeFeed is not supported for NFS protocol or HNS enabled account")
+		}
+		if p.hasSecrets || p.useDataPlaneAPI {
+			return status.Errorf(codes.InvalidArgument, "enableChangeFeed is only supported with management API, could not be used with secrets or useDataPlaneAPI")
+		}
+	} else if p.changeFeedRetentionDays != nil {
+		return status.Errorf(codes.InvalidArgument, "changeFeedRetentionDays is only valid when enableChangeFeed is true")
+	}
+	if p.enableLastAccessTimeTracking {
+		if isNFS || isHNS {
+			return status.Errorf(codes.InvalidArgument, "enableLastAccessTimeTracking is not supported for NFS protocol or HNS enabled account")
+		}
+		if p.hasSecrets || p.useDataPlaneAPI {
+			return status.Errorf(codes.InvalidArgument, "enableLastAccessTimeTracking is only supported with management API, could not be used with secrets or useDataPlaneAPI")
+		}
+	}
+	if p.immutabilityPeriodDays != nil {
+		if isNFS {
+			return status.Errorf(codes.InvalidArgument, "immutabilityPeriodDays is not supported for NFS protocol")
+		}
+		if p.hasSecrets || p.useDataPlaneAPI {
+			return status.Errorf(codes.InvalidArgument, "immutabilityPeriodDays is only supported with management API, could not be used with secrets or useDataPlaneAPI")
+		}
+	}
+	if p.account != "" || p.hasSecrets {
+		// account wide settings are never changed on an existing account, volumes with different settings must not share the account
+		if names := p.accountSettings().names(); len(names) > 0 {
+			return status.Errorf(codes.InvalidArgument, "%s is only applied on storage account created by driver, could not be used with storageAccount or secrets", names[0])
+		}
+	}
+	if p.enableLargeBlockBlob && isNFS {
+		return status.Errorf(codes.InvalidArgument, "enableLargeBlockBlob is not supported for NFS protocol")
+	}
+
+	if !allowSharedKeyAccess {
+		if !pointer.BoolDeref(p.defaultToOAuthAuthentication, true) {
+			return status.Errorf(codes.InvalidArgument, "defaultToOAuthAuthentication could not be false when allowSharedKeyAccess is false")
+		}
+		if p.useDataPlaneAPI {
+			return status.Errorf(codes.InvalidArgument, "useDataPlaneAPI is not supported when allowSharedKeyAccess is false")
+		}
+		if p.hasContentSource && !p.useUserDelegationSAS {
+			return status.Errorf(codes.InvalidArgument, "volume cloning is not supported when allowSharedKeyAccess is false, unless useUserDelegationSAS is true")
+		}
+	}
+
+	if p.rootOwner != "" || p.rootGroup != "" {
+		if !isNFS && !isHNS {
+			return status.Errorf(codes.InvalidArgument, "rootOwner and rootGroup are only supported on HNS enabled account, set isHnsEnabled as true or use NFS protocol")
+		}
+		if !allowSharedKeyAccess {
+			return status.Errorf(codes.InvalidArgument, "rootOwner and rootGroup are not supported when allowSharedKeyAccess is false")
+		}
+	}
+
+	if p.lifecyclePolicy != nil {
+		if p.hasSecrets || p.useDataPlaneAPI {
+			return status.Errorf(codes.InvalidArgument, "lifecyclePolicy is only supported with management API, could not be used with secrets or useDataPlaneAPI")
+		}
+		if strings.HasPrefix(strings.ToLower(p.storageAccountType), "premium") && (p.lifecyclePolicy.TierToCoolAfterDays != nil || p.lifecyclePolicy.TierToArchiveAfterDays != nil) {
+			return status.Errorf(codes.InvalidArgument, "tiering in lifecyclePolicy is not supported on premium storage account(%s)", p.storageAccountType)
+		}
+	}
+
+	if p.enableBlobInventory {
+		if p.hasSecrets || p.useDataPlaneAPI {
+			return status.Errorf(codes.InvalidArgument, "enableBlobInventory is only supported with management API, could not be used with secrets or useDataPlaneAPI")
+		}
+		if p.hasContentSource {
+			return status.Errorf(codes.InvalidArgument, "enableBlobInventory is not supported for volume cloning")
+		}
+		if !isValidContainerName(p.blobInventoryDestination) {
+			return status.Errorf(codes.InvalidArgument, "invalid %s: %q in storage class, should be a valid container name", blobInventoryDestField, p.blobInventoryDestination)
+		}
+	} else if p.blobInventoryDestination != "" || p.blobInventorySchedule != "" || p.blobInventoryFormat != "" {
+		return status.Errorf(codes.InvalidArgument, "blobInventoryDestination, blobInventorySchedule and blobInventoryFormat are only valid when enableBlobInventory is true")
+	}
+
+	if p.secretName != "" {
+		if errs := validation.IsDNS1123Subdomain(p.secretName); len(errs) > 0 {
+			return status.Errorf(codes.InvalidArgument, "invalid %s(%s) in storage class: %s", secretNameField, p.secretName, strings.Join(errs, ", "))
+		}
+	}
+	if p.useExternalSecret {
+		if p.useDataPlaneAPI {
+			return status.Errorf(codes.InvalidArgument, "useDataPlaneAPI is not supported when storeAccountKey is false and secretName(%s) is provided", p.secretName)
+		}
+		if p.rootOwner != "" || p.rootGroup != "" {
+			return status.Errorf(codes.InvalidArgument, "rootOwner and rootGroup are not supported when storeAccountKey is false and secretName(%s) is provided", p.secretName)
+		}
+	}
+
+	if p.tenantID != "" && p.clientID == "" {
+		return status.Errorf(codes.InvalidArgument, "tenantID(%s) could not be specified without clientID", p.tenantID)
+	}
+	if p.clientID != "" {
+		// workload identity is only used to create container on data plane of an existing account
+		if p.account == "" {
+			return status.Errorf(codes.InvalidArgument, "storageAccount must be specified when clientID(%s) is specified", p.clientID)
+		}
+		if p.useDataPlaneAPI || p.hasSecrets {
+			return status.Errorf(codes.InvalidArgument, "clientID(%s) could not be used with useDataPlaneAPI or secrets which authorize with account key", p.clientID)
+		}
+		if p.hasContentSource {
+			return status.Errorf(codes.InvalidArgument, "clientID(%s) is not supported when creating volume from snapshot or volume", p.clientID)
+		}
+		if p.rootOwner != "" || p.rootGroup != "" {
+			return status.Errorf(codes.InvalidArgument, "rootOwner and rootGroup are not supported when clientID(%s) is specified", p.clientID)
+		}
+		// these features are configured through management API with driver identity instead of workload identity
+		if p.immutabilityPeriodDays != nil || p.lifecyclePolicy != nil || p.enableBlobInventory || pointer.BoolDeref(p.enableBlobVersioning, false) {
+			return status.Errorf(codes.InvalidArgument, "immutabilityPeriodDays, lifecyclePolicy, enableBlobInventory and enableBlobVersioning are configured through management API with driver identity, could not be used with clientID(%s)", p.clientID)
+		}
+	}
+
+	if p.keyVaultURL != "" || p.keyVaultSecretName != "" {
+		// account key in key vault belongs to an existing account
+		if p.keyVaultURL == "" || p.keyVaultSecretName == "" {
+			return status.Errorf(codes.InvalidArgument, "keyVaultURL and keyVaultSecretName must be specified together")
+		}
+		if p.account == "" {
+			return status.Errorf(codes.InvalidArgument, "storageAccount must be specified when keyVaultURL(%s) is specified", p.keyVaultURL)
+		}
+		if p.hasSecrets || p.clientID != "" || p.useExternalSecret {
+			return status.Errorf(codes.InvalidArgument, "keyVaultURL(%s) could not be used with secrets, clientID or secretName", p.keyVaultURL)
+		}
+	}
+
+	if p.matchTags && p.account != "" {
+		return status.Errorf(codes.InvalidArgument, "matchTags must set as false when storageAccount(%s) is provided", p.account)
+	}
+
+	if p.isCrossSubscription {
+		if isNFS {
+			return status.Errorf(codes.InvalidArgument, "NFS protocol is not supported in cross subscription(%s)", p.subsID)
+		}
+		if !p.storeAccountKey {
+			return status.Errorf(codes.InvalidArgument, "storeAccountKey must set as true in cross subscription(%s)", p.subsID)
+		}
+	}
+
+	if p.storageAccountType != "" {
+		accountKind := getAccountKind(p.storageAccountType, p.isAzureStackCloud)
+		if supportedSkuNames := supportedSkuNamesByKind[accountKind]; !util.ContainsString(supportedSkuNames, p.storageAccountType, nil) {
+			if p.isAzureStackCloud {
+				return status.Errorf(codes.InvalidArgument, "Invalid skuName value: %s, as Azure Stack only supports %s and %s Storage Account types.", p.storageAccountType, storage.SkuNamePremiumLRS, storage.SkuNameStandardLRS)
+			}
+			return status.Errorf(codes.InvalidArgument, "invalid %s: %s for account kind(%s), supported values: %v", skuNameField, p.storageAccountType, accountKind, supportedSkuNames)
+		}
+	}
+
+	if p.networkDefaultAction == storage.DefaultActionAllow && len(p.allowedIPRanges) > 0 {
+		return status.Errorf(codes.InvalidArgument, "allowedIpRanges(%v) could not be used when networkDefaultAction is %s", p.allowedIPRanges, p.networkDefaultAction)
+	}
+	if p.networkDefaultAction == storage.DefaultActionDeny && len(p.allowedIPRanges) == 0 &&
+		p.protocol != NFS && p.exposure != exposureInternal && !strings.EqualFold(p.networkEndpointType, privateEndpoint) {
+		// no IP, vnet rule or private endpoint would be set on the storage account, all access would be denied
+		return status.Errorf(codes.InvalidArgument, "networkDefaultAction %s requires allowedIpRanges, vnet rules (NFS protocol or internal exposure) or private endpoint", p.networkDefaultAction)
+	}
+
+	if p.isAzureStackCloud && p.hasContentSource {
+		return status.Error(codes.Unimplemented, azureStackCloneNotSupportedMsg)
+	}
+
+	if p.containerName != "" && p.containerNamePrefix != "" {
+		return status.Errorf(codes.InvalidArgument, "containerName(%s) and containerNamePrefix(%s) could not be specified together", p.containerName, p.containerNamePrefix)
+	}
+	if p.containerNameTemplate != "" && (p.containerName != "" || p.containerNamePrefix != "") {
+		return status.Errorf(codes.InvalidArgument, "containerNameTemplate(%s) could not be specified together with containerName or containerNamePrefix", p.containerNameTemplate)
+	}
+
+	if p.defaultEncryptionScope != "" && p.hasContentSource {
+		return status.Errorf(codes.InvalidArgument, "defaultEncryptionScope is not supported when creating volume from snapshot or volume")
+	}
+
+	if p.skipContainerCreation {
+		if p.containerName == "" {
+			return status.Errorf(codes.InvalidArgument, "containerName must be specified when createContainer is false")
+		}
+		if p.account == "" && !p.hasSecrets {
+			return status.Errorf(codes.InvalidArgument, "storageAccount must be specified when createContainer is false")
+		}
+		if p.deletePolicy == deletePolicyDelete {
+			return status.Errorf(codes.InvalidArgument, "deletePolicy could not be %s when createContainer is false", p.deletePolicy)
+		}
+		if p.hasContentSource {
+			return status.Errorf(codes.InvalidArgument, "createContainer could not be false when creating volume from snapshot or volume")
+		}
+	}
+	// secret owned by the PVC is garbage collected with the PVC, while a retained container still needs it to be mounted
+	if p.setSecretOwnerReference && (p.deletePolicy == deletePolicyRetain || p.skipContainerCreation) {
+		return status.Errorf(codes.InvalidArgument, "%s could not be true when deletePolicy is %s or createContainer is false", setSecretOwnerReferenceField, deletePolicyRetain)
+	}
+	return nil
+}
+
+// createdVolume records request hash and result of a volume created by driver
+type createdVolume struct {
+	requestHash string
+	volume      *csi.Volume
+}
+
+// isCompatible checks whether a repeated CreateVolume request matches the request which created the volume
+func (v *createdVolume) isCompatible(req *csi.CreateVolumeRequest) bool {
+	return v.requestHash == getCreateVolumeRequestHash(req)
+}
+
+// getCreateVolumeRequestHash returns hash of parameters, capacity range and content source of CreateVolume request
+func getCreateVolumeRequestHash(req *csi.CreateVolumeRequest) string {
+	// map keys are sorted by json.Marshal, so the hash does not depend on iteration order
+	data, err := json.Marshal(struct {
+		Parameters    map[string]string
+		RequiredBytes int64
+		LimitBytes    int64
+		ContentSource string
+	}{
+		Parameters:    req.GetParameters(),
+		RequiredBytes: req.GetCapacityRange().GetRequiredBytes(),
+		LimitBytes:    req.GetCapacityRange().GetLimitBytes(),
+		ContentSource: getContentSourceID(req.GetVolumeContentSource()),
+	})
+	if err != nil {
+		klog.Warningf("failed to marshal CreateVolume request: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// checkContainerCreateRequest compares a repeated CreateVolume request with the request hash recorded in metadata of
+// the existing container, so that an incompatible request is rejected after createdVolumes is lost on controller restart,
+// the check is skipped if the container does not exist, does not record the hash or could not be read
+func (d *Driver) checkContainerCreateRequest(ctx context.Context, subsID, resourceGroupName, accountName, containerName, storageEndpointSuffix string, secrets map[string]string, volName, requestHash string) error {
+	metadata, err := d.getContainerMetadata(ctx, subsID, resourceGroupName, accountName, containerName, storageEndpointSuffix, secrets)
+	if err != nil {
+		klog.Warningf("failed to get metadata of container(%s) on account(%s) rg(%s), skip comparing CreateVolume request of volume(%s), error: %v", containerName, accountName, resourceGroupName, volName, err)
+		return nil
+	}
+	if recorded := metadata[createRequestMetadataKey]; recorded != "" && recorded != requestHash {
+		return status.Errorf(codes.AlreadyExists, "volume(%s) already exists with different parameters, capacity or content source", volName)
+	}
+	return nil
+}
+
+// getContainerMetadata returns metadata of the blob container, using data plane API if secrets are provided,
+// nil is returned if the container does not exist
+func (d *Driver) getContainerMetadata(ctx context.Context, subsID, resourceGroupName, accountName, containerName, storageEndpointSuffix string, secrets map[string]string) (map[string]string, error) {
+	if len(secrets) > 0 {
+		container, err := getContainerReference(containerName, secrets, d.getStorageEnvironment(storageEndpointSuffix))
+		if err != nil {
+			return nil, err
+		}
+		if exist, err := container.Exists(); err != nil || !exist {
+			return nil, err
+		}
+		if err := container.GetMetadata(nil); err != nil {
+			return nil, err
+		}
+		return container.Metadata, nil
+	}
+	if d.cloud.BlobClient == nil {
+		return nil, fmt.Errorf("BlobClient is nil")
+	}
+	blobContainer, rerr := d.cloud.BlobClient.GetContainer(ctx, subsID, resourceGroupName, accountName, containerName)
+	if rerr != nil {
+		if rerr.HTTPStatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, rerr.Error()
+	}
+	if blobContainer.ContainerProperties == nil || pointer.BoolDeref(blobContainer.ContainerProperties.Deleted, false) {
+		return nil, nil
+	}
+	metadata := make(map[string]string, len(blobContainer.ContainerProperties.Metadata))
+	for k, v := range blobContainer.ContainerProperties.Metadata {
+		metadata[k] = pointer.StringDeref(v, "")
+	}
+	return metadata, nil
+}
+
+// removeCreatedVolume removes the volume from createdVolumes once it's deleted
+func (d *Driver) removeCreatedVolume(volumeID string) {
+	if volName, ok := d.createdVolumeNames.LoadAndDelete(volumeID); ok {
+		d.createdVolumes.Delete(volName)
+	}
+}
+
+// getContentSourceID returns snapshot or volume ID of the content source
+func getContentSourceID(source *csi.VolumeContentSource) string {
+	if snapshot := source.GetSnapshot(); snapshot != nil {
+		return "snapshot:" + snapshot.GetSnapshotId()
+	}
+	if volume := source.GetVolume(); volume != nil {
+		return "volume:" + volume.GetVolumeId()
+	}
+	return ""
+}
+
+// DeleteVolume delete a volume
+func (d *Driver) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
+	volumeID := req.GetVolumeId()
+	if len(volumeID) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Volume ID missing in request")
+	}
+
+	if err := d.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME); err != nil {
+		return nil, status.Errorf(codes.Internal, "invalid delete volume req: %v", req)
+	}
+
+	if acquired := d.volumeOperationLimiter.TryAcquire(); !acquired {
+		return nil, status.Errorf(codes.Aborted, volumeOperationsExceededFmt, d.volumeOperationLimiter.max, volumeID)
+	}
+	defer d.volumeOperationLimiter.Release()
+
+	if acquired := d.volumeLocks.TryAcquire(volumeID); !acquired {
+		return nil, status.Errorf(codes.Aborted, volumeOperationAlreadyExistsFmt, volumeID)
+	}
+	defer d.volumeLocks.Release(volumeID)
+
+	resourceGroupName, accountName, containerName, secretNamespace, subsID, err := GetContainerInfo(volumeID)
+	if err != nil {
+		klog.ErrorS(err, "GetContainerInfo failed", volumeLogFields("DeleteVolume", volumeID, "", "")...)
+		if d.strictVolumeIDParsing {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid volume id(%s): %v", volumeID, err)
+		}
+		// According to CSI Driver Sanity Tester, should succeed when an invalid volume id is used
+		return &csi.DeleteVolumeResponse{}, nil
+	}
+
+	if getDeletePolicy(volumeID) == deletePolicyRetain {
+		klog.V(2).InfoS("skip deleting container since delete policy is "+deletePolicyRetain, volumeLogFields("DeleteVolume", volumeID, accountName, containerName, "resourceGroup", resourceGroupName)...)
+		d.removeCreatedVolume(volumeID)
+		return &csi.DeleteVolumeResponse{}, nil
+	}
+
+	secrets := req.GetSecrets()
+	if protocol := getProtocolFromVolumeID(volumeID); protocol == NFS {
+		// NFS volume does not use account key, always delete container with management API
+		klog.V(2).InfoS("skip account key retrieval", volumeLogFields("DeleteVolume", volumeID, accountName, containerName, "protocol", protocol)...)
+	} else if len(secrets) == 0 && d.useDataPlaneAPI(volumeID, accountName) {
+		_, accountName, accountKey, _, _, _, _, err := d.GetAuthEnv(ctx, volumeID, "", nil, secrets)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "GetAuthEnv(%s) failed with %v", volumeID, err)
+		}
+		if accountName != "" && accountKey != "" {
+			secrets = createStorageAccountSecret(accountName, accountKey)
+		}
+	}
+
+	mc := metrics.NewMetricContext(blobCSIDriverName, "controller_delete_volume", d.cloud.ResourceGroup, d.cloud.SubscriptionID, d.Name)
+	isOperationSucceeded := false
+	deleteType := deleteTypeUnknown
+	defer func() {
+		mc.ObserveOperationWithResult(isOperationSucceeded, VolumeID, volumeID, "delete_type", deleteType)
+	}()
+
+	if resourceGroupName == "" {
+		resourceGroupName = d.cloud.ResourceGroup
+	}
+	if len(secrets) == 0 {
+		// remove blob inventory rule before container deletion since the ownership is recorded in container metadata,
+		// container is not read if the volume is not created with enableBlobInventory
+		if isBlobInventoryVolumeID(volumeID) {
+			if err := d.removeOwnedBlobInventoryRule(ctx, subsID, resourceGroupName, accountName, containerName); err != nil {
+				return nil, status.Errorf(codes.Internal, "failed to remove blob inventory rule of container(%s) under rg(%s) account(%s) volumeID(%s), error: %v", containerName, resourceGroupName, accountName, volumeID, err)
+			}
+		}
+		if isLifecycleVolumeID(volumeID) {
+			if err := d.removeOwnedLifecycleRule(ctx, subsID, resourceGroupName, accountName, containerName); err != nil {
+				return nil, status.Errorf(codes.Internal, "failed to remove lifecycle rule of container(%s) under rg(%s) account(%s) volumeID(%s), error: %v", containerName, resourceGroupName, accountName, volumeID, err)
+			}
+		}
+		// a container with an immutability policy could not be deleted until the policy is deleted,
+		// while blobs under a locked policy could not be deleted until the retention period expires
+		if isImmutableVolumeID(volumeID) {
+			if err := d.deleteContainerImmutabilityPolicy(ctx, subsID, resourceGroupName, accountName, containerName); err != nil {
+				if errors.Is(err, errImmutabilityPolicyLocked) {
+					return nil, status.Errorf(codes.FailedPrecondition, "failed to delete container(%s) under rg(%s) account(%s) volumeID(%s) since it's protected by a locked immutability policy which could not be deleted, the container could only be deleted after the retention period of all blobs expires", containerName, resourceGroupName, accountName, volumeID)
+				}
+				return nil, status.Errorf(codes.Internal, "failed to delete immutability policy of container(%s) under rg(%s) account(%s) volumeID(%s), error: %v", containerName, resourceGroupName, accountName, volumeID, err)
+			}
+		}
+	}
+	deleteType = d.getContainerDeleteType(ctx, subsID, resourceGroupName, accountName, secrets)
+	klog.V(2).InfoS("deleting container", volumeLogFields("DeleteVolume", volumeID, accountName, containerName, "resourceGroup", resourceGroupName, "deleteType", deleteType)...)
+	csicommon.SendKubeEvent(v1.EventTypeNormal, csicommon.DeletingBlobContainer, csicommon.CSIEventSourceStr,
+		fmt.Sprintf("Controller DeleteVolume: Deleting container %s from %q storage account", containerName, accountName))
+	if err := d.DeleteBlobContainer(ctx, subsID, resourceGroupName, accountName, containerName, getStorageEndpointSuffixFromVolumeID(volumeID), secrets); err != nil {
+		if errors.Is(err, errDeleteMaxTotalDurationExceeded) {
+			// return a retriable code so that external-provisioner controls overall retry policy
+			return nil, status.Errorf(codes.DeadlineExceeded, "failed to delete container(%s) under rg(%s) account(%s) volumeID(%s), error: %v", containerName, resourceGroupName, accountName, volumeID, err)
+		}
+		if isContainerLegalHoldError(err) {
+			// legal hold is set by user, the container could only be deleted after all legal hold tags are cleared
+			return nil, status.Errorf(codes.FailedPrecondition, "failed to delete container(%s) under rg(%s) account(%s) volumeID(%s) since it has a legal hold, clear the legal hold on the container and the volume would be deleted on retry, error: %v", containerName, resourceGroupName, accountName, volumeID, err)
+		}
+		return nil, status.Errorf(codes.Internal, "failed to delete container(%s) under rg(%s) account(%s) volumeID(%s), error: %v", containerName, resourceGroupName, accountName, volumeID, err)
+	}
+	// repeated CreateVolume is only compared with the volume until the container is deleted
+	d.removeCreatedVolume(volumeID)
+
+	if secretNamespace != "" && len(req.GetSecrets()) == 0 {
+		// account key secret created by driver is deleted when it's not referenced by other volumes
+		// secret name is derived from the naming scheme recorded in volume id instead of the current driver flag
+		secretName := getAccountKeySecretName(accountName, containerName, isPerVolumeSecretVolumeID(volumeID))
+		if err := releaseAzureCredentials(ctx, d.cloud.KubeClient, secretName, secretNamespace, containerName); err != nil {
+			klog.Warningf("failed to release secret(%s) in namespace(%s) of volumeID(%s), error: %v", secretName, secretNamespace, volumeID, err)
+		}
+	}
+
+	isOperationSucceeded = true
+	deleteVolumeCount.WithLabelValues(deleteType).Inc()
+	klog.V(2).InfoS("container is deleted successfully", volumeLogFields("DeleteVolume", volumeID, accountName, containerName, "resourceGroup", resourceGroupName)...)
+	csicommon.SendKubeEvent(v1.EventTypeNormal, csicommon.DeletedBlobContainer, csicommon.CSIEventSourceStr,
+		fmt.Sprintf("Controller DeleteVolume: Deleted container %s from %q storage account", containerName, accountName))
+	return &csi.DeleteVolumeResponse{}, nil
+}
+
+// ValidateVolumeCapabilities return the capabilities of the volume
+func (d *Driver) ValidateVolumeCapabilities(ctx context.Context, req *csi.ValidateVolumeCapabilitiesRequest) (*csi.ValidateVolumeCapabilitiesResponse, error) {
+	volumeID := req.GetVolumeId()
+	if len(volumeID) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Volume ID missing in request")
+	}
+	if err := isValidVolumeCapabilities(req.GetVolumeCapabilities()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	resourceGroupName, accountName, containerName, _, subsID, err := GetContainerInfo(volumeID)
+	if err != nil {
+		klog.Errorf("GetContainerInfo(%s) in ValidateVolumeCapabilities failed with error: %v", volumeID, err)
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	var allowSoftDeleted bool
+	// protocol and useDataPlaneAPI are recorded in v2 volume id, and could be overridden by volume context or parameters
+	protocol := getProtocolFromVolumeID(volumeID)
+	useDataPlaneAPI := d.useDataPlaneAPI(volumeID, accountName)
+	for _, m := range []map[string]string{req.GetVolumeContext(), req.GetParameters()} {
+		for k, v := range m {
+			if strings.EqualFold(k, allowSoftDeletedField) {
+				if allowSoftDeleted, err = strconv.ParseBool(v); err != nil {
+					return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s", allowSoftDeletedField, v)
+				}
+			}
+			if strings.EqualFold(k, protocolField) && v != "" {
+				protocol = v
+			}
+			if strings.EqualFold(k, useDataPlaneAPIField) && v != "" {
+				useDataPlaneAPI = strings.EqualFold(v, trueValue)
+			}
+		}
+	}
+
+	var exist bool
+	secrets := req.GetSecrets()
+	if len(secrets) == 0 && useDataPlaneAPI {
+		_, accountName, accountKey, _, _, _, _, err := d.GetAuthEnv(ctx, volumeID, "", nil, secrets)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "GetAuthEnv(%s) failed with %v", volumeID, err)
+		}
+		if accountName != "" && accountKey != "" {
+			secrets = createStorageAccountSecret(accountName, accountKey)
+		}
+	}
+	if len(secrets) > 0 {
+		container, err := getContainerReference(containerName, secrets, d.getStorageEnvironment(getStorageEndpointSuffixFromVolumeID(volumeID)))
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		exist, err = container.Exists()
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	} else {
+		if resourceGroupName == "" {
+			resourceGroupName = d.cloud.ResourceGroup
+		}
+		blobContainer, retryErr := d.cloud.BlobClient.GetContainer(ctx, subsID, resourceGroupName, accountName, containerName)
+		err = retryErr.Error()
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		if blobContainer.ContainerProperties == nil {
+			return nil, status.Errorf(codes.Internal, "ContainerProperties of volume(%s) is nil", volumeID)
+		}
+		if allowSoftDeleted {
+			// soft deleted container could still be restored within retention period
+			exist = blobContainer.ContainerProperties.Deleted != nil
+		} else {
+			exist = blobContainer.ContainerProperties.Deleted != nil && !*blobContainer.ContainerProperties.Deleted
+		}
+	}
+	if !exist {
+		return nil, status.Errorf(codes.NotFound, "requested volume(%s) does not exist", volumeID)
+	}
+	if len(secrets) == 0 {
+		// account properties could only be read with management API
+		if msg := d.getProtocolIncompatibleMessage(ctx, subsID, resourceGroupName, accountName, protocol); msg != "" {
+			klog.V(2).Infof("ValidateVolumeCapabilities on volume(%s) is not confirmed: %s", volumeID, msg)
+			return &csi.ValidateVolumeCapabilitiesResponse{Message: msg}, nil
+		}
+	}
+	klog.V(2).Infof("ValidateVolumeCapabilities on volume(%s) succeeded", volumeID)
+
+	// blob driver supports all AccessModes, no need to check capabilities here
+	return &csi.ValidateVolumeCapabilitiesResponse{
+		Confirmed: &csi.ValidateVolumeCapabilitiesResponse_Confirmed{
+			VolumeCapabilities: req.GetVolumeCapabilities(),
+		},
+		Message: "",
+	}, nil
+}
+
+// getProtocolIncompatibleMessage returns the reason why the volume could not be mounted with the protocol on the account,
+// empty string is returned if the protocol is compatible with the account or the account properties could not be read
+func (d *Driver) getProtocolIncompatibleMessage(ctx context.Context, subsID, resourceGroupName, accountName, protocol string) string {
+	if protocol != NFS || d.cloud.StorageAccountClient == nil {
+		return ""
+	}
+	if subsID == "" {
+		subsID = d.cloud.SubscriptionID
+	}
+	account, rerr := d.cloud.StorageAccountClient.GetProperties(ctx, subsID, resourceGroupName, accountName)
+	if rerr != nil {
+		klog.Warningf("failed to get properties of account(%s) rg(%s), skip protocol check, error: %v", accountName, resourceGroupName, rerr.Error())
+		return ""
+	}
+	if account.AccountProperties == nil || !pointer.BoolDeref(account.AccountProperties.EnableNfsV3, false) {
+		return fmt.Sprintf("protocol(%s) is not supported since NFSv3 is not enabled on account(%s)", protocol, accountName)
+	}
+	return ""
+}
+
+func (d *Driver) ControllerPublishVolume(ctx context.Context, req *csi.ControllerPublishVolumeRequest) (*csi.ControllerPublishVolumeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "ControllerPublishVolume is not yet implemented")
+}
+
+func (d *Driver) ControllerUnpublishVolume(ctx context.Context, req *csi.ControllerUnpublishVolumeRequest) (*csi.ControllerUnpublishVolumeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "ControllerUnpublishVolume is not yet implemented")
+}
+
+// ControllerGetVolume returns condition of the container and capacity recorded in container metadata
+func (d *Driver) ControllerGetVolume(ctx context.Context, req *csi.ControllerGetVolumeRequest) (*csi.ControllerGetVolumeResponse, error) {
+	if err := d.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_GET_VOLUME); err != nil {
+		klog.Errorf("invalid get volume req: %v", req)
+		return nil, err
+	}
+	volumeID := req.GetVolumeId()
+	if len(volumeID) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Volume ID missing in request")
+	}
+	resourceGroupName, accountName, containerName, secretNamespace, subsID, err := GetContainerInfo(volumeID)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "invalid volume id(%s): %v", volumeID, err)
+	}
+	if resourceGroupName == "" {
+		resourceGroupName = d.cloud.ResourceGroup
+	}
+
+	var exists, deleted bool
+	var capacityBytes int64
+	if d.useDataPlaneAPI(volumeID, accountName) {
+		accountOptions := &azure.AccountOptions{
+			Name:                accountName,
+			ResourceGroup:       resourceGroupName,
+			SubscriptionID:      subsID,
+			GetLatestAccountKey: isLatestAccountKeyVolumeID(volumeID),
+		}
+		_, accountKey, err := d.GetStorageAccesskey(ctx, accountOptions, nil, "", secretNamespace, nil)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to GetStorageAccesskey on account(%s) rg(%s), error: %v", accountName, resourceGroupName, err)
+		}
+		container, err := getContainerReference(containerName, createStorageAccountSecret(accountName, accountKey), d.getStorageEnvironment(getStorageEndpointSuffixFromVolumeID(volumeID)))
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to get container(%s) reference on account(%s), error: %v", containerName, accountName, err)
+		}
+		if exists, err = container.Exists(); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to check existence of container(%s) on account(%s), error: %v", containerName, accountName, err)
+		}
+		if exists {
+			if err := container.GetMetadata(nil); err != nil {
+				klog.Warningf("failed to get metadata of container(%s) on account(%s), error: %v", containerName, accountName, err)
+			} else {
+				capacityBytes = parseCapacityMetadata(container.Metadata[capacityMetadataKey])
+			}
+		}
+	} else {
+		container, rerr := d.cloud.BlobClient.GetContainer(ctx, subsID, resourceGroupName, accountName, containerName)
+		if rerr != nil {
+			if !strings.Contains(rerr.Error().Error(), httpCodeNotFound) {
+				return nil, status.Errorf(codes.Internal, "failed to get container(%s) on account(%s) rg(%s), error: %v", containerName, accountName, resourceGroupName, rerr.Error())
+			}
+		} else {
+			exists = true
+			if container.ContainerProperties != nil {
+				deleted = pointer.BoolDeref(container.ContainerProperties.Deleted, false)
+				capacityBytes = parseCapacityMetadata(pointer.StringDeref(container.ContainerProperties.Metadata[capacityMetadataKey], ""))
+			}
+		}
+	}
+
+	condition := &csi.VolumeCondition{Message: fmt.Sprintf("container(%s) on account(%s) is available", containerName, accountName)}
+	if !exists {
+		condition = &csi.VolumeCondition{Abnormal: true, Message: fmt.Sprintf("container(%s) on account(%s) is not found", containerName, accountName)}
+	} else if deleted {
+		condition = &csi.VolumeCondition{Abnormal: true, Message: fmt.Sprintf("container(%s) on account(%s) is soft deleted", containerName, accountName)}
+	}
+	return &csi.ControllerGetVolumeResponse{
+		Volume: &csi.Volume{
+			VolumeId:      volumeID,
+			CapacityBytes: capacityBytes,
+		},
+		Status: &csi.ControllerGetVolumeResponse_VolumeStatus{
+			VolumeCondition: condition,
+		},
+	}, nil
+}
+
+// GetCapacity returns the remaining capacity of the storage account specified in parameters
+func (d *Driver) GetCapacity(ctx context.Context, req *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
+	if err := d.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_GET_CAPACITY); err != nil {
+		klog.Errorf("invalid get capacity req: %v", req)
+		return nil, err
+	}
+
+	var skuName, subsID, resourceGroup, accountName string
+	for k, v := range req.GetParameters() {
+		switch strings.ToLower(k) {
+		case skuNameField, storageAccountTypeField:
+			skuName = v
+		case subscriptionIDField:
+			subsID = v
+		case resourceGroupField:
+			resourceGroup = v
+		case storageAccountField:
+			accountName = v
+		}
+	}
+	if accountName == "" {
+		// storage account is created or matched in CreateVolume, remaining capacity is unknown
+		klog.V(4).Infof("GetCapacity: storage account is not specified in parameters(%v), return %d", req.GetParameters(), unknownCapacityBytes)
+		return &csi.GetCapacityResponse{AvailableCapacity: unknownCapacityBytes}, nil
+	}
+	if resourceGroup == "" {
+		resourceGroup = d.cloud.ResourceGroup
+	}
+
+	if skuName == "" {
+		if d.cloud.StorageAccountClient == nil {
+			return nil, status.Error(codes.Internal, "StorageAccountClient is nil")
+		}
+		account, rerr := d.cloud.StorageAccountClient.GetProperties(ctx, subsID, resourceGroup, accountName)
+		if rerr != nil {
+			if strings.Contains(rerr.Error().Error(), httpCodeNotFound) {
+				klog.Warningf("GetCapacity: storage account(%s) under rg(%s) is not found, return %d", accountName, resourceGroup, unknownCapacityBytes)
+				return &csi.GetCapacityResponse{AvailableCapacity: unknownCapacityBytes}, nil
+			}
+			return nil, status.Errorf(codes.Internal, "failed to get properties of storage account(%s) rg(%s), error: %v", accountName, resourceGroup, rerr.Error())
+		}
+		if account.Sku != nil {
+			skuName = string(account.Sku.Name)
+		}
+	}
+
+	client, err := d.getAccountMetricsClient(subsID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get metrics client, error: %v", err)
+	}
+	usedBytes, err := client.GetUsedCapacity(ctx, subsID, resourceGroup, accountName)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get used capacity of storage account(%s) rg(%s), error: %v", accountName, resourceGroup, err)
+	}
+	availableBytes := getAccountCapacityBytes(skuName) - usedBytes
+	if availableBytes < 0 {
+		availableBytes = 0
+	}
+	klog.V(4).Infof("GetCapacity: storage account(%s) rg(%s) sku(%s) used %d bytes, available %d bytes", accountName, resourceGroup, skuName, usedBytes, availableBytes)
+	return &csi.GetCapacityResponse{AvailableCapacity: availableBytes}, nil
+}
+
+// ListVolumes return all containers on storage accounts created by driver in the subscription
+func (d *Driver) ListVolumes(ctx context.Context, req *csi.ListVolumesRequest) (*csi.ListVolumesResponse, error) {
+	if err := d.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_LIST_VOLUMES); err != nil {
+		klog.Errorf("invalid list volumes req: %v", req)
+		return nil, err
+	}
+
+	subsID := d.cloud.SubscriptionID
+	accounts, err := d.listDriverAccounts(ctx, subsID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list storage accounts in subscription(%s), error: %v", subsID, err)
+	}
+
+	var entries []*csi.ListVolumesResponse_Entry
+	for _, account := range accounts {
+		resourceGroupName, accountName := account.resourceGroup, account.name
+		containers, err := d.listBlobContainers(ctx, subsID, resourceGroupName, accountName)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to list containers on account(%s) rg(%s), error: %v", accountName, resourceGroupName, err)
+		}
+		for _, container := range containers {
+			containerName := pointer.StringDeref(container.Name, "")
+			if containerName == "" || isSnapshotContainer(container.ContainerProperties) {
+				continue
+			}
+			var capacityBytes int64
+			if container.ContainerProperties != nil {
+				if pointer.BoolDeref(container.ContainerProperties.Deleted, false) {
+					continue
+				}
+				capacityBytes = parseCapacityMetadata(pointer.StringDeref(container.ContainerProperties.Metadata[capacityMetadataKey], ""))
+			}
+			// secret namespace is not recorded on the container, it's left empty in volume ID
+			volumeID := d.formatVolumeID(getVolumeIDOfContainer(resourceGroupName, accountName, containerName, "", subsID))
+			entries = append(entries, &csi.ListVolumesResponse_Entry{
+				Volume: &csi.Volume{
+					VolumeId:      volumeID,
+					CapacityBytes: capacityBytes,
+				},
+			})
+		}
+	}
+	// sort entries so that pagination is stable across calls
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Volume.VolumeId < entries[j].Volume.VolumeId
+	})
+
+	start, end, nextToken, err := getPageRange(len(entries), req.GetMaxEntries(), req.GetStartingToken())
+	if err != nil {
+		return nil, status.Error(codes.Aborted, err.Error())
+	}
+	return &csi.ListVolumesResponse{
+		Entries:   entries[start:end],
+		NextToken: nextToken,
+	}, nil
+}
+
+// CreateSnapshot create a snapshot by copying the source container to a snapshot container in the same account
+func (d *Driver) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequest) (*csi.CreateSnapshotResponse, error) {
+	if err := d.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT); err != nil {
+		klog.Errorf("invalid create snapshot req: %v", req)
+		return nil, err
+	}
+
+	snapshotName := req.GetName()
+	if len(snapshotName) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "CreateSnapshot Name must be provided")
+	}
+	sourceVolumeID := req.GetSourceVolumeId()
+	if len(sourceVolumeID) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "CreateSnapshot Source Volume ID must be provided")
+	}
+	resourceGroupName, accountName, srcContainerName, secretNamespace, subsID, err := GetContainerInfo(sourceVolumeID)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "invalid source volume id(%s): %v", sourceVolumeID, err)
+	}
+	// copy timeout could be set in VolumeSnapshotClass parameters the same way as in storage class
+	copyTimeout := waitForCopyTimeout
+	for k, v := range req.GetParameters() {
+		if strings.EqualFold(k, azcopyCopyTimeoutField) {
+			if copyTimeout, err = time.ParseDuration(v); err != nil || copyTimeout <= 0 {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s in snapshot class, should be a positive duration, e.g. 30m", azcopyCopyTimeoutField, v)
+			}
+		}
+	}
+
+	// snapshot container name is derived from snapshot name so that azcopy job of the same snapshot could be found on retry
+	snapshotContainerName := getSnapshotContainerName(srcContainerName, snapshotName)
+	if acquired := d.volumeLocks.TryAcquire(snapshotName); !acquired {
+		jobState, percent, _, err := d.azcopy.GetAzcopyJob(snapshotContainerName)
+		klog.V(2).Infof("azcopy job status: %s, copy percent: %s%%, error: %v", jobState, percent, err)
+		return nil, status.Errorf(codes.Aborted, volumeOperationAlreadyExistsFmt, snapshotName)
+	}
+	defer d.volumeLocks.Release(snapshotName)
+
+	var snapshotID string
+	mc := metrics.NewMetricContext(blobCSIDriverName, "controller_create_snapshot", d.cloud.ResourceGroup, d.cloud.SubscriptionID, d.Name)
+	isOperationSucceeded := false
+	defer func() {
+		mc.ObserveOperationWithResult(isOperationSucceeded, SnapshotID, snapshotID)
+	}()
+
+	if resourceGroupName == "" {
+		resourceGroupName = d.cloud.ResourceGroup
+	}
+	// snapshot container is created on the same endpoint as the source container, empty means the cloud default
+	storageEndpointSuffix := getStorageEndpointSuffixFromVolumeID(sourceVolumeID)
+	accountOptions := &azure.AccountOptions{
+		Name:                accountName,
+		ResourceGroup:       resourceGroupName,
+		SubscriptionID:      subsID,
+		GetLatestAccountKey: isLatestAccountKeyVolumeID(sourceVolumeID),
+	}
+	_, accountKey, err := d.GetStorageAccesskey(ctx, accountOptions, req.GetSecrets(), "", secretNamespace, nil)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to GetStorageAccesskey on account(%s) rg(%s), error: %v", accountName, resourceGroupName, err)
+	}
+
+	// size of the snapshot is the provisioned size of the source volume at the time of snapshot
+	sizeBytes := d.getContainerCapacityBytes(ctx, subsID, resourceGroupName, accountName, srcContainerName)
+
+	klog.V(2).Infof("begin to create snapshot container(%s) from container(%s) on account(%s) rg(%s)", snapshotContainerName, srcContainerName, accountName, resourceGroupName)
+	csicommon.SendKubeEvent(v1.EventTypeNormal, csicommon.CreatingBlobContainer, csicommon.CSIEventSourceStr,
+		fmt.Sprintf("Controller CreateSnapshot: Creating snapshot container %s from %s in %q storage account", snapshotContainerName, srcContainerName, accountName))
+	if err := d.copyBlobContainer(ctx, sourceVolumeID, accountName, accountKey, nil, snapshotContainerName, storageEndpointSuffix, false, 0, copyTimeout, false); err != nil {
+		return nil, err
+	}
+	// snapshot container is recognized by the metadata in ListVolumes and ListSnapshots
+	creationTime, sizeBytes, err := d.setSnapshotMetadata(ctx, subsID, resourceGroupName, accountName, snapshotContainerName, sourceVolumeID, sizeBytes)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to set metadata on snapshot container(%s) on account(%s) rg(%s), error: %v", snapshotContainerName, accountName, resourceGroupName, err)
+	}
+
+	snapshotID = getSnapshotID(resourceGroupName, accountName, snapshotContainerName, secretNamespace, subsID, storageEndpointSuffix)
+	isOperationSucceeded = true
+	klog.V(2).Infof("created snapshot container(%s) from container(%s) on account(%s) successfully", snapshotContainerName, srcContainerName, accountName)
+	csicommon.SendKubeEvent(v1.EventTypeNormal, csicommon.CreatedBlobContainer, csicommon.CSIEventSourceStr,
+		fmt.Sprintf("Controller CreateSnapshot: Created snapshot container %s in %q storage account", snapshotContainerName, accountName))
+	return &csi.CreateSnapshotResponse{
+		Snapshot: &csi.Snapshot{
+			SnapshotId:     snapshotID,
+			SourceVolumeId: sourceVolumeID,
+			SizeBytes:      sizeBytes,
+			CreationTime:   timestamppb.New(creationTime),
+			ReadyToUse:     true,
+		},
+	}, nil
+}
+
+// DeleteSnapshot delete the snapshot container created by CreateSnapshot
+func (d *Driver) DeleteSnapshot(ctx context.Context, req *csi.DeleteSnapshotRequest) (*csi.DeleteSnapshotResponse, error) {
+	snapshotID := req.GetSnapshotId()
+	if len(snapshotID) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Snapshot ID missing in request")
+	}
+
+	if err := d.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT); err != nil {
+		return nil, status.Errorf(codes.Internal, "invalid delete snapshot req: %v", req)
+	}
+
+	if acquired := d.volumeLocks.TryAcquire(snapshotID); !acquired {
+		return nil, status.Errorf(codes.Aborted, volumeOperationAlreadyExistsFmt, snapshotID)
+	}
+	defer d.volumeLocks.Release(snapshotID)
+
+	resourceGroupName, accountName, containerName, secretNamespace, subsID, err := GetSnapshotInfo(snapshotID)
+	if err != nil {
+		klog.Errorf("GetSnapshotInfo(%s) in DeleteSnapshot failed with error: %v", snapshotID, err)
+		if d.strictVolumeIDParsing {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid snapshot id(%s): %v", snapshotID, err)
+		}
+		// snapshot does not exist if snapshot id is invalid
+		return &csi.DeleteSnapshotResponse{}, nil
+	}
+
+	if resourceGroupName == "" {
+		resourceGroupName = d.cloud.ResourceGroup
+	}
+	secrets := req.GetSecrets()
+	if len(secrets) == 0 && d.useDataPlaneAPI(snapshotID, accountName) {
+		accountOptions := &azure.AccountOptions{
+			Name:           accountName,
+			ResourceGroup:  resourceGroupName,
+			SubscriptionID: subsID,
+		}
+		_, accountKey, err := d.GetStorageAccesskey(ctx, accountOptions, secrets, "", secretNamespace, nil)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to GetStorageAccesskey on account(%s) rg(%s), error: %v", accountName, resourceGroupName, err)
+		}
+		if accountKey != "" {
+			secrets = createStorageAccountSecret(accountName, accountKey)
+		}
+	}
+
+	mc := metrics.NewMetricContext(blobCSIDriverName, "controller_delete_snapshot", d.cloud.ResourceGroup, d.cloud.SubscriptionID, d.Name)
+	isOperationSucceeded := false
+	defer func() {
+		mc.ObserveOperationWithResult(isOperationSucceeded, SnapshotID, snapshotID)
+	}()
+
+	klog.V(2).Infof("deleting snapshot container(%s) rg(%s) account(%s) snapshotID(%s)", containerName, resourceGroupName, accountName, snapshotID)
+	csicommon.SendKubeEvent(v1.EventTypeNormal, csicommon.DeletingBlobContainer, csicommon.CSIEventSourceStr,
+		fmt.Sprintf("Controller DeleteSnapshot: Deleting snapshot container %s from %q storage account", containerName, accountName))
+	if err := d.DeleteBlobContainer(ctx, subsID, resourceGroupName, accountName, containerName, getStorageEndpointSuffixFromSnapshotID(snapshotID), secrets); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to delete snapshot container(%s) under rg(%s) account(%s) snapshotID(%s), error: %v", containerName, resourceGroupName, accountName, snapshotID, err)
+	}
+
+	isOperationSucceeded = true
+	klog.V(2).Infof("snapshot container(%s) under rg(%s) account(%s) snapshotID(%s) is deleted successfully", containerName, resourceGroupName, accountName, snapshotID)
+	csicommon.SendKubeEvent(v1.EventTypeNormal, csicommon.DeletedBlobContainer, csicommon.CSIEventSourceStr,
+		fmt.Sprintf("Controller DeleteSnapshot: Deleted snapshot container %s from %q storage account", containerName, accountName))
+	return &csi.DeleteSnapshotResponse{}, nil
+}
+
+// ListSnapshots list snapshot containers created by CreateSnapshot
+func (d *Driver) ListSnapshots(ctx context.Context, req *csi.ListSnapshotsRequest) (*csi.ListSnapshotsResponse, error) {
+	if err := d.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS); err != nil {
+		klog.Errorf("invalid list snapshots req: %v", req)
+		return nil, err
+	}
+
+	if snapshotID := req.GetSnapshotId(); snapshotID != "" {
+		resourceGroupName, accountName, containerName, secretNamespace, subsID, err := GetSnapshotInfo(snapshotID)
+		if err != nil {
+			klog.Warningf("GetSnapshotInfo(%s) in ListSnapshots failed with error: %v", snapshotID, err)
+			return &csi.ListSnapshotsResponse{}, nil
+		}
+		if resourceGroupName == "" {
+			resourceGroupName = d.cloud.ResourceGroup
+		}
+		container, rerr := d.cloud.BlobClient.GetContainer(ctx, subsID, resourceGroupName, accountName, containerName)
+		if rerr != nil {
+			if strings.Contains(rerr.Error().Error(), httpCodeNotFound) {
+				return &csi.ListSnapshotsResponse{}, nil
+			}
+			return nil, status.Errorf(codes.Internal, "failed to get snapshot container(%s) on account(%s) rg(%s), error: %v", containerName, accountName, resourceGroupName, rerr.Error())
+		}
+		if container.ContainerProperties != nil && pointer.BoolDeref(container.ContainerProperties.Deleted, false) {
+			return &csi.ListSnapshotsResponse{}, nil
+		}
+		snapshot := d.getSnapshotFromContainer(subsID, resourceGroupName, accountName, containerName, secretNamespace, container.ContainerProperties)
+		snapshot.SnapshotId = snapshotID
+		if req.GetSourceVolumeId() != "" && !isSameSourceContainer(snapshot.SourceVolumeId, req.GetSourceVolumeId()) {
+			return &csi.ListSnapshotsResponse{}, nil
+		}
+		return &csi.ListSnapshotsResponse{
+			Entries: []*csi.ListSnapshotsResponse_Entry{{Snapshot: snapshot}},
+		}, nil
+	}
+
+	var subsID, secretNamespace string
+	var accounts []accountRef
+	if sourceVolumeID := req.GetSourceVolumeId(); sourceVolumeID != "" {
+		resourceGroupName, accountName, _, namespace, subscriptionID, err := GetContainerInfo(sourceVolumeID)
+		if err != nil {
+			klog.Warningf("GetContainerInfo(%s) in ListSnapshots failed with error: %v", sourceVolumeID, err)
+			return &csi.ListSnapshotsResponse{}, nil
+		}
+		if resourceGroupName == "" {
+			resourceGroupName = d.cloud.ResourceGroup
+		}
+		subsID, secretNamespace = subscriptionID, namespace
+		accounts = append(accounts, accountRef{resourceGroup: resourceGroupName, name: accountName})
+	} else {
+		subsID = d.cloud.SubscriptionID
+		var err error
+		if accounts, err = d.listDriverAccounts(ctx, subsID); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to list storage accounts in subscription(%s), error: %v", subsID, err)
+		}
+	}
+
+	var entries []*csi.ListSnapshotsResponse_Entry
+	for _, account := range accounts {
+		resourceGroupName, accountName := account.resourceGroup, account.name
+		containers, err := d.listBlobContainers(ctx, subsID, resourceGroupName, accountName)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to list containers on account(%s) rg(%s), error: %v", accountName, resourceGroupName, err)
+		}
+		for _, container := range containers {
+			containerName := pointer.StringDeref(container.Name, "")
+			if !isSnapshotContainer(container.ContainerProperties) || pointer.BoolDeref(container.ContainerProperties.Deleted, false) {
+				continue
+			}
+			snapshot := d.getSnapshotFromContainer(subsID, resourceGroupName, accountName, containerName, secretNamespace, container.ContainerProperties)
+			if req.GetSourceVolumeId() != "" && !isSameSourceContainer(snapshot.SourceVolumeId, req.GetSourceVolumeId()) {
+				continue
+			}
+			entries = append(entries, &csi.ListSnapshotsResponse_Entry{Snapshot: snapshot})
+		}
+	}
+	// sort entries so that pagination is stable across calls
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Snapshot.SnapshotId < entries[j].Snapshot.SnapshotId
+	})
+
+	start, end, nextToken, err := getPageRange(len(entries), req.GetMaxEntries(), req.GetStartingToken())
+	if err != nil {
+		return nil, status.Error(codes.Aborted, err.Error())
+	}
+	return &csi.ListSnapshotsResponse{
+		Entries:   entries[start:end],
+		NextToken: nextToken,
+	}, nil
+}
+
+// ControllerGetCapabilities returns the capabilities of the Controller plugin
+func (d *Driver) ControllerGetCapabilities(ctx context.Context, req *csi.ControllerGetCapabilitiesRequest) (*csi.ControllerGetCapabilitiesResponse, error) {
+	return &csi.ControllerGetCapabilitiesResponse{
+		Capabilities: d.Cap,
+	}, nil
+}
+
+// ControllerExpandVolume controller expand volume
+func (d *Driver) ControllerExpandVolume(ctx context.Context, req *csi.ControllerExpandVolumeRequest) (*csi.ControllerExpandVolumeResponse, error) {
+	if len(req.GetVolumeId()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Volume ID missing in request")
+	}
+
+	if req.GetCapacityRange() == nil {
+		return nil, status.Error(codes.InvalidArgument, "Capacity Range missing in request")
+	}
+
+	if err := d.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_EXPAND_VOLUME); err != nil {
+		return nil, status.Errorf(codes.Internal, "invalid expand volume req: %v", req)
+	}
+
+	volSizeBytes := int64(req.GetCapacityRange().GetRequiredBytes())
+	requestGiB := int64(util.RoundUpGiB(volSizeBytes))
+
+	if volSizeBytes > containerMaxSize {
+		return nil, status.Errorf(codes.OutOfRange, "required bytes (%d) exceeds the maximum supported bytes (%d)", volSizeBytes, containerMaxSize)
+	}
+
+	if _, _, _, _, _, err := GetContainerInfo(req.GetVolumeId()); err != nil {
+		// volume handle of a statically provisioned volume may not be in the format of volume id created by driver
+		klog.Warningf("skip setting quota(%d Gi) in container metadata of volume(%s), error: %v", requestGiB, req.VolumeId, err)
+	} else if protocol := getProtocolFromVolumeID(req.GetVolumeId()); protocol == NFS {
+		// NFS volume does not use account key, container metadata could not be written through data plane API
+		klog.Warningf("skip setting quota(%d Gi) in container metadata of %s volume(%s)", requestGiB, protocol, req.VolumeId)
+	} else if err := d.setContainerQuota(ctx, req.GetVolumeId(), req.GetSecrets(), volSizeBytes); err != nil {
+		if !isContainerMetadataUnsupportedError(err) {
+			return nil, status.Errorf(codes.Internal, "failed to set quota(%d Gi) in container metadata of volume(%s), error: %v", requestGiB, req.VolumeId, err)
+		}
+		// e.g. shared key access is disabled or data plane is not reachable from controller through public endpoint
+		klog.Warningf("skip setting quota(%d Gi) in container metadata of volume(%s) since account does not allow metadata writes from controller, error: %v", requestGiB, req.VolumeId, err)
+	}
+
+	klog.V(2).Infof("ControllerExpandVolume(%s) successfully, currentQuota: %d Gi", req.VolumeId, requestGiB)
+
+	return &csi.ControllerExpandVolumeResponse{CapacityBytes: req.GetCapacityRange().GetRequiredBytes()}, nil
+}
+
+// isContainerMetadataUnsupportedError returns whether container metadata could not be written since the account
+// does not allow it with account key from controller, other errors are regarded as transient
+func isContainerMetadataUnsupportedError(err error) bool {
+	var storageErr azstorage.AzureStorageServiceError
+	if errors.As(err, &storageErr) {
+		return storageErr.StatusCode == http.StatusUnauthorized || storageErr.StatusCode == http.StatusForbidden
+	}
+	var detailedErr autorest.DetailedError
+	if errors.As(err, &detailedErr) {
+		return detailedErr.StatusCode == http.StatusUnauthorized || detailedErr.StatusCode == http.StatusForbidden
+	}
+	// account key lookup returns errors of management API in string
+	return strings.Contains(err.Error(), httpCodeForbidden) || strings.Contains(err.Error(), authorizationFailed)
+}
+
+// setContainerQuota records quota and capacity of the volume in container metadata through data plane API,
+// so that the quota could be read at mount time
+func (d *Driver) setContainerQuota(ctx context.Context, volumeID string, secrets map[string]string, capacityBytes int64) error {
+	resourceGroupName, accountName, containerName, secretNamespace, subsID, err := GetContainerInfo(volumeID)
+	if err != nil {
+		return err
+	}
+	if resourceGroupName == "" {
+		resourceGroupName = d.cloud.ResourceGroup
+	}
+	if len(secrets) == 0 {
+		accountOptions := &azure.AccountOptions{
+			Name:                accountName,
+			ResourceGroup:       resourceGroupName,
+			SubscriptionID:      subsID,
+			GetLatestAccountKey: isLatestAccountKeyVolumeID(volumeID),
+		}
+		_, accountKey, err := d.GetStorageAccesskey(ctx, accountOptions, nil, "", secretNamespace, nil)
+		if err != nil {
+			return err
+		}
+		secrets = createStorageAccountSecret(accountName, accountKey)
+	}
+	container, err := getContainerReference(containerName, secrets, d.getStorageEnvironment(getStorageEndpointSuffixFromVolumeID(volumeID)))
+	if err != nil {
+		return err
+	}
+	// SetMetadata replaces all metadata of the container, get existing metadata first
+	if err := container.GetMetadata(nil); err != nil {
+		return err
+	}
+	if container.Metadata == nil {
+		container.Metadata = map[string]string{}
+	}
+	container.Metadata[quotaMetadataKey] = strconv.FormatInt(util.RoundUpGiB(capacityBytes), 10)
+	if d.enableListVolumes {
+		container.Metadata[capacityMetadataKey] = strconv.FormatInt(capacityBytes, 10)
+	}
+	return container.SetMetadata(nil)
+}
+
+// CreateBlobContainer creates a blob container
+// accessLevel is the public access level of the container(None, Blob or Container, case insensitive, None if empty),
+// it's mapped to the access type of the data plane or management API whichever is used
+// default encryption scope is applied to the container if encryptionScope is not empty
+// soft deleted container with the same name is restored through management API if restoreDeleted is true
+// cloud default storage endpoint suffix is used with secrets if storageEndpointSuffix is empty
+func (d *Driver) CreateBlobContainer(ctx context.Context, subsID, resourceGroupName, accountName, containerName, storageEndpointSuffix string, secrets, metadata map[string]string, accessLevel, encryptionScope string, restoreDeleted bool) error {
+	if containerName == "" {
+		return fmt.Errorf("containerName is empty")
+	}
+	publicAccess, err := getContainerPublicAccess(accessLevel)
+	if err != nil {
+		return err
+	}
+	return wait.ExponentialBackoff(d.cloud.RequestBackoff(), func() (bool, error) {
+		var err error
+		if len(secrets) > 0 && encryptionScope != "" {
+			// legacy storage client does not support encryption scope
+			err = d.createContainerWithEncryptionScope(ctx, containerName, storageEndpointSuffix, secrets, metadata, publicAccess, encryptionScope)
+		} else if len(secrets) > 0 {
+			container, getErr := getContainerReference(containerName, secrets, d.getStorageEnvironment(storageEndpointSuffix))
+			if getErr != nil {
+				return true, getErr
+			}
+			container.Metadata = metadata
+			_, err = container.CreateIfNotExists(&azstorage.CreateContainerOptions{Access: getContainerAccessType(publicAccess)})
+		} else {
+			blobContainer := storage.BlobContainer{
+				ContainerProperties: &storage.ContainerProperties{
+					PublicAccess: publicAccess,
+				},
+			}
+			if encryptionScope != "" {
+				blobContainer.ContainerProperties.DefaultEncryptionScope = pointer.String(encryptionScope)
+				blobContainer.ContainerProperties.DenyEncryptionScopeOverride = pointer.Bool(true)
+			}
+			if len(metadata) > 0 {
+				blobContainer.ContainerProperties.Metadata = make(map[string]*string, len(metadata))
+				for k, v := range metadata {
+					blobContainer.ContainerProperties.Metadata[k] = pointer.String(v)
+				}
+			}
+			err = d.cloud.BlobClient.CreateContainer(ctx, subsID, resourceGroupName, accountName, containerName, blobContainer).Error()
+		}
+		if restoreDeleted && isContainerBeingDeletedError(err) && len(secrets) == 0 {
+			// container with the same name is retained by soft delete policy, restore it instead of waiting for the deletion,
+			// data in the deleted container is restored as well
+			restored, restoreErr := d.restoreDeletedContainer(ctx, subsID, resourceGroupName, accountName, containerName, storageEndpointSuffix)
+			if restoreErr != nil {
+				klog.Warningf("restoreDeletedContainer(%s, %s, %s) failed with error(%v)", resourceGroupName, accountName, containerName, restoreErr)
+			} else if restored {
+				csicommon.SendKubeEvent(v1.EventTypeNormal, csicommon.RestoredBlobContainer, csicommon.CSIEventSourceStr,
+					fmt.Sprintf("Controller CreateVolume: Restored soft deleted blob container %s with its data in %q storage account instead of creating a new one", containerName, accountName))
+				return true, nil
+			}
+		}
+		if isRetriableError(err) {
+			klog.Warningf("CreateContainer(%s, %s, %s) failed with error(%v), retry", resourceGroupName, accountName, containerName, err)
+			return false, nil
+		}
+		return true, err
+	})
+}
+
+// createContainerWithEncryptionScope creates a container with default encryption scope through data plane API,
+// all writes in the container are encrypted with the encryption scope
+func (d *Driver) createContainerWithEncryptionScope(ctx context.Context, containerName, storageEndpointSuffix string, secrets, metadata map[string]string, publicAccess storage.PublicAccess, encryptionScope string) error {
+	accountName, accountKey, err := getStorageAccount(secrets)
+	if err != nil {
+		return err
+	}
+	credential, err := azblob.NewSharedKeyCredential(accountName, accountKey)
+	if err != nil {
+		return err
+	}
+	if storageEndpointSuffix == "" {
+		storageEndpointSuffix = d.getStorageEndpointSuffix()
+	}
+	containerClient, err := container.NewClientWithSharedKeyCredential(fmt.Sprintf("%s/%s", getBlobEndpoint(accountName, storageEndpointSuffix), containerName), credential, nil)
+	if err != nil {
+		return err
+	}
+	return createContainer(ctx, containerClient, metadata, publicAccess, encryptionScope)
+}
+
+// createContainerWithTokenCredential creates container on data plane with Azure AD token credential, e.g. of workload identity
+func createContainerWithTokenCredential(ctx context.Context, credential azcore.TokenCredential, accountName, storageEndpointSuffix, containerName string, metadata map[string]string, accessLevel, encryptionScope string) error {
+	publicAccess, err := getContainerPublicAccess(accessLevel)
+	if err != nil {
+		return err
+	}
+	containerClient, err := container.NewClient(fmt.Sprintf("%s/%s", getBlobEndpoint(accountName, storageEndpointSuffix), containerName), credential, nil)
+	if err != nil {
+		return err
+	}
+	return createContainer(ctx, containerClient, metadata, publicAccess, encryptionScope)
+}
+
+// createContainer creates container with track2 client, it's not an error if the container already exists
+func createContainer(ctx context.Context, containerClient *container.Client, metadata map[string]string, publicAccess storage.PublicAccess, encryptionScope string) error {
+	options := &container.CreateOptions{
+		Metadata: metadata,
+	}
+	if encryptionScope != "" {
+		options.CpkScopeInfo = &container.CpkScopeInfo{
+			DefaultEncryptionScope:         pointer.String(encryptionScope),
+			PreventEncryptionScopeOverride: pointer.Bool(true),
+		}
+	}
+	options.Access = getPublicAccessType(publicAccess)
+	if _, err := containerClient.Create(ctx, options); err != nil && !strings.Contains(err.Error(), containerAlreadyExists) {
+		return err
+	}
+	return nil
+}
+
+// restoreDeletedContainer restores the latest soft deleted version of the container,
+// returns false if there is no soft deleted version of the container
+func (d *Driver) restoreDeletedContainer(ctx context.Context, subsID, resourceGroupName, accountName, containerName, storageEndpointSuffix string) (bool, error) {
+	client, err := d.getBlobContainersClient(subsID)
+	if err != nil {
+		return false, err
+	}
+	page, err := client.List(ctx, resourceGroupName, accountName, "", "", storage.ListContainersIncludeDeleted)
+	if err != nil {
+		return false, err
+	}
+	var deletedVersion string
+	for page.NotDone() {
+		for _, c := range page.Values() {
+			if pointer.StringDeref(c.Name, "") == containerName && c.ContainerProperties != nil &&
+				pointer.BoolDeref(c.ContainerProperties.Deleted, false) && c.ContainerProperties.Version != nil {
+				deletedVersion = *c.ContainerProperties.Version
+			}
+		}
+		if err := page.NextWithContext(ctx); err != nil {
+			return false, err
+		}
+	}
+	if deletedVersion == "" {
+		return false, nil
+	}
+
+	// restore is only supported by data plane API
+	accountKey, err := d.cloud.GetStorageAccesskey(ctx, subsID, accountName, resourceGroupName, false)
+	if err != nil {
+		return false, err
+	}
+	restorer := d.containerRestorer
+	if restorer == nil {
+		restorer = &sharedKeyContainerRestorer{}
+	}
+	if storageEndpointSuffix == "" {
+		storageEndpointSuffix = d.getStorageEndpointSuffix()
+	}
+	klog.V(2).Infof("restoring soft deleted container(%s) version(%s) on account(%s)", containerName, deletedVersion, accountName)
+	if err := restorer.Restore(ctx, accountName, accountKey, storageEndpointSuffix, containerName, deletedVersion); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// containerRestorer restores a soft deleted container
+type containerRestorer interface {
+	Restore(ctx context.Context, accountName, accountKey, storageEndpointSuffix, containerName, deletedVersion string) error
+}
+
+// sharedKeyContainerRestorer restores a soft deleted container through data plane API with account key
+type sharedKeyContainerRestorer struct{}
+
+func (r *sharedKeyContainerRestorer) Restore(ctx context.Context, accountName, accountKey, storageEndpointSuffix, containerName, deletedVersion string) error {
+	credential, err := azblob.NewSharedKeyCredential(accountName, accountKey)
+	if err != nil {
+		return err
+	}
+	containerClient, err := container.NewClientWithSharedKeyCredential(fmt.Sprintf("%s/%s", getBlobEndpoint(accountName, storageEndpointSuffix), containerName), credential, nil)
+	if err != nil {
+		return err
+	}
+	_, err = containerClient.Restore(ctx, deletedVersion, nil)
+	return err
+}
+
+// DeleteBlobContainer deletes a blob container
+// cloud default storage endpoint suffix is used with secrets if storageEndpointSuffix is empty
+func (d *Driver) DeleteBlobContainer(ctx context.Context, subsID, resourceGroupName, accountName, containerName, storageEndpointSuffix string, secrets map[string]string) error {
+	if containerName == "" {
+		return fmt.Errorf("containerName is empty")
+	}
+	var lastErr error
+	deleteContainer := func() (bool, error) {
+		var err error
+		if len(secrets) > 0 {
+			container, getErr := getContainerReference(containerName, secrets, d.getStorageEnvironment(storageEndpointSuffix))
+			if getErr != nil {
+				return true, getErr
+			}
+			_, err = container.DeleteIfExists(nil)
+		} else {
+			err = d.cloud.BlobClient.DeleteContainer(ctx, subsID, resourceGroupName, accountName, containerName).Error()
+		}
+		if err != nil {
+			if isContainerBeingDeletedError(err) ||
+				strings.Contains(err.Error(), statusCodeNotFound) ||
+				strings.Contains(err.Error(), httpCodeNotFound) {
+				klog.Warningf("delete container(%s) on account(%s) failed with error(%v), return as success", containerName, accountName, err)
+				return true, nil
+			}
+			if isAccountNotFoundError(err) {
+				klog.Warningf("delete container(%s) on account(%s) failed with error(%v), return as success since account or resource group does not exist", containerName, accountName, err)
+				return true, nil
+			}
+			if d.deleteMaxTotalDuration > 0 && isRetriableError(err) {
+				klog.Warningf("delete container(%s) on account(%s) failed with error(%v), waiting for retrying", containerName, accountName, err)
+				lastErr = err
+				return false, nil
+			}
+			return false, fmt.Errorf("failed to delete container(%s) on account(%s), error: %w", containerName, accountName, err)
+		}
+		return true, err
+	}
+	if d.deleteMaxTotalDuration <= 0 {
+		return wait.ExponentialBackoff(d.cloud.RequestBackoff(), deleteContainer)
+	}
+
+	// retries are bounded by wall-clock time only, backoff steps only grow the interval which is clamped to the remaining time
+	backoff := d.cloud.RequestBackoff()
+	backoff.Steps = math.MaxInt32
+	if backoff.Duration <= 0 {
+		backoff.Duration = defaultDeleteRetryInterval
+	}
+	startTime := time.Now()
+	deadline := startTime.Add(d.deleteMaxTotalDuration)
+	for {
+		done, err := deleteContainer()
+		if done || err != nil {
+			return err
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("%w: delete container(%s) on account(%s) has been retried for %v, error: %v", errDeleteMaxTotalDurationExceeded, containerName, accountName, time.Since(startTime), lastErr)
+		}
+		interval := backoff.Step()
+		if interval > remaining {
+			interval = remaining
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return fmt.Errorf("failed to delete container(%s) on account(%s), error: %w", containerName, accountName, ctx.Err())
+		}
+	}
+}
+
+// waitForContainerReady polls until the blob container is visible or timeout
+func (d *Driver) waitForContainerReady(ctx context.Context, subsID, resourceGroupName, accountName, containerName, storageEndpointSuffix string, secrets map[string]string, timeout time.Duration) error {
+	return wait.PollImmediate(waitForContainerReadyInterval, timeout, func() (bool, error) {
+		exist, err := d.containerExists(ctx, subsID, resourceGroupName, accountName, containerName, storageEndpointSuffix, secrets)
+		if err != nil {
+			klog.Warningf("check container(%s) on account(%s) existence failed with error(%v), waiting for retrying", containerName, accountName, err)
+			return false, nil
+		}
+		return exist, nil
+	})
+}
+
+// checkSecretOwnerReclaimPolicy refuses setting the PVC as owner of the account key secret when the storage class of
+// the PVC retains the PV, the secret would be garbage collected with the PVC while the retained PV still references it
+func (d *Driver) checkSecretOwnerReclaimPolicy(ctx context.Context, pvcNamespace, pvcName string) error {
+	if d.cloud.KubeClient == nil {
+		// account key could not be stored in secret either
+		return nil
+	}
+	pvc, err := d.cloud.KubeClient.CoreV1().PersistentVolumeClaims(pvcNamespace).Get(ctx, pvcName, metav1.GetOptions{})
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to get pvc(%s) in namespace(%s), error: %v", pvcName, pvcNamespace, err)
+	}
+	storageClassName := pointer.StringDeref(pvc.Spec.StorageClassName, "")
+	if storageClassName == "" {
+		return nil
+	}
+	storageClass, err := d.cloud.KubeClient.StorageV1().StorageClasses().Get(ctx, storageClassName, metav1.GetOptions{})
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to get storage class(%s) of pvc(%s) in namespace(%s), error: %v", storageClassName, pvcName, pvcNamespace, err)
+	}
+	if storageClass.ReclaimPolicy != nil && *storageClass.ReclaimPolicy == v1.PersistentVolumeReclaimRetain {
+		return status.Errorf(codes.InvalidArgument, "%s could not be true when reclaimPolicy of storage class(%s) is %s", setSecretOwnerReferenceField, storageClassName, v1.PersistentVolumeReclaimRetain)
+	}
+	return nil
+}
+
+// setSecretOwnerReference sets the PVC as owner of the per-volume account key secret in the same namespace,
+// so that the secret is garbage collected after the PVC is deleted
+func (d *Driver) setSecretOwnerReference(ctx context.Context, secretName, namespace, pvcName string) error {
+	if d.cloud.KubeClient == nil {
+		return fmt.Errorf("kubeClient is nil")
+	}
+	pvc, err := d.cloud.KubeClient.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, pvcName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	owner := metav1.OwnerReference{
+		APIVersion: "v1",
+		Kind:       "PersistentVolumeClaim",
+		Name:       pvc.Name,
+		UID:        pvc.UID,
+	}
+	if err := addSecretOwnerReference(ctx, d.cloud.KubeClient, secretName, namespace, owner); err != nil {
+		return err
+	}
+	klog.V(2).Infof("set pvc(%s) as owner of secret(%s) in namespace(%s)", pvcName, secretName, namespace)
+	return nil
+}
+
+// containerExists checks whether the blob container exists, using data plane API if secrets are provided
+// cloud default storage endpoint suffix is used with secrets if storageEndpointSuffix is empty
+func (d *Driver) containerExists(ctx context.Context, subsID, resourceGroupName, accountName, containerName, storageEndpointSuffix string, secrets map[string]string) (bool, error) {
+	if len(secrets) > 0 {
+		container, err := getContainerReference(containerName, secrets, d.getStorageEnvironment(storageEndpointSuffix))
+		if err != nil {
+			return false, err
+		}
+		return container.Exists()
+	}
+	blobContainer, rerr := d.cloud.BlobClient.GetContainer(ctx, subsID, resourceGroupName, accountName, containerName)
+	if rerr != nil {
+		return false, rerr.Error()
+	}
+	if blobContainer.ContainerProperties == nil {
+		return false, nil
+	}
+	return !pointer.BoolDeref(blobContainer.ContainerProperties.Deleted, false), nil
+}
+
+// getContainerDeleteType returns whether container deletion on the account is a soft delete or a hard delete
+// according to container soft delete policy of the account, it's unknown when data plane API is used,
+// the policy is cached per account so that blob service properties are not read on every deletion
+func (d *Driver) getContainerDeleteType(ctx context.Context, subsID, resourceGroupName, accountName string, secrets map[string]string) string {
+	if len(secrets) > 0 || d.cloud.BlobClient == nil {
+		return deleteTypeUnknown
+	}
+	cacheKey := fmt.Sprintf("%s/%s/%s", subsID, resourceGroupName, accountName)
+	if cache, err := d.containerDeleteTypeCache.Get(cacheKey, azcache.CacheReadTypeDefault); err == nil && cache != nil {
+		return cache.(string)
+	}
+	property, err := d.cloud.BlobClient.GetServiceProperties(ctx, subsID, resourceGroupName, accountName)
+	if err != nil {
+		klog.Warningf("failed to get blob service properties of account(%s) rg(%s), error: %v", accountName, resourceGroupName, err)
+		return deleteTypeUnknown
+	}
+	deleteType := deleteTypeHard
+	if property.BlobServicePropertiesProperties != nil && property.BlobServicePropertiesProperties.ContainerDeleteRetentionPolicy != nil {
+		policy := property.BlobServicePropertiesProperties.ContainerDeleteRetentionPolicy
+		if pointer.BoolDeref(policy.Enabled, false) {
+			klog.V(2).Infof("container soft delete is enabled on account(%s), deleted container would be retained for %d days", accountName, pointer.Int32Deref(policy.Days, 0))
+			deleteType = deleteTypeSoft
+		}
+	}
+	d.containerDeleteTypeCache.Set(cacheKey, deleteType)
+	return deleteType
+}
+
+// checkAccountSku checks whether sku of the existing storage account matches the requested sku,
+// on mismatch, a warning event is sent in warn mode and error is returned in fail mode,
+// properties of the account are returned so that callers could reuse them, nil if they could not be fetched
+func (d *Driver) checkAccountSku(ctx context.Context, subsID, resourceGroupName, accountName, skuName, onSkuMismatch string) (*storage.Account, error) {
+	if d.cloud.StorageAccountClient == nil {
+		return nil, status.Errorf(codes.Internal, "StorageAccountClient is nil")
+	}
+	if subsID == "" {
+		subsID = d.cloud.SubscriptionID
+	}
+	account, rerr := d.cloud.StorageAccountClient.GetProperties(ctx, subsID, resourceGroupName, accountName)
+	if rerr != nil {
+		if onSkuMismatch == skuMismatchFail {
+			return nil, status.Errorf(codes.Internal, "failed to get properties of account(%s) rg(%s), error: %v", accountName, resourceGroupName, rerr.Error())
+		}
+		klog.Warningf("failed to get properties of account(%s) rg(%s), skip sku check, error: %v", accountName, resourceGroupName, rerr.Error())
+		return nil, nil
+	}
+	if account.Sku == nil || account.Sku.Name == "" {
+		klog.V(4).Infof("sku of account(%s) is unknown, skip sku check", accountName)
+		return &account, nil
+	}
+	if strings.EqualFold(string(account.Sku.Name), skuName) {
+		return &account, nil
+	}
+	msg := fmt.Sprintf("sku(%s) of existing account(%s) rg(%s) does not match requested sku(%s)", account.Sku.Name, accountName, resourceGroupName, skuName)
+	if onSkuMismatch == skuMismatchFail {
+		return nil, status.Errorf(codes.FailedPrecondition, "%s", msg)
+	}
+	klog.Warning(msg)
+	csicommon.SendKubeEvent(v1.EventTypeWarning, csicommon.StorageAccountSkuMismatch, csicommon.CSIEventSourceStr, msg)
+	return &account, nil
+}
+
+// ensureBlobVersioning makes sure blob versioning is enabled on an existing storage account,
+// versioning would be enabled if --enable-blob-versioning-on-reuse is set, otherwise return error
+func (d *Driver) ensureBlobVersioning(ctx context.Context, subsID, resourceGroupName, accountName string) error {
+	property, err := d.cloud.BlobClient.GetServiceProperties(ctx, subsID, resourceGroupName, accountName)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to get blob service properties of account(%s) rg(%s), error: %v", accountName, resourceGroupName, err)
+	}
+	if property.BlobServicePropertiesProperties != nil && pointer.BoolDeref(property.BlobServicePropertiesProperties.IsVersioningEnabled, false) {
+		return nil
+	}
+	if !d.enableBlobVersioningOnReuse {
+		return status.Errorf(codes.FailedPrecondition, "blob versioning is not enabled on existing account(%s) rg(%s), enable it on the account or set --enable-blob-versioning-on-reuse to enable it automatically", accountName, resourceGroupName)
+	}
+
+	klog.V(2).Infof("enable blob versioning on existing account(%s) rg(%s)", accountName, resourceGroupName)
+	if property.BlobServicePropertiesProperties == nil {
+		property.BlobServicePropertiesProperties = &storage.BlobServicePropertiesProperties{}
+	}
+	property.BlobServicePropertiesProperties.IsVersioningEnabled = pointer.Bool(true)
+	result, err := d.cloud.BlobClient.SetServiceProperties(ctx, subsID, resourceGroupName, accountName, property)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to enable blob versioning on account(%s) rg(%s), error: %v", accountName, resourceGroupName, err)
+	}
+	if result.BlobServicePropertiesProperties == nil || !pointer.BoolDeref(result.BlobServicePropertiesProperties.IsVersioningEnabled, false) {
+		return status.Errorf(codes.Internal, "blob versioning is still not enabled on account(%s) rg(%s) after update", accountName, resourceGroupName)
+	}
+	return nil
+}
+
+// ensureChangeFeed enables blob change feed on the storage account with the retention days if it's not enabled yet,
+// nil retentionDays means change feed is retained infinitely
+func (d *Driver) ensureChangeFeed(ctx context.Context, subsID, resourceGroupName, accountName string, retentionDays *int32) error {
+	property, err := d.cloud.BlobClient.GetServiceProperties(ctx, subsID, resourceGroupName, accountName)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to get blob service properties of account(%s) rg(%s), error: %v", accountName, resourceGroupName, err)
+	}
+	if property.BlobServicePropertiesProperties == nil {
+		property.BlobServicePropertiesProperties = &storage.BlobServicePropertiesProperties{}
+	}
+	changeFeed := property.BlobServicePropertiesProperties.ChangeFeed
+	if changeFeed != nil && pointer.BoolDeref(changeFeed.Enabled, false) && pointer.Int32Deref(changeFeed.RetentionInDays, 0) == pointer.Int32Deref(retentionDays, 0) {
+		return nil
+	}
+	klog.V(2).Infof("enable change feed with retention days(%d) on account(%s) rg(%s)", pointer.Int32Deref(retentionDays, 0), accountName, resourceGroupName)
+	property.BlobServicePropertiesProperties.ChangeFeed = &storage.ChangeFeed{
+		Enabled:         pointer.Bool(true),
+		RetentionInDays: retentionDays,
+	}
+	if _, err := d.cloud.BlobClient.SetServiceProperties(ctx, subsID, resourceGroupName, accountName, property); err != nil {
+		return status.Errorf(codes.Internal, "failed to enable change feed on account(%s) rg(%s), error: %v", accountName, resourceGroupName, err)
+	}
+	return nil
+}
+
+// ensureLastAccessTimeTracking enables last access time tracking on the storage account if it's not enabled yet,
+// so that lifecycle management policies could tier or delete blobs based on last access time
+func (d *Driver) ensureLastAccessTimeTracking(ctx context.Context, subsID, resourceGroupName, accountName string) error {
+	property, err := d.cloud.BlobClient.GetServiceProperties(ctx, subsID, resourceGroupName, accountName)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to get blob service properties of account(%s) rg(%s), error: %v", accountName, resourceGroupName, err)
+	}
+	if property.BlobServicePropertiesProperties == nil {
+		property.BlobServicePropertiesProperties = &storage.BlobServicePropertiesProperties{}
+	}
+	policy := property.BlobServicePropertiesProperties.LastAccessTimeTrackingPolicy
+	if policy != nil && pointer.BoolDeref(policy.Enable, false) {
+		return nil
+	}
+	klog.V(2).Infof("enable last access time tracking on account(%s) rg(%s)", accountName, resourceGroupName)
+	property.BlobServicePropertiesProperties.LastAccessTimeTrackingPolicy = &storage.LastAccessTimeTrackingPolicy{
+		Enable: pointer.Bool(true),
+		Name:   storage.NameAccessTimeTracking,
+	}
+	if _, err := d.cloud.BlobClient.SetServiceProperties(ctx, subsID, resourceGroupName, accountName, property); err != nil {
+		return status.Errorf(codes.Internal, "failed to enable last access time tracking on account(%s) rg(%s), error: %v", accountName, resourceGroupName, err)
+	}
+	return nil
+}
+
+// disableSoftDeletePolicies disables blob and/or container soft delete policy on the storage account if they are enabled,
+// storage account matched by EnsureStorageAccount may have the policies enabled since 0 days is regarded as not specified
+func (d *Driver) disableSoftDeletePolicies(ctx context.Context, subsID, resourceGroupName, accountName string, disableBlobs, disableContainers bool) error {
+	property, err := d.cloud.BlobClient.GetServiceProperties(ctx, subsID, resourceGroupName, accountName)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to get blob service properties of account(%s) rg(%s), error: %v", accountName, resourceGroupName, err)
+	}
+	if property.BlobServicePropertiesProperties == nil {
+		property.BlobServicePropertiesProperties = &storage.BlobServicePropertiesProperties{}
+	}
+	props := property.BlobServicePropertiesProperties
+	updated := false
+	if disableBlobs && props.DeleteRetentionPolicy != nil && pointer.BoolDeref(props.DeleteRetentionPolicy.Enabled, false) {
+		props.DeleteRetentionPolicy = &storage.DeleteRetentionPolicy{Enabled: pointer.Bool(false)}
+		updated = true
+	}
+	if disableContainers && props.ContainerDeleteRetentionPolicy != nil && pointer.BoolDeref(props.ContainerDeleteRetentionPolicy.Enabled, false) {
+		props.ContainerDeleteRetentionPolicy = &storage.DeleteRetentionPolicy{Enabled: pointer.Bool(false)}
+		updated = true
+	}
+	if !updated {
+		return nil
+	}
+	klog.V(2).Infof("disable soft delete policies(blobs: %v, containers: %v) on account(%s) rg(%s)", disableBlobs, disableContainers, accountName, resourceGroupName)
+	if _, err := d.cloud.BlobClient.SetServiceProperties(ctx, subsID, resourceGroupName, accountName, property); err != nil {
+		return status.Errorf(codes.Internal, "failed to disable soft delete policies on account(%s) rg(%s), error: %v", accountName, resourceGroupName, err)
+	}
+	return nil
+}
+
+// accountSettings holds storage account settings which are not supported by EnsureStorageAccount,
+// they are only set on the storage account created by driver for the same settings, see ensureStorageAccountWithSettings
+type accountSettings struct {
+	defaultToOAuthAuthentication *bool
+	minimumTLSVersion            storage.MinimumTLSVersion
+	allowedIPRanges              []string
+	networkDefaultAction         storage.DefaultAction
+	disableSoftDeleteBlobs       bool
+	disableSoftDeleteContainers  bool
+	enableChangeFeed             bool
+	changeFeedRetentionDays      *int32
+	enableLastAccessTimeTracking bool
+}
+
+// isEmpty returns whether no account setting is specified
+func (s *accountSettings) isEmpty() bool {
+	return s.key() == ""
+}
+
+// key returns the settings in string format, empty if no setting is specified
+func (s *accountSettings) key() string {
+	var parts []string
+	if s.defaultToOAuthAuthentication != nil {
+		parts = append(parts, fmt.Sprintf("oauth=%v", *s.defaultToOAuthAuthentication))
+	}
+	if s.minimumTLSVersion != "" {
+		parts = append(parts, fmt.Sprintf("tls=%s", s.minimumTLSVersion))
+	}
+	if len(s.allowedIPRanges) > 0 {
+		ipRanges := append([]string{}, s.allowedIPRanges...)
+		sort.Strings(ipRanges)
+		parts = append(parts, fmt.Sprintf("ip=%s", strings.Join(ipRanges, ",")))
+	}
+	if s.networkDefaultAction != "" {
+		parts = append(parts, fmt.Sprintf("action=%s", s.networkDefaultAction))
+	}
+	if s.disableSoftDeleteBlobs {
+		parts = append(parts, "nosoftdeleteblobs")
+	}
+	if s.disableSoftDeleteContainers {
+		parts = append(parts, "nosoftdeletecontainers")
+	}
+	if s.enableChangeFeed {
+		parts = append(parts, fmt.Sprintf("changefeed=%d", pointer.Int32Deref(s.changeFeedRetentionDays, 0)))
+	}
+	if s.enableLastAccessTimeTracking {
+		parts = append(parts, "lastaccesstime")
+	}
+	return strings.Join(parts, ";")
+}
+
+// names returns storage class parameter names of the specified settings in the same order as key
+func (s *accountSettings) names() []string {
+	settings := []struct {
+		name      string
+		specified bool
+	}{
+		{"defaultToOAuthAuthentication", s.defaultToOAuthAuthentication != nil},
+		{"minimumTlsVersion", s.minimumTLSVersion != ""},
+		{"allowedIpRanges", len(s.allowedIPRanges) > 0},
+		{"networkDefaultAction", s.networkDefaultAction != ""},
+		{"disabling softDeleteBlobs", s.disableSoftDeleteBlobs},
+		{"disabling softDeleteContainers", s.disableSoftDeleteContainers},
+		{"enableChangeFeed", s.enableChangeFeed},
+		{"enableLastAccessTimeTracking", s.enableLastAccessTimeTracking},
+	}
+	var names []string
+	for _, setting := range settings {
+		if setting.specified {
+			names = append(names, setting.name)
+		}
+	}
+	return names
+}
+
+// applyAccountSettings sets account settings on the storage account, settings which are already set are skipped
+func (d *Driver) applyAccountSettings(ctx context.Context, subsID, resourceGroupName, accountName string, s *accountSettings) error {
+	if s.defaultToOAuthAuthentication != nil {
+		if err := d.setDefaultToOAuthAuthentication(ctx, subsID, resourceGroupName, accountName, *s.defaultToOAuthAuthentication); err != nil {
+			return status.Errorf(codes.Internal, "failed to set defaultToOAuthAuthentication(%v) on account(%s) rg(%s), error: %v", *s.defaultToOAuthAuthentication, accountName, resourceGroupName, err)
+		}
+	}
+	if s.minimumTLSVersion != "" {
+		if err := d.setMinimumTLSVersion(ctx, subsID, resourceGroupName, accountName, s.minimumTLSVersion); err != nil {
+			return status.Errorf(codes.Internal, "failed to set minimumTlsVersion(%s) on account(%s) rg(%s), error: %v", s.minimumTLSVersion, accountName, resourceGroupName, err)
+		}
+	}
+	if len(s.allowedIPRanges) > 0 {
+		if err := d.setAccountIPRules(ctx, subsID, resourceGroupName, accountName, s.allowedIPRanges); err != nil {
+			return status.Errorf(codes.Internal, "failed to set allowedIpRanges(%v) on account(%s) rg(%s), error: %v", s.allowedIPRanges, accountName, resourceGroupName, err)
+		}
+	}
+	if s.networkDefaultAction != "" {
+		if err := d.setNetworkDefaultAction(ctx, subsID, resourceGroupName, accountName, s.networkDefaultAction); err != nil {
+			return status.Errorf(codes.Internal, "failed to set networkDefaultAction(%s) on account(%s) rg(%s), error: %v", s.networkDefaultAction, accountName, resourceGroupName, err)
+		}
+	}
+	if s.disableSoftDeleteBlobs || s.disableSoftDeleteContainers {
+		if err := d.disableSoftDeletePolicies(ctx, subsID, resourceGroupName, accountName, s.disableSoftDeleteBlobs, s.disableSoftDeleteContainers); err != nil {
+			return err
+		}
+	}
+	if s.enableChangeFeed {
+		if err := d.ensureChangeFeed(ctx, subsID, resourceGroupName, accountName, s.changeFeedRetentionDays); err != nil {
+			return err
+		}
+	}
+	if s.enableLastAccessTimeTracking {
+		if err := d.ensureLastAccessTimeTracking(ctx, subsID, resourceGroupName, accountName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setDefaultToOAuthAuthentication updates the default authentication method of the storage account if necessary
+func (d *Driver) setDefaultToOAuthAuthentication(ctx context.Context, subsID, resourceGroupName, accountName string, enabled bool) error {
+	if d.cloud.StorageAccountClient == nil {
+		return fmt.Errorf("StorageAccountClient is nil")
+	}
+	if subsID == "" {
+		subsID = d.cloud.SubscriptionID
+	}
+	account, rerr := d.cloud.StorageAccountClient.GetProperties(ctx, subsID, resourceGroupName, accountName)
+	if rerr != nil {
+		return rerr.Error()
+	}
+	if account.AccountProperties != nil && pointer.BoolDeref(account.AccountProperties.DefaultToOAuthAuthentication, false) == enabled {
+		klog.V(4).Infof("defaultToOAuthAuthentication(%v) is already set on account(%s)", enabled, accountName)
+		return nil
+	}
+	klog.V(2).Infof("set defaultToOAuthAuthentication(%v) on account(%s) rg(%s)", enabled, accountName, resourceGroupName)
+	parameters := storage.AccountUpdateParameters{
+		AccountPropertiesUpdateParameters: &storage.AccountPropertiesUpdateParameters{
+			DefaultToOAuthAuthentication: pointer.Bool(enabled),
+		},
+	}
+	if rerr := d.cloud.StorageAccountClient.Update(ctx, subsID, resourceGroupName, accountName, parameters); rerr != nil {
+		return rerr.Error()
+	}
+	return nil
+}
+
+// setMinimumTLSVersion updates the minimum TLS version of requests to the storage account if necessary
+func (d *Driver) setMinimumTLSVersion(ctx context.Context, subsID, resourceGroupName, accountName string, version storage.MinimumTLSVersion) error {
+	if d.cloud.StorageAccountClient == nil {
+		return fmt.Errorf("StorageAccountClient is nil")
+	}
+	if subsID == "" {
+		subsID = d.cloud.SubscriptionID
+	}
+	account, rerr := d.cloud.StorageAccountClient.GetProperties(ctx, subsID, resourceGroupName, accountName)
+	if rerr != nil {
+		return rerr.Error()
+	}
+	if account.AccountProperties != nil && account.AccountProperties.MinimumTLSVersion == version {
+		klog.V(4).Infof("minimumTlsVersion(%s) is already set on account(%s)", version, accountName)
+		return nil
+	}
+	klog.V(2).Infof("set minimumTlsVersion(%s) on account(%s) rg(%s)", version, accountName, resourceGroupName)
+	parameters := storage.AccountUpdateParameters{
+		AccountPropertiesUpdateParameters: &storage.AccountPropertiesUpdateParameters{
+			MinimumTLSVersion: version,
+		},
+	}
+	if rerr := d.cloud.StorageAccountClient.Update(ctx, subsID, resourceGroupName, accountName, parameters); rerr != nil {
+		return rerr.Error()
+	}
+	return nil
+}
+
+// setAccountIPRules adds IP rules to the network rule set of the storage account if they do not exist,
+// existing rules are kept and default action is set as deny so that only allowed networks could access the account
+func (d *Driver) setAccountIPRules(ctx context.Context, subsID, resourceGroupName, accountName string, ipRanges []string) error {
+	if d.cloud.StorageAccountClient == nil {
+		return fmt.Errorf("StorageAccountClient is nil")
+	}
+	if subsID == "" {
+		subsID = d.cloud.SubscriptionID
+	}
+	account, rerr := d.cloud.StorageAccountClient.GetProperties(ctx, subsID, resourceGroupName, accountName)
+	if rerr != nil {
+		return rerr.Error()
+	}
+	ruleSet := storage.NetworkRuleSet{}
+	if account.AccountProperties != nil && account.AccountProperties.NetworkRuleSet != nil {
+		ruleSet = *account.AccountProperties.NetworkRuleSet
+	}
+	var ipRules []storage.IPRule
+	if ruleSet.IPRules != nil {
+		ipRules = *ruleSet.IPRules
+	}
+	updated := ruleSet.DefaultAction != storage.DefaultActionDeny
+	for _, ipRange := range ipRanges {
+		found := false
+		for _, rule := range ipRules {
+			if pointer.StringDeref(rule.IPAddressOrRange, "") == ipRange {
+				found = true
+				break
+			}
+		}
+		if !found {
+			ipRules = append(ipRules, storage.IPRule{IPAddressOrRange: pointer.String(ipRange), Action: storage.ActionAllow})
+			updated = true
+		}
+	}
+	if !updated {
+		klog.V(4).Infof("allowedIpRanges(%v) are already set on account(%s)", ipRanges, accountName)
+		return nil
+	}
+	klog.V(2).Infof("set allowedIpRanges(%v) on account(%s) rg(%s)", ipRanges, accountName, resourceGroupName)
+	ruleSet.IPRules = &ipRules
+	ruleSet.DefaultAction = storage.DefaultActionDeny
+	parameters := storage.AccountUpdateParameters{
+		AccountPropertiesUpdateParameters: &storage.AccountPropertiesUpdateParameters{
+			NetworkRuleSet: &ruleSet,
+		},
+	}
+	if rerr := d.cloud.StorageAccountClient.Update(ctx, subsID, resourceGroupName, accountName, parameters); rerr != nil {
+		return rerr.Error()
+	}
+	return nil
+}
+
+// setNetworkDefaultAction updates the default action of the network rule set of the storage account if necessary,
+// existing vnet and IP rules are kept
+func (d *Driver) setNetworkDefaultAction(ctx context.Context, subsID, resourceGroupName, accountName string, action storage.DefaultAction) error {
+	if d.cloud.StorageAccountClient == nil {
+		return fmt.Errorf("StorageAccountClient is nil")
+	}
+	if subsID == "" {
+		subsID = d.cloud.SubscriptionID
+	}
+	account, rerr := d.cloud.StorageAccountClient.GetProperties(ctx, subsID, resourceGroupName, accountName)
+	if rerr != nil {
+		return rerr.Error()
+	}
+	ruleSet := storage.NetworkRuleSet{}
+	if account.AccountProperties != nil && account.AccountProperties.NetworkRuleSet != nil {
+		ruleSet = *account.AccountProperties.NetworkRuleSet
+	}
+	if ruleSet.DefaultAction == action {
+		klog.V(4).Infof("networkDefaultAction(%s) is already set on account(%s)", action, accountName)
+		return nil
+	}
+	klog.V(2).Infof("set networkDefaultAction(%s) on account(%s) rg(%s)", action, accountName, resourceGroupName)
+	ruleSet.DefaultAction = action
+	parameters := storage.AccountUpdateParameters{
+		AccountPropertiesUpdateParameters: &storage.AccountPropertiesUpdateParameters{
+			NetworkRuleSet: &ruleSet,
+		},
+	}
+	if rerr := d.cloud.StorageAccountClient.Update(ctx, subsID, resourceGroupName, accountName, parameters); rerr != nil {
+		return rerr.Error()
+	}
+	return nil
+}
+
+// blobContainersClient is the subset of storage.BlobContainersClient used by driver
+type blobContainersClient interface {
+	List(ctx context.Context, resourceGroupName string, accountName string, maxpagesize string, filter string, include storage.ListContainersInclude) (storage.ListContainerItemsPage, error)
+	Update(ctx context.Context, resourceGroupName string, accountName string, containerName string, blobContainer storage.BlobContainer) (storage.BlobContainer, error)
+	CreateOrUpdateImmutabilityPolicy(ctx context.Context, resourceGroupName string, accountName string, containerName string, parameters *storage.ImmutabilityPolicy, ifMatch string) (storage.ImmutabilityPolicy, error)
+	GetImmutabilityPolicy(ctx context.Context, resourceGroupName string, accountName string, containerName string, ifMatch string) (storage.ImmutabilityPolicy, error)
+	DeleteImmutabilityPolicy(ctx context.Context, resourceGroupName string, accountName string, containerName string, ifMatch string) (storage.ImmutabilityPolicy, error)
+}
+
+// getBlobContainersClient returns a blob containers client of the subscription
+func (d *Driver) getBlobContainersClient(subsID string) (blobContainersClient, error) {
+	if d.blobContainersClient != nil {
+		return d.blobContainersClient, nil
+	}
+	if subsID == "" {
+		subsID = d.cloud.SubscriptionID
+	}
+	authorizer, err := d.getManagementToken()
+	if err != nil {
+		return nil, err
+	}
+	client := storage.NewBlobContainersClientWithBaseURI(d.cloud.Environment.ResourceManagerEndpoint, subsID)
+	client.Authorizer = authorizer
+	return client, nil
+}
+
+// setContainerImmutabilityPolicy sets an unlocked time-based retention immutability policy on the container through management API,
+// the policy could be locked by user afterwards for compliance
+func (d *Driver) setContainerImmutabilityPolicy(ctx context.Context, subsID, resourceGroupName, accountName, containerName string, days int32) error {
+	client, err := d.getBlobContainersClient(subsID)
+	if err != nil {
+		return err
+	}
+	policy := &storage.ImmutabilityPolicy{
+		ImmutabilityPolicyProperty: &storage.ImmutabilityPolicyProperty{
+			ImmutabilityPeriodSinceCreationInDays: pointer.Int32(days),
+		},
+	}
+	_, err = client.CreateOrUpdateImmutabilityPolicy(ctx, resourceGroupName, accountName, containerName, policy, "")
+	return err
+}
+
+// deleteContainerImmutabilityPolicy deletes the unlocked immutability policy of the container with its ETag,
+// errImmutabilityPolicyLocked is returned if the policy is locked since a locked policy could not be deleted
+func (d *Driver) deleteContainerImmutabilityPolicy(ctx context.Context, subsID, resourceGroupName, accountName, containerName string) error {
+	client, err := d.getBlobContainersClient(subsID)
+	if err != nil {
+		return err
+	}
+	policy, err := client.GetImmutabilityPolicy(ctx, resourceGroupName, accountName, containerName, "")
+	if err != nil {
+		var detailedErr autorest.DetailedError
+		if errors.As(err, &detailedErr) && detailedErr.StatusCode == http.StatusNotFound {
+			klog.V(2).Infof("immutability policy of container(%s) under rg(%s) account(%s) not found", containerName, resourceGroupName, accountName)
+			return nil
+		}
+		return err
+	}
+	if policy.ImmutabilityPolicyProperty == nil || pointer.StringDeref(policy.Etag, "") == "" {
+		return nil
+	}
+	if policy.ImmutabilityPolicyProperty.State == storage.ImmutabilityPolicyStateLocked {
+		return errImmutabilityPolicyLocked
+	}
+	_, err = client.DeleteImmutabilityPolicy(ctx, resourceGroupName, accountName, containerName, *policy.Etag)
+	return err
+}
+
+// storageAccountsClient is the subset of storage.AccountsClient used by driver
+type storageAccountsClient interface {
+	List(ctx context.Context) (storage.AccountListResultPage, error)
+}
+
+// getStorageAccountsClient returns a storage accounts client of the subscription
+func (d *Driver) getStorageAccountsClient(subsID string) (storageAccountsClient, error) {
+	if d.storageAccountsClient != nil {
+		return d.storageAccountsClient, nil
+	}
+	if subsID == "" {
+		subsID = d.cloud.SubscriptionID
+	}
+	authorizer, err := d.getManagementToken()
+	if err != nil {
+		return nil, err
+	}
+	client := storage.NewAccountsClientWithBaseURI(d.cloud.Environment.ResourceManagerEndpoint, subsID)
+	client.Authorizer = authorizer
+	return client, nil
+}
+
+// accountRef refers to a storage account in a resource group
+type accountRef struct {
+	resourceGroup string
+	name          string
+}
+
+// listDriverAccounts lists storage accounts created by driver across resource groups of the subscription through management API page by page,
+// accounts tagged with another cluster name are skipped, accounts configured by --list-volumes-storage-accounts in driver resource group are always included
+func (d *Driver) listDriverAccounts(ctx context.Context, subsID string) ([]accountRef, error) {
+	accounts := map[accountRef]bool{}
+	for _, name := range d.listVolumesAccounts {
+		accounts[accountRef{resourceGroup: d.cloud.ResourceGroup, name: name}] = true
+	}
+
+	client, err := d.getStorageAccountsClient(subsID)
+	if err != nil {
+		return nil, err
+	}
+	page, err := client.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for page.NotDone() {
+		for _, account := range page.Values() {
+			if account.Name == nil || account.ID == nil || pointer.StringDeref(account.Tags[consts.CreatedByTag], "") != "azure" {
+				continue
+			}
+			if d.clusterName != "" && pointer.StringDeref(account.Tags[clusterNameTagKey], d.clusterName) != d.clusterName {
+				continue
+			}
+			resource, err := az.ParseResourceID(*account.ID)
+			if err != nil {
+				klog.Warningf("failed to parse resource id(%s) of storage account(%s), error: %v", *account.ID, *account.Name, err)
+				continue
+			}
+			accounts[accountRef{resourceGroup: resource.ResourceGroup, name: *account.Name}] = true
+		}
+		if err := page.NextWithContext(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	var result []accountRef
+	for account := range accounts {
+		result = append(result, account)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].resourceGroup != result[j].resourceGroup {
+			return result[i].resourceGroup < result[j].resourceGroup
+		}
+		return result[i].name < result[j].name
+	})
+	return result, nil
+}
+
+// listBlobContainers lists all blob containers in the account through management API
+func (d *Driver) listBlobContainers(ctx context.Context, subsID, resourceGroupName, accountName string) ([]storage.ListContainerItem, error) {
+	client, err := d.getBlobContainersClient(subsID)
+	if err != nil {
+		return nil, err
+	}
+	page, err := client.List(ctx, resourceGroupName, accountName, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+	var containers []storage.ListContainerItem
+	for page.NotDone() {
+		containers = append(containers, page.Values()...)
+		if err := page.NextWithContext(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return containers, nil
+}
+
+// setSnapshotMetadata records source volume, creation time and size in snapshot container metadata if not recorded,
+// returns creation time and size of the snapshot
+func (d *Driver) setSnapshotMetadata(ctx context.Context, subsID, resourceGroupName, accountName, containerName, sourceVolumeID string, sizeBytes int64) (time.Time, int64, error) {
+	now := time.Now()
+	if d.cloud.BlobClient == nil {
+		return now, sizeBytes, fmt.Errorf("BlobClient is nil")
+	}
+	container, rerr := d.cloud.BlobClient.GetContainer(ctx, subsID, resourceGroupName, accountName, containerName)
+	if rerr != nil {
+		return now, sizeBytes, rerr.Error()
+	}
+	metadata := map[string]*string{}
+	if container.ContainerProperties != nil && container.ContainerProperties.Metadata != nil {
+		metadata = container.ContainerProperties.Metadata
+		if creationTime, err := time.Parse(time.RFC3339, pointer.StringDeref(metadata[snapshotTimeMetadataKey], "")); err == nil {
+			return creationTime, parseCapacityMetadata(pointer.StringDeref(metadata[capacityMetadataKey], "")), nil
+		}
+	}
+	metadata[snapshotSourceMetadataKey] = pointer.String(sourceVolumeID)
+	metadata[snapshotTimeMetadataKey] = pointer.String(now.UTC().Format(time.RFC3339))
+	if sizeBytes > 0 {
+		metadata[capacityMetadataKey] = pointer.String(strconv.FormatInt(sizeBytes, 10))
+	}
+
+	client, err := d.getBlobContainersClient(subsID)
+	if err != nil {
+		return now, sizeBytes, err
+	}
+	_, err = client.Update(ctx, resourceGroupName, accountName, containerName, storage.BlobContainer{
+		ContainerProperties: &storage.ContainerProperties{Metadata: metadata},
+	})
+	return now, sizeBytes, err
+}
+
+// getContainerCapacityBytes returns provisioned capacity recorded in container metadata, quota in GiB is used
+// if capacity is not recorded, returns 0 if neither is recorded, e.g. for static provisioned volumes
+func (d *Driver) getContainerCapacityBytes(ctx context.Context, subsID, resourceGroupName, accountName, containerName string) int64 {
+	if d.cloud.BlobClient == nil {
+		return 0
+	}
+	container, rerr := d.cloud.BlobClient.GetContainer(ctx, subsID, resourceGroupName, accountName, containerName)
+	if rerr != nil {
+		klog.Warningf("failed to get container(%s) on account(%s) rg(%s), error: %v", containerName, accountName, resourceGroupName, rerr.Error())
+		return 0
+	}
+	if container.ContainerProperties == nil {
+		return 0
+	}
+	metadata := container.ContainerProperties.Metadata
+	if capacityBytes := parseCapacityMetadata(pointer.StringDeref(metadata[capacityMetadataKey], "")); capacityBytes > 0 {
+		return capacityBytes
+	}
+	return parseCapacityMetadata(pointer.StringDeref(metadata[quotaMetadataKey], "")) * util.GiB
+}
+
+// isSnapshotContainer returns whether the container is a snapshot container tagged in CreateSnapshot
+func isSnapshotContainer(properties *storage.ContainerProperties) bool {
+	return properties != nil && pointer.StringDeref(properties.Metadata[snapshotSourceMetadataKey], "") != ""
+}
+
+// getSnapshotFromContainer returns snapshot of the snapshot container, source volume, size and creation time are read from
+// container metadata, creation time is derived from last modified time if metadata does not exist
+func (d *Driver) getSnapshotFromContainer(subsID, resourceGroupName, accountName, containerName, secretNamespace string, properties *storage.ContainerProperties) *csi.Snapshot {
+	var metadata map[string]*string
+	if properties != nil {
+		metadata = properties.Metadata
+	}
+	sourceVolumeID := pointer.StringDeref(metadata[snapshotSourceMetadataKey], "")
+	if sourceVolumeID != "" && secretNamespace == "" {
+		_, _, _, secretNamespace, _, _ = GetContainerInfo(sourceVolumeID) //nolint:dogsled
+	}
+	// snapshot container is on the same endpoint as the source container
+	storageEndpointSuffix := getStorageEndpointSuffixFromVolumeID(sourceVolumeID)
+
+	var creationTime *timestamppb.Timestamp
+	if t, err := time.Parse(time.RFC3339, pointer.StringDeref(metadata[snapshotTimeMetadataKey], "")); err == nil {
+		creationTime = timestamppb.New(t)
+	} else if properties != nil && properties.LastModifiedTime != nil {
+		creationTime = timestamppb.New(properties.LastModifiedTime.Time)
+	}
+
+	return &csi.Snapshot{
+		SnapshotId:     getSnapshotID(resourceGroupName, accountName, containerName, secretNamespace, subsID, storageEndpointSuffix),
+		SourceVolumeId: sourceVolumeID,
+		SizeBytes:      parseCapacityMetadata(pointer.StringDeref(metadata[capacityMetadataKey], "")),
+		CreationTime:   creationTime,
+		ReadyToUse:     true,
+	}
+}
+
+// isSameSourceContainer checks whether two volume IDs refer to the same container
+func isSameSourceContainer(volumeID1, volumeID2 string) bool {
+	_, account1, container1, _, _, err1 := GetContainerInfo(volumeID1) //nolint:dogsled
+	_, account2, container2, _, _, err2 := GetContainerInfo(volumeID2) //nolint:dogsled
+	return err1 == nil && err2 == nil && account1 == account2 && container1 == container2
+}
+
+// parseCapacityMetadata returns capacity in bytes recorded in container metadata, 0 is returned if it's not recorded
+func parseCapacityMetadata(value string) int64 {
+	capacityBytes, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return capacityBytes
+}
+
+// getPageRange returns [start, end) of the current page and the token of the next page,
+// starting token is the index of the first entry of the page
+func getPageRange(total int, maxEntries int32, startingToken string) (int, int, string, error) {
+	start := 0
+	if startingToken != "" {
+		var err error
+		if start, err = strconv.Atoi(startingToken); err != nil || start < 0 || start > total {
+			return 0, 0, "", fmt.Errorf("invalid starting token(%s), total entries: %d", startingToken, total)
+		}
+	}
+	if maxEntries < 0 {
+		return 0, 0, "", fmt.Errorf("invalid max entries(%d)", maxEntries)
+	}
+	end := total
+	if maxEntries > 0 && start+int(maxEntries) < total {
+		end = start + int(maxEntries)
+	}
+	var nextToken string
+	if end < total {
+		nextToken = strconv.Itoa(end)
+	}
+	return start, end, nextToken, nil
+}
+
+// accountMetricsClient gets metrics of storage account
+type accountMetricsClient interface {
+	GetUsedCapacity(ctx context.Context, subsID, resourceGroupName, accountName string) (int64, error)
+}
+
+// getAccountMetricsClient returns a storage account metrics client of the subscription
+func (d *Driver) getAccountMetricsClient(subsID string) (accountMetricsClient, error) {
+	if d.accountMetricsClient != nil {
+		return d.accountMetricsClient, nil
+	}
+	if subsID == "" {
+		subsID = d.cloud.SubscriptionID
+	}
+	authorizer, err := d.getManagementToken()
+	if err != nil {
+		return nil, err
+	}
+	client := &monitorMetricsClient{
+		Client:  autorest.NewClientWithUserAgent(d.customUserAgent),
+		baseURI: d.cloud.Environment.ResourceManagerEndpoint,
+	}
+	client.Authorizer = authorizer
+	return client, nil
+}
+
+// validateEdgeCacheSku checks whether storage account sku is supported by edgecache with the storage authentication,
+// validation is local without calling edgecache: edgecache supports block blob skus of the account kinds created by driver,
+// empty sku means the default sku of driver and empty storage authentication is not checked since it's only required on node
+func (d *Driver) validateEdgeCacheSku(skuName, storageAuthentication string) error {
+	if skuName != "" {
+		if supportedSkuNames := supportedSkuNamesByKind[getAccountKind(skuName, IsAzureStackCloud(d.cloud))]; !util.ContainsString(supportedSkuNames, skuName, nil) {
+			return status.Errorf(codes.InvalidArgument, "sku(%s) with %s(%s) is not supported by edgecache, supported values: %v", skuName, EcStrgAuthenticationField, storageAuthentication, supportedSkuNames)
+		}
+	}
+	if storageAuthentication != "" && !cv.IsValidStorageAuthentication(storageAuthentication) {
+		return status.Errorf(codes.InvalidArgument, "sku(%s) with %s(%s) is not supported by edgecache, supported storage authentication values: %v", skuName, EcStrgAuthenticationField, storageAuthentication, cv.ValidStorageAuthentications())
+	}
+	return nil
+}
+
+// getAccountKind returns the kind of storage account created by driver for skuName, premium sku is created as
+// BlockBlobStorage account and Azure Stack only supports Storage account
+func getAccountKind(skuName string, isAzureStackCloud bool) string {
+	if isAzureStackCloud {
+		return string(storage.KindStorage)
+	}
+	if strings.HasPrefix(strings.ToLower(skuName), "premium") {
+		return string(storage.KindBlockBlobStorage)
+	}
+	return string(storage.KindStorageV2)
+}
+
+// normalizeSkuName maps skuName to the exact storage.SkuName value case-insensitively, replication type without
+// tier, e.g. ZRS or RA-GRS, is mapped to the standard tier, unknown skuName is returned as is
+func normalizeSkuName(skuName string) string {
+	name := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(skuName), "-", ""))
+	for _, sku := range storage.PossibleSkuNameValues() {
+		if value := strings.ToUpper(string(sku)); name == value || "STANDARD_"+name == value {
+			return string(sku)
+		}
+	}
+	return skuName
+}
+
+// getContainerMaxSize returns the max size of a container on the account kind, a container could not exceed
+// the capacity of the account, which is lower on premium block blob account, see getAccountCapacityBytes
+func getContainerMaxSize(accountKind string) int64 {
+	if accountKind == string(storage.KindBlockBlobStorage) && premiumAccountCapacityBytes < containerMaxSize {
+		return premiumAccountCapacityBytes
+	}
+	return containerMaxSize
+}
+
+// getAccountCapacityBytes returns the max capacity of storage account with the sku,
+// premium block blob account has a lower limit than standard account
+func getAccountCapacityBytes(skuName string) int64 {
+	if strings.HasPrefix(strings.ToLower(skuName), "premium") {
+		return premiumAccountCapacityBytes
+	}
+	return standardAccountCapacityBytes
+}
+
+// blobInventoryPoliciesClient is the subset of storage.BlobInventoryPoliciesClient used by driver
+type blobInventoryPoliciesClient interface {
+	Get(ctx context.Context, resourceGroupName string, accountName string) (storage.BlobInventoryPolicy, error)
+	CreateOrUpdate(ctx context.Context, resourceGroupName string, accountName string, properties storage.BlobInventoryPolicy) (storage.BlobInventoryPolicy, error)
+	Delete(ctx context.Context, resourceGroupName string, accountName string) (autorest.Response, error)
+}
+
+// getBlobInventoryPoliciesClient returns a blob inventory policies client of the subscription
+func (d *Driver) getBlobInventoryPoliciesClient(subsID string) (blobInventoryPoliciesClient, error) {
+	if d.blobInventoryPoliciesClient != nil {
+		return d.blobInventoryPoliciesClient, nil
+	}
+	if subsID == "" {
+		subsID = d.cloud.SubscriptionID
+	}
+	authorizer, err := d.getManagementToken()
+	if err != nil {
+		return nil, err
+	}
+	client := storage.NewBlobInventoryPoliciesClientWithBaseURI(d.cloud.Environment.ResourceManagerEndpoint, subsID)
+	client.Authorizer = authorizer
+	return client, nil
+}
+
+// getBlobInventoryPolicy returns the blob inventory policy of the account, empty policy is returned if it does not exist
+func getBlobInventoryPolicy(ctx context.Context, client blobInventoryPoliciesClient, resourceGroupName, accountName string) (storage.BlobInventoryPolicy, error) {
+	policy, err := client.Get(ctx, resourceGroupName, accountName)
+	if err != nil {
+		var detailedErr autorest.DetailedError
+		if errors.As(err, &detailedErr) && detailedErr.StatusCode == http.StatusNotFound {
+			return storage.BlobInventoryPolicy{}, nil
+		}
+		return storage.BlobInventoryPolicy{}, err
+	}
+	return policy, nil
+}
+
+// setBlobInventoryRule adds or updates the blob inventory rule scoped to the container in the account's inventory policy,
+// destination container would be created if it does not exist
+func (d *Driver) setBlobInventoryRule(ctx context.Context, subsID, resourceGroupName, accountName, containerName, destination string, schedule storage.Schedule, format storage.Format) error {
+	exists, err := d.containerExists(ctx, subsID, resourceGroupName, accountName, destination, "", nil)
+	if err != nil && !strings.Contains(err.Error(), httpCodeNotFound) {
+		return fmt.Errorf("failed to check destination container(%s): %w", destination, err)
+	}
+	if !exists {
+		klog.V(2).Infof("destination container(%s) does not exist on account(%s), creating it", destination, accountName)
+		if err := d.CreateBlobContainer(ctx, subsID, resourceGroupName, accountName, destination, "", nil, nil, "", "", false); err != nil {
+			return fmt.Errorf("failed to create destination container(%s): %w", destination, err)
+		}
+	}
+
+	client, err := d.getBlobInventoryPoliciesClient(subsID)
+	if err != nil {
+		return err
+	}
+	unlock := d.lockAccountPolicy(subsID, resourceGroupName, accountName, "inventory")
+	defer unlock()
+	policy, err := getBlobInventoryPolicy(ctx, client, resourceGroupName, accountName)
+	if err != nil {
+		return err
+	}
+	ruleName := getBlobInventoryRuleName(containerName)
+	rule := storage.BlobInventoryPolicyRule{
+		Enabled:     pointer.Bool(true),
+		Name:        pointer.String(ruleName),
+		Destination: pointer.String(destination),
+		Definition: &storage.BlobInventoryPolicyDefinition{
+			Filters: &storage.BlobInventoryPolicyFilter{
+				PrefixMatch: &[]string{containerName + "/"},
+				BlobTypes:   &[]string{"blockBlob", "appendBlob"},
+			},
+			Format:       format,
+			Schedule:     schedule,
+			ObjectType:   storage.ObjectTypeBlob,
+			SchemaFields: &[]string{"Name", "Creation-Time", "Last-Modified", "Content-Length", "BlobType", "AccessTier"},
+		},
 	}
 
-	isOperationSucceeded = true
-	// reset secretNamespace field in VolumeContext
-	setKeyValueInMap(parameters, secretNamespaceField, secretNamespace)
-	return &csi.CreateVolumeResponse{
-		Volume: &csi.Volume{
-			VolumeId:      volumeID,
-			CapacityBytes: req.GetCapacityRange().GetRequiredBytes(),
-			VolumeContext: parameters,
-			ContentSource: req.GetVolumeContentSource(),
+	var rules []storage.BlobInventoryPolicyRule
+	if policy.BlobInventoryPolicyProperties != nil && policy.BlobInventoryPolicyProperties.Policy != nil && policy.BlobInventoryPolicyProperties.Policy.Rules != nil {
+		for _, r := range *policy.BlobInventoryPolicyProperties.Policy.Rules {
+			if pointer.StringDeref(r.Name, "") != ruleName {
+				rules = append(rules, r)
+			}
+		}
+	}
+	rules = append(rules, rule)
+	_, err = client.CreateOrUpdate(ctx, resourceGroupName, accountName, storage.BlobInventoryPolicy{
+		BlobInventoryPolicyProperties: &storage.BlobInventoryPolicyProperties{
+			Policy: &storage.BlobInventoryPolicySchema{
+				Enabled: pointer.Bool(true),
+				Type:    pointer.String("Inventory"),
+				Rules:   &rules,
+			},
 		},
-	}, nil
+	})
+	return err
 }
 
-// DeleteVolume delete a volume
-func (d *Driver) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
-	volumeID := req.GetVolumeId()
-	if len(volumeID) == 0 {
-		return nil, status.Error(codes.InvalidArgument, "Volume ID missing in request")
+// lockAccountPolicy locks the account wide policy of the kind, e.g. "inventory", since a policy is read, modified
+// and written back as a whole, concurrent updates on the same account would overwrite each other, returns unlock func
+func (d *Driver) lockAccountPolicy(subsID, resourceGroupName, accountName, kind string) func() {
+	lockKey := strings.Join([]string{subsID, resourceGroupName, accountName, kind}, separator)
+	d.accountPolicyLockMap.LockEntry(lockKey)
+	return func() { d.accountPolicyLockMap.UnlockEntry(lockKey) }
+}
+
+// removeOwnedBlobInventoryRule removes the blob inventory rule recorded in container metadata,
+// the inventory policy is deleted if there is no rule left
+func (d *Driver) removeOwnedBlobInventoryRule(ctx context.Context, subsID, resourceGroupName, accountName, containerName string) error {
+	if d.cloud.BlobClient == nil {
+		return nil
+	}
+	container, rerr := d.cloud.BlobClient.GetContainer(ctx, subsID, resourceGroupName, accountName, containerName)
+	if rerr != nil {
+		klog.V(4).Infof("failed to get container(%s) on account(%s), skip blob inventory rule cleanup, error: %v", containerName, accountName, rerr.Error())
+		return nil
+	}
+	if container.ContainerProperties == nil || container.ContainerProperties.Metadata == nil {
+		return nil
+	}
+	ruleName := pointer.StringDeref(container.ContainerProperties.Metadata[blobInventoryRuleMetadataKey], "")
+	if ruleName == "" {
+		return nil
 	}
 
-	if err := d.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME); err != nil {
-		return nil, status.Errorf(codes.Internal, "invalid delete volume req: %v", req)
+	client, err := d.getBlobInventoryPoliciesClient(subsID)
+	if err != nil {
+		return err
 	}
+	unlock := d.lockAccountPolicy(subsID, resourceGroupName, accountName, "inventory")
+	defer unlock()
+	policy, err := getBlobInventoryPolicy(ctx, client, resourceGroupName, accountName)
+	if err != nil {
+		return err
+	}
+	if policy.BlobInventoryPolicyProperties == nil || policy.BlobInventoryPolicyProperties.Policy == nil || policy.BlobInventoryPolicyProperties.Policy.Rules == nil {
+		return nil
+	}
+	var rules []storage.BlobInventoryPolicyRule
+	for _, r := range *policy.BlobInventoryPolicyProperties.Policy.Rules {
+		if pointer.StringDeref(r.Name, "") != ruleName {
+			rules = append(rules, r)
+		}
+	}
+	if len(rules) == len(*policy.BlobInventoryPolicyProperties.Policy.Rules) {
+		return nil
+	}
+	klog.V(2).Infof("remove blob inventory rule(%s) of container(%s) on account(%s) rg(%s)", ruleName, containerName, accountName, resourceGroupName)
+	if len(rules) == 0 {
+		_, err = client.Delete(ctx, resourceGroupName, accountName)
+		return err
+	}
+	policy.BlobInventoryPolicyProperties.Policy.Rules = &rules
+	_, err = client.CreateOrUpdate(ctx, resourceGroupName, accountName, policy)
+	return err
+}
 
-	if acquired := d.volumeLocks.TryAcquire(volumeID); !acquired {
-		return nil, status.Errorf(codes.Aborted, volumeOperationAlreadyExistsFmt, volumeID)
+// lifecyclePolicy is the simple lifecycle management rule specified in lifecyclePolicy parameter in JSON format,
+// e.g. {"tierToCoolAfterDays": 30, "tierToArchiveAfterDays": 90, "deleteAfterDays": 365},
+// days are counted after last modification of the blob
+type lifecyclePolicy struct {
+	TierToCoolAfterDays    *int32 `json:"tierToCoolAfterDays,omitempty"`
+	TierToArchiveAfterDays *int32 `json:"tierToArchiveAfterDays,omitempty"`
+	DeleteAfterDays        *int32 `json:"deleteAfterDays,omitempty"`
+}
+
+// parseLifecyclePolicy parses and validates lifecyclePolicy parameter, at least one action should be specified
+// and the days of later actions should be larger than those of earlier actions
+func parseLifecyclePolicy(value string) (*lifecyclePolicy, error) {
+	policy := &lifecyclePolicy{}
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(policy); err != nil {
+		return nil, fmt.Errorf("invalid lifecyclePolicy(%s): %v", value, err)
 	}
-	defer d.volumeLocks.Release(volumeID)
+	if policy.TierToCoolAfterDays == nil && policy.TierToArchiveAfterDays == nil && policy.DeleteAfterDays == nil {
+		return nil, fmt.Errorf("invalid lifecyclePolicy(%s): at least one of tierToCoolAfterDays, tierToArchiveAfterDays and deleteAfterDays should be specified", value)
+	}
+	var previous *int32
+	for _, days := range []*int32{policy.TierToCoolAfterDays, policy.TierToArchiveAfterDays, policy.DeleteAfterDays} {
+		if days == nil {
+			continue
+		}
+		if *days < 0 || *days > maxLifecycleDays {
+			return nil, fmt.Errorf("invalid lifecyclePolicy(%s): days should be in range [0, %d]", value, maxLifecycleDays)
+		}
+		if previous != nil && *days <= *previous {
+			return nil, fmt.Errorf("invalid lifecyclePolicy(%s): days should be in the order of tierToCoolAfterDays < tierToArchiveAfterDays < deleteAfterDays", value)
+		}
+		previous = days
+	}
+	return policy, nil
+}
 
-	resourceGroupName, accountName, containerName, _, subsID, err := GetContainerInfo(volumeID)
+// managementPoliciesClient is the subset of storage.ManagementPoliciesClient used by driver
+type managementPoliciesClient interface {
+	Get(ctx context.Context, resourceGroupName string, accountName string) (storage.ManagementPolicy, error)
+	CreateOrUpdate(ctx context.Context, resourceGroupName string, accountName string, properties storage.ManagementPolicy) (storage.ManagementPolicy, error)
+	Delete(ctx context.Context, resourceGroupName string, accountName string) (autorest.Response, error)
+}
+
+// getManagementPoliciesClient returns a lifecycle management policies client of the subscription
+func (d *Driver) getManagementPoliciesClient(subsID string) (managementPoliciesClient, error) {
+	if d.managementPoliciesClient != nil {
+		return d.managementPoliciesClient, nil
+	}
+	if subsID == "" {
+		subsID = d.cloud.SubscriptionID
+	}
+	authorizer, err := d.getManagementToken()
 	if err != nil {
-		// According to CSI Driver Sanity Tester, should succeed when an invalid volume id is used
-		klog.Errorf("GetContainerInfo(%s) in DeleteVolume failed with error: %v", volumeID, err)
-		return &csi.DeleteVolumeResponse{}, nil
+		return nil, err
 	}
+	client := storage.NewManagementPoliciesClientWithBaseURI(d.cloud.Environment.ResourceManagerEndpoint, subsID)
+	client.Authorizer = authorizer
+	return client, nil
+}
 
-	secrets := req.GetSecrets()
-	if len(secrets) == 0 && d.useDataPlaneAPI(volumeID, accountName) {
-		_, accountName, accountKey, _, _, _, _, err := d.GetAuthEnv(ctx, volumeID, "", nil, secrets)
+// getManagementPolicy returns the lifecycle management policy of the account, empty policy is returned if it does not exist
+func getManagementPolicy(ctx context.Context, client managementPoliciesClient, resourceGroupName, accountName string) (storage.ManagementPolicy, error) {
+	policy, err := client.Get(ctx, resourceGroupName, accountName)
+	if err != nil {
+		var detailedErr autorest.DetailedError
+		if errors.As(err, &detailedErr) && detailedErr.StatusCode == http.StatusNotFound {
+			return storage.ManagementPolicy{}, nil
+		}
+		return storage.ManagementPolicy{}, err
+	}
+	return policy, nil
+}
+
+// getLifecycleRules returns the rules of lifecycle management policy, nil is returned if there is no rule
+func getLifecycleRules(policy storage.ManagementPolicy) []storage.ManagementPolicyRule {
+	if policy.ManagementPolicyProperties == nil || policy.ManagementPolicyProperties.Policy == nil || policy.ManagementPolicyProperties.Policy.Rules == nil {
+		return nil
+	}
+	return *policy.ManagementPolicyProperties.Policy.Rules
+}
+
+// getLifecycleRulePrefixes returns the prefix filters of lifecycle management rule
+func getLifecycleRulePrefixes(rule storage.ManagementPolicyRule) []string {
+	if rule.Definition == nil || rule.Definition.Filters == nil || rule.Definition.Filters.PrefixMatch == nil {
+		return nil
+	}
+	return *rule.Definition.Filters.PrefixMatch
+}
+
+// setLifecycleRule adds the container to the lifecycle management rule of the policy in the account's management policy,
+// containers with the same policy share one rule, a new rule is added when the prefix filters of existing rules are full
+func (d *Driver) setLifecycleRule(ctx context.Context, subsID, resourceGroupName, accountName, containerName string, lifecycle *lifecyclePolicy) error {
+	client, err := d.getManagementPoliciesClient(subsID)
+	if err != nil {
+		return err
+	}
+	unlock := d.lockAccountPolicy(subsID, resourceGroupName, accountName, "lifecycle")
+	defer unlock()
+	policy, err := getManagementPolicy(ctx, client, resourceGroupName, accountName)
+	if err != nil {
+		return err
+	}
+
+	baseName := getLifecycleRuleName(lifecycle)
+	prefix := containerName + "/"
+	rules := append([]storage.ManagementPolicyRule{}, getLifecycleRules(policy)...)
+	ruleNames := map[string]bool{}
+	target := -1
+	for i, r := range rules {
+		name := pointer.StringDeref(r.Name, "")
+		ruleNames[name] = true
+		if !strings.HasPrefix(name, baseName) {
+			continue
+		}
+		prefixes := getLifecycleRulePrefixes(r)
+		for _, p := range prefixes {
+			if p == prefix {
+				klog.V(2).Infof("container(%s) is already in lifecycle rule(%s) on account(%s)", containerName, name, accountName)
+				return nil
+			}
+		}
+		if target < 0 && len(prefixes) < maxLifecycleRulePrefixes {
+			target = i
+		}
+	}
+
+	if target >= 0 {
+		prefixes := append(append([]string{}, getLifecycleRulePrefixes(rules[target])...), prefix)
+		definition := *rules[target].Definition
+		filters := *definition.Filters
+		filters.PrefixMatch = &prefixes
+		definition.Filters = &filters
+		rules[target].Definition = &definition
+	} else {
+		ruleName := baseName
+		for i := 1; ruleNames[ruleName]; i++ {
+			ruleName = fmt.Sprintf("%s%d", baseName, i)
+		}
+		daysAfterModification := func(days *int32) *storage.DateAfterModification {
+			if days == nil {
+				return nil
+			}
+			return &storage.DateAfterModification{DaysAfterModificationGreaterThan: pointer.Float64(float64(*days))}
+		}
+		rules = append(rules, storage.ManagementPolicyRule{
+			Enabled: pointer.Bool(true),
+			Name:    pointer.String(ruleName),
+			Type:    pointer.String("Lifecycle"),
+			Definition: &storage.ManagementPolicyDefinition{
+				Actions: &storage.ManagementPolicyAction{
+					BaseBlob: &storage.ManagementPolicyBaseBlob{
+						TierToCool:    daysAfterModification(lifecycle.TierToCoolAfterDays),
+						TierToArchive: daysAfterModification(lifecycle.TierToArchiveAfterDays),
+						Delete:        daysAfterModification(lifecycle.DeleteAfterDays),
+					},
+				},
+				Filters: &storage.ManagementPolicyFilter{
+					PrefixMatch: &[]string{prefix},
+					BlobTypes:   &[]string{"blockBlob"},
+				},
+			},
+		})
+	}
+	_, err = client.CreateOrUpdate(ctx, resourceGroupName, accountName, storage.ManagementPolicy{
+		ManagementPolicyProperties: &storage.ManagementPolicyProperties{
+			Policy: &storage.ManagementPolicySchema{
+				Rules: &rules,
+			},
+		},
+	})
+	return err
+}
+
+// removeOwnedLifecycleRule removes the container from the lifecycle management rules recorded in container metadata,
+// a rule is deleted if it has no prefix left and the management policy is deleted if there is no rule left
+func (d *Driver) removeOwnedLifecycleRule(ctx context.Context, subsID, resourceGroupName, accountName, containerName string) error {
+	if d.cloud.BlobClient == nil {
+		return nil
+	}
+	container, rerr := d.cloud.BlobClient.GetContainer(ctx, subsID, resourceGroupName, accountName, containerName)
+	if rerr != nil {
+		klog.V(4).Infof("failed to get container(%s) on account(%s), skip lifecycle rule cleanup, error: %v", containerName, accountName, rerr.Error())
+		return nil
+	}
+	if container.ContainerProperties == nil || container.ContainerProperties.Metadata == nil {
+		return nil
+	}
+	baseName := pointer.StringDeref(container.ContainerProperties.Metadata[lifecycleRuleMetadataKey], "")
+	if baseName == "" {
+		return nil
+	}
+
+	client, err := d.getManagementPoliciesClient(subsID)
+	if err != nil {
+		return err
+	}
+	unlock := d.lockAccountPolicy(subsID, resourceGroupName, accountName, "lifecycle")
+	defer unlock()
+	policy, err := getManagementPolicy(ctx, client, resourceGroupName, accountName)
+	if err != nil {
+		return err
+	}
+	prefix := containerName + "/"
+	removed := false
+	var rules []storage.ManagementPolicyRule
+	for _, r := range getLifecycleRules(policy) {
+		name := pointer.StringDeref(r.Name, "")
+		if strings.HasPrefix(name, baseName) {
+			var prefixes []string
+			for _, p := range getLifecycleRulePrefixes(r) {
+				if p != prefix {
+					prefixes = append(prefixes, p)
+				}
+			}
+			if len(prefixes) != len(getLifecycleRulePrefixes(r)) {
+				removed = true
+				klog.V(2).Infof("remove container(%s) from lifecycle rule(%s) on account(%s) rg(%s)", containerName, name, accountName, resourceGroupName)
+				if len(prefixes) == 0 {
+					continue
+				}
+				definition := *r.Definition
+				filters := *definition.Filters
+				filters.PrefixMatch = &prefixes
+				definition.Filters = &filters
+				r.Definition = &definition
+			}
+		}
+		rules = append(rules, r)
+	}
+	if !removed {
+		return nil
+	}
+	if len(rules) == 0 {
+		_, err = client.Delete(ctx, resourceGroupName, accountName)
+		return err
+	}
+	policy.ManagementPolicyProperties.Policy.Rules = &rules
+	_, err = client.CreateOrUpdate(ctx, resourceGroupName, accountName, policy)
+	return err
+}
+
+// CopyBlobContainer copies a blob container to the destination account, source account key is looked up
+// if the destination account is not the source account, empty dstAccountName means the source account,
+// sasToken is used for both source and destination instead of generating sas tokens if not empty,
+// user delegation sas tokens signed with driver identity are generated if useUserDelegationSAS is true,
+// ACLs are preserved by azcopy if preservePermissions is true and the source account is HNS enabled
+func (d *Driver) copyBlobContainer(ctx context.Context, sourceVolumeID, dstAccountName, dstAccountKey string, sasURLs *cloneSasURLs, dstContainerName, storageEndpointSuffix string, useUserDelegationSAS bool, azcopyRetryCount int, copyTimeout time.Duration, preservePermissions bool) (retErr error) {
+	resourceGroupName, accountName, srcContainerName, secretNamespace, subsID, err := GetContainerInfo(sourceVolumeID)
+	if err != nil {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	if srcContainerName == "" || dstContainerName == "" {
+		return fmt.Errorf("srcContainerName(%s) or dstContainerName(%s) is empty", srcContainerName, dstContainerName)
+	}
+	if dstAccountName == "" {
+		dstAccountName = accountName
+	}
+	if IsAzureStackCloud(d.cloud) {
+		return status.Error(codes.Unimplemented, azureStackCloneNotSupportedMsg)
+	}
+	if storageEndpointSuffix == "" {
+		storageEndpointSuffix = d.getStorageEndpointSuffix()
+	}
+
+	// destination is the volume being created, source volume and container are logged as extra fields
+	copyLogFields := func(keysAndValues ...interface{}) []interface{} {
+		return volumeLogFields("copyBlobContainer", "", dstAccountName, dstContainerName,
+			append([]interface{}{"sourceVolumeID", sourceVolumeID, "sourceAccount", accountName, "sourceContainer", srcContainerName}, keysAndValues...)...)
+	}
+
+	mc := metrics.NewMetricContext(blobCSIDriverName, "controller_copy_blob_container", resourceGroupName, subsID, d.Name)
+	// copy is synchronous, azcopy job is in flight until copyBlobContainer returns
+	d.azcopyJobContainers.Store(dstContainerName, struct{}{})
+	defer func() {
+		d.azcopyJobContainers.Delete(dstContainerName)
+		mc.ObserveOperationWithResult(retErr == nil, "account", dstAccountName, "container", dstContainerName)
+	}()
+
+	if err := d.azcopy.EnsureInstalled(); err != nil {
+		return status.Errorf(codes.FailedPrecondition, "azcopy must be installed for volume cloning, error: %v", err)
+	}
+
+	var srcSasToken, dstSasToken string
+	if sasURLs != nil && sasURLs.token != "" {
+		// one sas token could only grant access to both containers when they are on the same account
+		if !strings.EqualFold(dstAccountName, accountName) {
+			return status.Errorf(codes.InvalidArgument, "%s in secrets could only be used when cloning in the same account, source account(%s) is different from destination account(%s), supply %s and %s instead", cloneSasTokenField, accountName, dstAccountName, sourceSasURLField, destinationSasURLField)
+		}
+		klog.V(2).InfoS("use sas token in secrets to copy blob container", copyLogFields()...)
+		srcSasToken, dstSasToken = sasURLs.token, sasURLs.token
+	} else if sasURLs != nil {
+		// sas urls supplied in secrets are used, account key is not needed
+		klog.V(2).InfoS("use sas urls in secrets to copy blob container", copyLogFields()...)
+		if srcSasToken, err = getSasTokenFromURL(sasURLs.source, accountName, srcContainerName, storageEndpointSuffix); err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid %s in secrets: %v", sourceSasURLField, err)
+		}
+		if dstSasToken, err = getSasTokenFromURL(sasURLs.destination, dstAccountName, dstContainerName, storageEndpointSuffix); err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid %s in secrets: %v", destinationSasURLField, err)
+		}
+	} else if useUserDelegationSAS {
+		if srcSasToken, dstSasToken, err = d.generateCopyUserDelegationSASTokens(ctx, accountName, srcContainerName, dstAccountName, dstContainerName, storageEndpointSuffix); err != nil {
+			return err
+		}
+	} else if srcSasToken, dstSasToken, err = d.generateCopySASTokens(ctx, resourceGroupName, accountName, srcContainerName, subsID, secretNamespace, dstAccountName, dstAccountKey, dstContainerName, storageEndpointSuffix, isLatestAccountKeyVolumeID(sourceVolumeID)); err != nil {
+		return err
+	}
+
+	var copyArgs []string
+	if preservePermissions {
+		isHnsEnabled, err := d.isHnsEnabledAccount(ctx, subsID, resourceGroupName, accountName)
 		if err != nil {
-			return nil, status.Errorf(codes.Internal, "GetAuthEnv(%s) failed with %v", volumeID, err)
+			return status.Errorf(codes.Internal, "failed to check whether source account(%s) is HNS enabled, error: %v", accountName, err)
 		}
-		if accountName != "" && accountKey != "" {
-			secrets = createStorageAccountSecret(accountName, accountKey)
+		if isHnsEnabled {
+			copyArgs = append(copyArgs, "--preserve-permissions=true")
+		} else {
+			klog.V(2).InfoS("skip preserving permissions in copying blob container since source account is not HNS enabled", copyLogFields()...)
 		}
 	}
 
-	mc := metrics.NewMetricContext(blobCSIDriverName, "controller_delete_volume", d.cloud.ResourceGroup, d.cloud.SubscriptionID, d.Name)
-	isOperationSucceeded := false
+	if copyTimeout <= 0 {
+		copyTimeout = waitForCopyTimeout
+	}
+	timeAfter := time.After(copyTimeout)
+	copyDeadline := time.Now().Add(copyTimeout)
+	srcPath := fmt.Sprintf("%s/%s%s", getBlobEndpoint(accountName, storageEndpointSuffix), srcContainerName, srcSasToken)
+	dstPath := fmt.Sprintf("%s/%s%s", getBlobEndpoint(dstAccountName, storageEndpointSuffix), dstContainerName, dstSasToken)
+
+	jobState, percent, jobID, err := d.azcopy.GetAzcopyJob(dstContainerName)
+	klog.V(2).InfoS("azcopy job status", copyLogFields("jobState", jobState, "percent", percent, "err", err)...)
+	if jobState == util.AzcopyJobCompleted {
+		klog.V(2).InfoS("skip copying blob container since azcopy job is completed", copyLogFields()...)
+		return err
+	}
+	if jobState == util.AzcopyJobError {
+		return err
+	}
+	// azcopy logs are kept on failure so that clone failures could be diagnosed without attaching to the pod
+	var logLocation string
 	defer func() {
-		mc.ObserveOperationWithResult(isOperationSucceeded, VolumeID, volumeID)
+		if logLocation == "" {
+			return
+		}
+		if retErr != nil {
+			retErr = appendAzcopyLogLocation(retErr, logLocation)
+			return
+		}
+		if err := os.RemoveAll(logLocation); err != nil {
+			klog.Warningf("failed to remove azcopy log location(%s): %v", logLocation, err)
+		}
 	}()
+	if jobState == util.AzcopyJobRunning && jobID != "" {
+		// copy is synchronous in the driver, an in progress job found here is interrupted, e.g. by controller restart,
+		// resume it instead of starting a new copy which may conflict with it
+		klog.V(2).InfoS("resume azcopy job copying blob container", copyLogFields("jobID", jobID, "percent", percent)...)
+		logLocation = d.ensureAzcopyLogLocation(dstContainerName)
+		if out, err := d.azcopy.Resume(ctx, jobID, srcSasToken, dstSasToken, logLocation); err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				d.cancelAzcopyJob(dstContainerName)
+				return status.Errorf(codes.Canceled, "copy blob container %s to %s is canceled: %v", srcContainerName, dstContainerName, ctxErr)
+			}
+			return fmt.Errorf("resume azcopy job %s copying blob container %s to %s failed with error(%w), azcopy output: %s", jobID, srcContainerName, dstContainerName, err, strings.TrimSpace(out))
+		}
+		klog.V(2).InfoS("copied blob container successfully", copyLogFields()...)
+		return nil
+	}
+	klog.V(2).InfoS("begin to copy blob container", copyLogFields()...)
+	pollInterval := getCopyPollInterval(d.azcopyPollInterval, d.azcopyPollMaxInterval, d.azcopyPollJitterFactor, percent)
+	for {
+		select {
+		case <-time.After(pollInterval):
+			jobState, percent, _, err := d.azcopy.GetAzcopyJob(dstContainerName)
+			klog.V(2).InfoS("azcopy job status", copyLogFields("jobState", jobState, "percent", percent, "err", err)...)
+			pollInterval = getCopyPollInterval(d.azcopyPollInterval, d.azcopyPollMaxInterval, d.azcopyPollJitterFactor, percent)
+			switch jobState {
+			case util.AzcopyJobError, util.AzcopyJobCompleted:
+				return err
+			case util.AzcopyJobNotFound:
+				// azcopy job history is lost on controller restart, the copy source recorded in destination metadata
+				// tells blobs left by a prior failed clone from blobs of other writers
+				if err := d.prepareCopyDestination(ctx, dstAccountName, dstAccountKey, dstContainerName, fmt.Sprintf("%s/%s", accountName, srcContainerName), storageEndpointSuffix); err != nil {
+					return err
+				}
+				logLocation = d.ensureAzcopyLogLocation(dstContainerName)
+				klog.V(2).InfoS("copy blob container", copyLogFields("logLocation", logLocation)...)
+				var out string
+				var copyErr error
+				copyStart := time.Now()
+				// this is the only retry layer of azcopy copy, azcopyRetryCount overrides the backoff steps and
+				// makes any non-fatal error retriable, the last azcopy error is returned when retries are exhausted
+				backoff := d.cloud.RequestBackoff()
+				if azcopyRetryCount > 0 {
+					backoff.Steps = azcopyRetryCount + 1
+				}
+				if err := wait.ExponentialBackoffWithContext(ctx, backoff, func(context.Context) (bool, error) {
+					if out, copyErr = d.azcopy.Copy(ctx, srcPath, dstPath, logLocation, copyArgs...); copyErr == nil {
+						return true, nil
+					}
+					retriable := util.IsAzcopyRetriableError(out) || (azcopyRetryCount > 0 && !util.IsAzcopyFatalError(out))
+					if retriable && time.Now().Before(copyDeadline) {
+						klog.Warningf("CopyBlobContainer(%s, %s, %s) failed with retriable error(%v), retrying: %v", resourceGroupName, accountName, dstContainerName, copyErr, out)
+						return false, nil
+					}
+					return true, copyErr
+				}); err != nil {
+					if ctxErr := ctx.Err(); ctxErr != nil {
+						d.cancelAzcopyJob(dstContainerName)
+						return status.Errorf(codes.Canceled, "copy blob container %s to %s is canceled: %v", srcContainerName, dstContainerName, ctxErr)
+					}
+					klog.Warningf("CopyBlobContainer(%s, %s, %s) failed with error(%v): %v", resourceGroupName, accountName, dstContainerName, copyErr, out)
+					return fmt.Errorf("copy blob container %s to %s failed with error(%w), azcopy output: %s", srcContainerName, dstContainerName, copyErr, strings.TrimSpace(out))
+				}
+				klog.V(2).InfoS("copied blob container successfully", copyLogFields()...)
+				if bytes := util.GetAzcopyBytesTransferred(out); bytes > 0 {
+					if elapsed := time.Since(copyStart).Seconds(); elapsed > 0 {
+						copyBlobContainerThroughput.Observe(float64(bytes) / elapsed)
+					}
+				}
+				return nil
+			}
+		case <-timeAfter:
+			return fmt.Errorf("timeout waiting for copy blob container %s to %s succeed", srcContainerName, dstContainerName)
+		case <-ctx.Done():
+			d.cancelAzcopyJob(dstContainerName)
+			return status.Errorf(codes.Canceled, "copy blob container %s to %s is canceled: %v", srcContainerName, dstContainerName, ctx.Err())
+		}
+	}
+}
+
+// cancelAzcopyJob cancels the azcopy job copying into dstContainerName when the copy is abandoned on request cancellation,
+// azcopy process is killed with the request context while its job plan would be resumed by the next retry otherwise
+func (d *Driver) cancelAzcopyJob(dstContainerName string) {
+	jobID, err := d.azcopy.CancelAzcopyJob(dstContainerName)
+	if err != nil {
+		klog.Warningf("failed to cancel azcopy job copying into container(%s): %v", dstContainerName, err)
+		return
+	}
+	if jobID != "" {
+		klog.V(2).Infof("canceled azcopy job(%s) copying into container(%s)", jobID, dstContainerName)
+	}
+}
+
+// ensureAzcopyLogLocation creates the azcopy log location of the copy into dstContainerName, empty is returned
+// if azcopy log dir is not set or the directory could not be created, azcopy default log location is used then
+func (d *Driver) ensureAzcopyLogLocation(dstContainerName string) string {
+	logLocation := d.azcopy.GetLogLocation(dstContainerName)
+	if logLocation == "" {
+		return ""
+	}
+	d.azcopy.CleanupLogs()
+	if err := os.MkdirAll(logLocation, 0750); err != nil {
+		klog.Warningf("failed to create azcopy log location(%s): %v", logLocation, err)
+		return ""
+	}
+	return logLocation
+}
+
+// appendAzcopyLogLocation appends azcopy log location to the error of a failed copy, gRPC status code is kept
+func appendAzcopyLogLocation(err error, logLocation string) error {
+	if st, ok := status.FromError(err); ok {
+		return status.Errorf(st.Code(), "%s, azcopy logs are in %s", st.Message(), logLocation)
+	}
+	return fmt.Errorf("%w, azcopy logs are in %s", err, logLocation)
+}
+
+// getAccountKeyFromKeyVault reads storage account key from the secret in Azure Key Vault, the latest version is used
+// if secretVersion is empty, FailedPrecondition error is returned if the secret is not found, disabled, expired or empty
+func (d *Driver) getAccountKeyFromKeyVault(ctx context.Context, vaultURL, secretName, secretVersion string) (string, error) {
+	accountKey, err := d.getKeyVaultSecretContent(ctx, vaultURL, secretName, secretVersion)
+	if err != nil {
+		var detailedErr autorest.DetailedError
+		if errors.As(err, &detailedErr) && detailedErr.StatusCode == http.StatusNotFound {
+			return "", status.Errorf(codes.FailedPrecondition, "secret(%s) version(%s) is not found in key vault(%s)", secretName, secretVersion, vaultURL)
+		}
+		if errors.Is(err, errKeyVaultSecretNotUsable) {
+			return "", status.Error(codes.FailedPrecondition, err.Error())
+		}
+		return "", status.Errorf(codes.Internal, "failed to get secret(%s) version(%s) from key vault(%s), error: %v", secretName, secretVersion, vaultURL, err)
+	}
+	if accountKey == "" {
+		return "", status.Errorf(codes.FailedPrecondition, "secret(%s) in key vault(%s) is empty", secretName, vaultURL)
+	}
+	if isSASToken(accountKey) {
+		return "", status.Errorf(codes.InvalidArgument, "secret(%s) in key vault(%s) is a sas token, account key is required in CreateVolume", secretName, vaultURL)
+	}
+	return accountKey, nil
+}
 
+// isHnsEnabledAccount returns whether hierarchical namespace is enabled on the storage account
+func (d *Driver) isHnsEnabledAccount(ctx context.Context, subsID, resourceGroupName, accountName string) (bool, error) {
+	if d.cloud.StorageAccountClient == nil {
+		return false, fmt.Errorf("StorageAccountClient is nil")
+	}
+	if subsID == "" {
+		subsID = d.cloud.SubscriptionID
+	}
 	if resourceGroupName == "" {
 		resourceGroupName = d.cloud.ResourceGroup
 	}
-	klog.V(2).Infof("deleting container(%s) rg(%s) account(%s) volumeID(%s)", containerName, resourceGroupName, accountName, volumeID)
-	csicommon.SendKubeEvent(v1.EventTypeNormal, csicommon.DeletingBlobContainer, csicommon.CSIEventSourceStr,
-		fmt.Sprintf("Controller DeleteVolume: Deleting container %s from %q storage account", containerName, accountName))
-	if err := d.DeleteBlobContainer(ctx, subsID, resourceGroupName, accountName, containerName, secrets); err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to delete container(%s) under rg(%s) account(%s) volumeID(%s), error: %v", containerName, resourceGroupName, accountName, volumeID, err)
+	account, rerr := d.cloud.StorageAccountClient.GetProperties(ctx, subsID, resourceGroupName, accountName)
+	if rerr != nil {
+		return false, rerr.Error()
 	}
-
-	isOperationSucceeded = true
-	klog.V(2).Infof("container(%s) under rg(%s) account(%s) volumeID(%s) is deleted successfully", containerName, resourceGroupName, accountName, volumeID)
-	csicommon.SendKubeEvent(v1.EventTypeNormal, csicommon.DeletedBlobContainer, csicommon.CSIEventSourceStr,
-		fmt.Sprintf("Controller DeleteVolume: Deleted container %s from %q storage account", containerName, accountName))
-	return &csi.DeleteVolumeResponse{}, nil
+	return account.AccountProperties != nil && pointer.BoolDeref(account.AccountProperties.IsHnsEnabled, false), nil
 }
 
-// ValidateVolumeCapabilities return the capabilities of the volume
-func (d *Driver) ValidateVolumeCapabilities(ctx context.Context, req *csi.ValidateVolumeCapabilitiesRequest) (*csi.ValidateVolumeCapabilitiesResponse, error) {
-	volumeID := req.GetVolumeId()
-	if len(volumeID) == 0 {
-		return nil, status.Error(codes.InvalidArgument, "Volume ID missing in request")
+// prepareCopyDestination makes sure the destination container of volume clone does not exist or is empty before
+// azcopy is started so that blobs left by a prior failed clone or other writers are not merged, the copy source is
+// recorded in destination metadata before copy so that the error tells which one left the blobs, the check is
+// skipped if account key of the destination account is not available
+func (d *Driver) prepareCopyDestination(ctx context.Context, dstAccountName, dstAccountKey, dstContainerName, copySource, storageEndpointSuffix string) error {
+	if dstAccountKey == "" {
+		klog.V(4).Infof("skip checking destination container(%s) on account(%s) before copy since account key is not available", dstContainerName, dstAccountName)
+		return nil
 	}
-	if err := isValidVolumeCapabilities(req.GetVolumeCapabilities()); err != nil {
-		return nil, status.Error(codes.InvalidArgument, err.Error())
+	client := d.copyDestinationClient
+	if client == nil {
+		client = &sharedKeyCopyDestinationClient{env: d.getStorageEnvironment(storageEndpointSuffix)}
+	}
+	hasBlobs, metadata, err := client.Get(ctx, dstAccountName, dstAccountKey, dstContainerName)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to check destination container(%s) on account(%s) before copy, error: %v", dstContainerName, dstAccountName, err)
+	}
+	if hasBlobs {
+		if metadata[copySourceMetadataKey] == copySource {
+			return status.Errorf(codes.FailedPrecondition, "destination container(%s) on account(%s) contains blobs left by a prior failed clone from %s, delete the container before retrying", dstContainerName, dstAccountName, copySource)
+		}
+		return status.Errorf(codes.FailedPrecondition, "destination container(%s) on account(%s) already contains blobs which are not copied from %s by driver, delete the container before retrying", dstContainerName, dstAccountName, copySource)
+	}
+	if err := client.SetCopySource(ctx, dstAccountName, dstAccountKey, dstContainerName, copySource); err != nil {
+		return status.Errorf(codes.Internal, "failed to record copy source on destination container(%s) on account(%s), error: %v", dstContainerName, dstAccountName, err)
 	}
+	return nil
+}
 
-	resourceGroupName, accountName, containerName, _, subsID, err := GetContainerInfo(volumeID)
+// copyDestinationClient reads and records the copy source of the destination container of volume clone
+type copyDestinationClient interface {
+	// Get returns whether the container has any blob and the container metadata
+	Get(ctx context.Context, accountName, accountKey, containerName string) (bool, map[string]string, error)
+	// SetCopySource creates the container if it does not exist and records the copy source in container metadata
+	SetCopySource(ctx context.Context, accountName, accountKey, containerName, copySource string) error
+}
+
+// sharedKeyCopyDestinationClient accesses the container through data plane container reference with account key,
+// container which does not exist has no blob
+type sharedKeyCopyDestinationClient struct {
+	env az.Environment
+}
+
+func (c *sharedKeyCopyDestinationClient) Get(_ context.Context, accountName, accountKey, containerName string) (bool, map[string]string, error) {
+	container, err := getContainerReference(containerName, createStorageAccountSecret(accountName, accountKey), c.env)
 	if err != nil {
-		klog.Errorf("GetContainerInfo(%s) in ValidateVolumeCapabilities failed with error: %v", volumeID, err)
-		return nil, status.Error(codes.NotFound, err.Error())
+		return false, nil, err
+	}
+	exists, err := container.Exists()
+	if err != nil || !exists {
+		return false, nil, err
+	}
+	if err := container.GetMetadata(nil); err != nil {
+		return false, nil, err
+	}
+	resp, err := container.ListBlobs(azstorage.ListBlobsParameters{MaxResults: 1})
+	if err != nil {
+		return false, nil, err
 	}
+	return len(resp.Blobs) > 0, container.Metadata, nil
+}
 
-	var exist bool
-	secrets := req.GetSecrets()
-	if len(secrets) > 0 {
-		container, err := getContainerReference(containerName, secrets, d.cloud.Environment)
-		if err != nil {
-			return nil, status.Error(codes.Internal, err.Error())
-		}
-		exist, err = container.Exists()
+func (c *sharedKeyCopyDestinationClient) SetCopySource(_ context.Context, accountName, accountKey, containerName, copySource string) error {
+	container, err := getContainerReference(containerName, createStorageAccountSecret(accountName, accountKey), c.env)
+	if err != nil {
+		return err
+	}
+	container.Metadata = map[string]string{copySourceMetadataKey: copySource}
+	created, err := container.CreateIfNotExists(nil)
+	if err != nil || created {
+		return err
+	}
+	if err := container.GetMetadata(nil); err != nil {
+		return err
+	}
+	if container.Metadata == nil {
+		container.Metadata = map[string]string{}
+	}
+	container.Metadata[copySourceMetadataKey] = copySource
+	return container.SetMetadata(nil)
+}
+
+// AzcopyJobStatus is the status of an in-flight azcopy clone job
+type AzcopyJobStatus struct {
+	Container string
+	State     util.AzcopyJobState
+	Percent   string
+}
+
+// GetAzcopyJobs returns status of azcopy clone jobs of the destination containers tracked by copyBlobContainer,
+// sorted by container name
+func (d *Driver) GetAzcopyJobs() []AzcopyJobStatus {
+	var jobs []AzcopyJobStatus
+	d.azcopyJobContainers.Range(func(key, _ interface{}) bool {
+		container := key.(string)
+		jobState, percent, _, err := d.azcopy.GetAzcopyJob(container)
 		if err != nil {
-			return nil, status.Error(codes.Internal, err.Error())
+			klog.Warningf("failed to get azcopy job copying to %s: %v", container, err)
 		}
-	} else {
+		jobs = append(jobs, AzcopyJobStatus{Container: container, State: jobState, Percent: percent})
+		return true
+	})
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Container < jobs[j].Container })
+	return jobs
+}
+
+// logAzcopyJobs logs status of in-flight azcopy clone jobs so that stuck clones could be found without grepping logs
+func (d *Driver) logAzcopyJobs() {
+	jobs := d.GetAzcopyJobs()
+	klog.V(2).Infof("%d in-flight azcopy clone jobs", len(jobs))
+	for _, job := range jobs {
+		klog.V(2).InfoS("in-flight azcopy clone job", "container", job.Container, "jobState", job.State, "percent", job.Percent)
+	}
+}
+
+// generateCopySASTokens returns the sas tokens of source and destination containers in volume clone,
+// source account key is looked up if source and destination are in different accounts
+func (d *Driver) generateCopySASTokens(ctx context.Context, resourceGroupName, accountName, srcContainerName, subsID, secretNamespace, dstAccountName, dstAccountKey, dstContainerName, storageEndpointSuffix string, getLatestAccountKey bool) (string, string, error) {
+	var srcSasToken, dstSasToken string
+	var err error
+	srcAccountKey := dstAccountKey
+	if dstAccountName != accountName {
 		if resourceGroupName == "" {
 			resourceGroupName = d.cloud.ResourceGroup
 		}
-		blobContainer, retryErr := d.cloud.BlobClient.GetContainer(ctx, subsID, resourceGroupName, accountName, containerName)
-		err = retryErr.Error()
-		if err != nil {
-			return nil, status.Error(codes.Internal, err.Error())
+		accountOptions := &azure.AccountOptions{
+			Name:                accountName,
+			ResourceGroup:       resourceGroupName,
+			SubscriptionID:      subsID,
+			GetLatestAccountKey: getLatestAccountKey,
 		}
-		if blobContainer.ContainerProperties == nil {
-			return nil, status.Errorf(codes.Internal, "ContainerProperties of volume(%s) is nil", volumeID)
+		if _, srcAccountKey, err = d.GetStorageAccesskey(ctx, accountOptions, nil, "", secretNamespace, nil); err != nil {
+			return "", "", status.Errorf(codes.Internal, "failed to GetStorageAccesskey on source account(%s) rg(%s), error: %v", accountName, resourceGroupName, err)
 		}
-		exist = blobContainer.ContainerProperties.Deleted != nil && !*blobContainer.ContainerProperties.Deleted
 	}
-	if !exist {
-		return nil, status.Errorf(codes.NotFound, "requested volume(%s) does not exist", volumeID)
+	// source is only read and listed, destination is only written by azcopy,
+	// sas tokens are cached so that retries of an in-flight clone reuse the same tokens
+	if d.useContainerSasToken {
+		srcPermissions, dstPermissions := sas.ContainerPermissions{Read: true, List: true}, sas.ContainerPermissions{Write: true}
+		if srcSasToken, err = d.getCachedSASToken(getSASTokenCacheKey(containerSASType, accountName, srcAccountKey, srcContainerName, srcPermissions.String()), func() (string, error) {
+			klog.V(2).Infof("generate container sas token for container(%s) on account(%s)", srcContainerName, accountName)
+			return generateContainerSASToken(accountName, srcAccountKey, storageEndpointSuffix, srcContainerName, d.sasTokenExpirationMinutes, srcPermissions)
+		}); err != nil {
+			return "", "", err
+		}
+		if dstSasToken, err = d.getCachedSASToken(getSASTokenCacheKey(containerSASType, dstAccountName, dstAccountKey, dstContainerName, dstPermissions.String()), func() (string, error) {
+			klog.V(2).Infof("generate container sas token for container(%s) on account(%s)", dstContainerName, dstAccountName)
+			return generateContainerSASToken(dstAccountName, dstAccountKey, storageEndpointSuffix, dstContainerName, d.sasTokenExpirationMinutes, dstPermissions)
+		}); err != nil {
+			return "", "", err
+		}
+	} else {
+		srcPermissions, dstPermissions := sas.AccountPermissions{Read: true, List: true}, sas.AccountPermissions{Write: true}
+		if srcSasToken, err = d.getCachedSASToken(getSASTokenCacheKey(accountSASType, accountName, srcAccountKey, "", srcPermissions.String()), func() (string, error) {
+			klog.V(2).Infof("generate sas token for account(%s)", accountName)
+			return generateSASTokenWithPermissions(accountName, srcAccountKey, storageEndpointSuffix, d.sasTokenExpirationMinutes, srcPermissions)
+		}); err != nil {
+			return "", "", err
+		}
+		if dstSasToken, err = d.getCachedSASToken(getSASTokenCacheKey(accountSASType, dstAccountName, dstAccountKey, "", dstPermissions.String()), func() (string, error) {
+			klog.V(2).Infof("generate sas token for account(%s)", dstAccountName)
+			return generateSASTokenWithPermissions(dstAccountName, dstAccountKey, storageEndpointSuffix, d.sasTokenExpirationMinutes, dstPermissions)
+		}); err != nil {
+			return "", "", err
+		}
 	}
-	klog.V(2).Infof("ValidateVolumeCapabilities on volume(%s) succeeded", volumeID)
-
-	// blob driver supports all AccessModes, no need to check capabilities here
-	return &csi.ValidateVolumeCapabilitiesResponse{
-		Confirmed: &csi.ValidateVolumeCapabilitiesResponse_Confirmed{
-			VolumeCapabilities: req.GetVolumeCapabilities(),
-		},
-		Message: "",
-	}, nil
+	return srcSasToken, dstSasToken, nil
 }
 
-func (d *Driver) ControllerPublishVolume(ctx context.Context, req *csi.ControllerPublishVolumeRequest) (*csi.ControllerPublishVolumeResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "ControllerPublishVolume is not yet implemented")
+// generateCopyUserDelegationSASTokens returns the user delegation sas tokens of source and destination containers
+// in volume clone, user delegation keys are requested with driver identity so that account keys are not needed
+func (d *Driver) generateCopyUserDelegationSASTokens(ctx context.Context, accountName, srcContainerName, dstAccountName, dstContainerName, storageEndpointSuffix string) (string, string, error) {
+	credential, err := d.getStorageTokenCredential()
+	if err != nil {
+		return "", "", status.Errorf(codes.Internal, "failed to get token credential to generate user delegation sas token, error: %v", err)
+	}
+	srcPermissions, dstPermissions := sas.ContainerPermissions{Read: true, List: true}, sas.ContainerPermissions{Write: true}
+	srcSasToken, err := d.getCachedSASToken(getSASTokenCacheKey(userDelegationSASType, accountName, "", srcContainerName, srcPermissions.String()), func() (string, error) {
+		klog.V(2).Infof("generate user delegation sas token for container(%s) on account(%s)", srcContainerName, accountName)
+		return generateUserDelegationSASToken(ctx, credential, accountName, storageEndpointSuffix, srcContainerName, d.sasTokenExpirationMinutes, srcPermissions)
+	})
+	if err != nil {
+		return "", "", err
+	}
+	dstSasToken, err := d.getCachedSASToken(getSASTokenCacheKey(userDelegationSASType, dstAccountName, "", dstContainerName, dstPermissions.String()), func() (string, error) {
+		klog.V(2).Infof("generate user delegation sas token for container(%s) on account(%s)", dstContainerName, dstAccountName)
+		return generateUserDelegationSASToken(ctx, credential, dstAccountName, storageEndpointSuffix, dstContainerName, d.sasTokenExpirationMinutes, dstPermissions)
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return srcSasToken, dstSasToken, nil
 }
 
-func (d *Driver) ControllerUnpublishVolume(ctx context.Context, req *csi.ControllerUnpublishVolumeRequest) (*csi.ControllerUnpublishVolumeResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "ControllerUnpublishVolume is not yet implemented")
+// copyVolume copies a volume form volume or snapshot, snapshot is copied from its snapshot container
+func (d *Driver) copyVolume(ctx context.Context, req *csi.CreateVolumeRequest, dstAccountName, dstAccountKey, dstContainerName, storageEndpointSuffix string, useUserDelegationSAS bool, azcopyRetryCount int, copyTimeout time.Duration, preservePermissions bool) error {
+	_, sasURLs, err := splitCloneSasURLs(req.GetSecrets())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	vs := req.VolumeContentSource
+	switch vs.Type.(type) {
+	case *csi.VolumeContentSource_Snapshot:
+		sourceVolumeID, err := d.getSnapshotSourceVolumeID(ctx, vs.GetSnapshot().GetSnapshotId())
+		if err != nil {
+			return err
+		}
+		return d.copyBlobContainer(ctx, sourceVolumeID, dstAccountName, dstAccountKey, sasURLs, dstContainerName, storageEndpointSuffix, useUserDelegationSAS, azcopyRetryCount, copyTimeout, preservePermissions)
+	case *csi.VolumeContentSource_Volume:
+		return d.copyBlobContainer(ctx, req.GetVolumeContentSource().GetVolume().GetVolumeId(), dstAccountName, dstAccountKey, sasURLs, dstContainerName, storageEndpointSuffix, useUserDelegationSAS, azcopyRetryCount, copyTimeout, preservePermissions)
+	default:
+		return status.Errorf(codes.InvalidArgument, "%v is not a proper volume source", vs)
+	}
 }
 
-// ControllerGetVolume get volume
-func (d *Driver) ControllerGetVolume(context.Context, *csi.ControllerGetVolumeRequest) (*csi.ControllerGetVolumeResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "ControllerGetVolume is not yet implemented")
+// cloneSasURLs holds sas urls of source and destination containers supplied in secrets for volume cloning,
+// or a single sas token with "?" prefix used for both containers when cloning in the same account
+type cloneSasURLs struct {
+	source      string
+	destination string
+	token       string
 }
 
-// GetCapacity returns the capacity of the total available storage pool
-func (d *Driver) GetCapacity(ctx context.Context, req *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "GetCapacity is not yet implemented")
+// splitCloneSasURLs removes sas urls or sas token for volume cloning from secrets, nil cloneSasURLs is returned if
+// they are not supplied, source and destination sas urls should be supplied together and not with sas token
+func splitCloneSasURLs(secrets map[string]string) (map[string]string, *cloneSasURLs, error) {
+	var urls cloneSasURLs
+	var found bool
+	remaining := make(map[string]string, len(secrets))
+	for k, v := range secrets {
+		switch strings.ToLower(k) {
+		case sourceSasURLField:
+			urls.source = strings.TrimSpace(v)
+			found = true
+		case destinationSasURLField:
+			urls.destination = strings.TrimSpace(v)
+			found = true
+		case cloneSasTokenField:
+			urls.token = strings.TrimSpace(v)
+			found = true
+		default:
+			remaining[k] = v
+		}
+	}
+	if !found {
+		return secrets, nil, nil
+	}
+	if urls.token != "" {
+		if urls.source != "" || urls.destination != "" {
+			return nil, nil, fmt.Errorf("%s could not be supplied together with %s or %s in secrets for volume cloning", cloneSasTokenField, sourceSasURLField, destinationSasURLField)
+		}
+		token, err := normalizeSasToken(urls.token)
+		if err != nil {
+			return nil, nil, err
+		}
+		urls.token = token
+		return remaining, &urls, nil
+	}
+	if urls.source == "" || urls.destination == "" {
+		return nil, nil, fmt.Errorf("both %s and %s should be supplied in secrets for volume cloning", sourceSasURLField, destinationSasURLField)
+	}
+	return remaining, &urls, nil
 }
 
-// ListVolumes return all available volumes
-func (d *Driver) ListVolumes(ctx context.Context, req *csi.ListVolumesRequest) (*csi.ListVolumesResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "ListVolumes is not yet implemented")
+// normalizeSasToken returns sas token with "?" prefix which is appended to container url by azcopy,
+// sas token is never included in the error
+func normalizeSasToken(token string) (string, error) {
+	token = "?" + strings.TrimPrefix(token, "?")
+	query, err := url.ParseQuery(token[1:])
+	if err != nil {
+		return "", fmt.Errorf("could not parse %s in secrets", cloneSasTokenField)
+	}
+	if query.Get("sig") == "" {
+		return "", fmt.Errorf("%s in secrets does not contain signature", cloneSasTokenField)
+	}
+	return token, nil
 }
 
-// CreateSnapshot create snapshot
-func (d *Driver) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequest) (*csi.CreateSnapshotResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "CreateSnapshot is not yet implemented")
+// getSasTokenFromURL returns sas token with "?" prefix of the container sas url, error is returned if the url
+// does not point to the container on the account, sas token is never included in the error
+func getSasTokenFromURL(sasURL, accountName, containerName, storageEndpointSuffix string) (string, error) {
+	u, err := url.Parse(sasURL)
+	if err != nil {
+		return "", fmt.Errorf("could not parse sas url of container(%s)", containerName)
+	}
+	endpoint := fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+	if !strings.EqualFold(endpoint, getBlobEndpoint(accountName, storageEndpointSuffix)) || strings.Trim(u.Path, "/") != containerName {
+		return "", fmt.Errorf("sas url(%s%s) does not point to container(%s) on account(%s)", endpoint, u.Path, containerName, accountName)
+	}
+	if u.Query().Get("sig") == "" {
+		return "", fmt.Errorf("sas url(%s%s) does not contain signature", endpoint, u.Path)
+	}
+	return "?" + u.RawQuery, nil
 }
 
-// DeleteSnapshot delete snapshot
-func (d *Driver) DeleteSnapshot(ctx context.Context, req *csi.DeleteSnapshotRequest) (*csi.DeleteSnapshotResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "DeleteSnapshot is not yet implemented")
+// getSnapshotSourceVolumeID returns a volume ID pointing to the snapshot container of the snapshot,
+// NotFound error is returned if the snapshot container does not exist
+func (d *Driver) getSnapshotSourceVolumeID(ctx context.Context, snapshotID string) (string, error) {
+	resourceGroupName, accountName, containerName, secretNamespace, subsID, err := GetSnapshotInfo(snapshotID)
+	if err != nil {
+		return "", status.Error(codes.NotFound, err.Error())
+	}
+	if resourceGroupName == "" {
+		resourceGroupName = d.cloud.ResourceGroup
+	}
+	if d.cloud.BlobClient == nil {
+		return "", status.Error(codes.Internal, "BlobClient is nil")
+	}
+	container, rerr := d.cloud.BlobClient.GetContainer(ctx, subsID, resourceGroupName, accountName, containerName)
+	if rerr != nil {
+		if strings.Contains(rerr.Error().Error(), httpCodeNotFound) {
+			return "", status.Errorf(codes.NotFound, "snapshot container(%s) of snapshot(%s) is not found on account(%s) rg(%s)", containerName, snapshotID, accountName, resourceGroupName)
+		}
+		return "", status.Errorf(codes.Internal, "failed to get snapshot container(%s) on account(%s) rg(%s), error: %v", containerName, accountName, resourceGroupName, rerr.Error())
+	}
+	if container.ContainerProperties != nil && pointer.BoolDeref(container.ContainerProperties.Deleted, false) {
+		return "", status.Errorf(codes.NotFound, "snapshot container(%s) of snapshot(%s) is deleted on account(%s) rg(%s)", containerName, snapshotID, accountName, resourceGroupName)
+	}
+	// snapshot container is on the endpoint recorded in snapshot id, empty means the cloud default
+	storageEndpointSuffix := getStorageEndpointSuffixFromSnapshotID(snapshotID)
+	return d.formatVolumeID(fmt.Sprintf(volumeIDV2Template, resourceGroupName, accountName, containerName, "", secretNamespace, subsID, "", storageEndpointSuffix, "")), nil
 }
 
-// ListSnapshots list snapshots
-func (d *Driver) ListSnapshots(ctx context.Context, req *csi.ListSnapshotsRequest) (*csi.ListSnapshotsResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "ListSnapshots is not yet implemented")
+// getCopyPollInterval returns the interval before polling azcopy job status next time,
+// it polls less frequently in the early stage of copy and more frequently near completion,
+// jitter is added to spread out polls of concurrent clones
+func getCopyPollInterval(baseInterval, maxInterval time.Duration, jitterFactor float64, percent string) time.Duration {
+	if baseInterval <= 0 {
+		baseInterval = waitForCopyInterval
+	}
+	if maxInterval < baseInterval {
+		maxInterval = baseInterval
+	}
+	interval := baseInterval
+	if p, err := strconv.ParseFloat(strings.TrimSpace(percent), 64); err == nil && p >= 0 && p <= 100 {
+		interval = baseInterval + time.Duration(float64(maxInterval-baseInterval)*(100-p)/100)
+	}
+	if jitterFactor > 0 {
+		interval = wait.Jitter(interval, jitterFactor)
+	}
+	return interval
 }
 
-// ControllerGetCapabilities returns the capabilities of the Controller plugin
-func (d *Driver) ControllerGetCapabilities(ctx context.Context, req *csi.ControllerGetCapabilitiesRequest) (*csi.ControllerGetCapabilitiesResponse, error) {
-	return &csi.ControllerGetCapabilitiesResponse{
-		Capabilities: d.Cap,
-	}, nil
+// getJitteredBackoff returns backoff with jitter applied to its steps, so that retries of concurrent
+// requests, e.g. from multiple controllers throttled at the same time, are spread out
+func getJitteredBackoff(backoff wait.Backoff, jitterFactor float64) wait.Backoff {
+	if jitterFactor > backoff.Jitter {
+		backoff.Jitter = jitterFactor
+	}
+	return backoff
 }
 
-// ControllerExpandVolume controller expand volume
-func (d *Driver) ControllerExpandVolume(ctx context.Context, req *csi.ControllerExpandVolumeRequest) (*csi.ControllerExpandVolumeResponse, error) {
-	if len(req.GetVolumeId()) == 0 {
-		return nil, status.Error(codes.InvalidArgument, "Volume ID missing in request")
+// getContainerPublicAccess returns container public access level, the value is case insensitive
+// and PublicAccessNone is returned if publicAccess is empty
+func getContainerPublicAccess(publicAccess string) (storage.PublicAccess, error) {
+	if publicAccess == "" {
+		return storage.PublicAccessNone, nil
 	}
-
-	if req.GetCapacityRange() == nil {
-		return nil, status.Error(codes.InvalidArgument, "Capacity Range missing in request")
+	for _, v := range supportedPublicAccessList {
+		if strings.EqualFold(v, publicAccess) {
+			return storage.PublicAccess(v), nil
+		}
 	}
+	return "", fmt.Errorf("containerPublicAccess(%s) is not supported, supported list: %v", publicAccess, supportedPublicAccessList)
+}
 
-	if err := d.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_EXPAND_VOLUME); err != nil {
-		return nil, status.Errorf(codes.Internal, "invalid expand volume req: %v", req)
+// getContainerAccessType maps container public access level to the access type of legacy data plane API
+func getContainerAccessType(publicAccess storage.PublicAccess) azstorage.ContainerAccessType {
+	switch publicAccess {
+	case storage.PublicAccessBlob:
+		return azstorage.ContainerAccessTypeBlob
+	case storage.PublicAccessContainer:
+		return azstorage.ContainerAccessTypeContainer
 	}
+	return azstorage.ContainerAccessTypePrivate
+}
 
-	volSizeBytes := int64(req.GetCapacityRange().GetRequiredBytes())
-	requestGiB := int64(util.RoundUpGiB(volSizeBytes))
-
-	if volSizeBytes > containerMaxSize {
-		return nil, status.Errorf(codes.OutOfRange, "required bytes (%d) exceeds the maximum supported bytes (%d)", volSizeBytes, containerMaxSize)
+// getPublicAccessType maps container public access level to the access type of track2 data plane API,
+// nil means private access
+func getPublicAccessType(publicAccess storage.PublicAccess) *container.PublicAccessType {
+	switch publicAccess {
+	case storage.PublicAccessBlob:
+		return to.Ptr(container.PublicAccessTypeBlob)
+	case storage.PublicAccessContainer:
+		return to.Ptr(container.PublicAccessTypeContainer)
 	}
+	return nil
+}
 
-	klog.V(2).Infof("ControllerExpandVolume(%s) successfully, currentQuota: %d Gi", req.VolumeId, requestGiB)
-
-	return &csi.ControllerExpandVolumeResponse{CapacityBytes: req.GetCapacityRange().GetRequiredBytes()}, nil
+// getMinimumTLSVersion returns minimum TLS version of storage account, the value is case insensitive
+func getMinimumTLSVersion(version string) (storage.MinimumTLSVersion, error) {
+	for _, v := range supportedMinimumTLSVersions {
+		if strings.EqualFold(v, version) {
+			return storage.MinimumTLSVersion(v), nil
+		}
+	}
+	return "", fmt.Errorf("minimumTlsVersion(%s) is not supported, supported list: %v", version, supportedMinimumTLSVersions)
 }
 
-// CreateBlobContainer creates a blob container
-func (d *Driver) CreateBlobContainer(ctx context.Context, subsID, resourceGroupName, accountName, containerName string, secrets map[string]string) error {
-	if containerName == "" {
-		return fmt.Errorf("containerName is empty")
+// getNetworkDefaultAction returns default action of storage account network rule set, the value is case insensitive
+func getNetworkDefaultAction(action string) (storage.DefaultAction, error) {
+	for _, v := range supportedDefaultActions {
+		if strings.EqualFold(v, action) {
+			return storage.DefaultAction(v), nil
+		}
 	}
-	return wait.ExponentialBackoff(d.cloud.RequestBackoff(), func() (bool, error) {
-		var err error
-		if len(secrets) > 0 {
-			container, getErr := getContainerReference(containerName, secrets, d.cloud.Environment)
-			if getErr != nil {
-				return true, getErr
+	return "", fmt.Errorf("networkDefaultAction(%s) is not supported, supported list: %v", action, supportedDefaultActions)
+}
+
+// parseAllowedIPRanges parses comma separated IPv4 addresses or CIDR ranges of storage account IP rules,
+// storage account does not support /31 and /32 ranges, /32 range is converted to the IP address
+func parseAllowedIPRanges(value string) ([]string, error) {
+	var ipRanges []string
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		ipRange := v
+		if ip := net.ParseIP(v); ip != nil {
+			if ip.To4() == nil {
+				return nil, fmt.Errorf("invalid allowedIpRanges: %s, only IPv4 address is allowed", v)
 			}
-			_, err = container.CreateIfNotExists(&azstorage.CreateContainerOptions{Access: azstorage.ContainerAccessTypePrivate})
+			ipRange = ip.String()
 		} else {
-			blobContainer := storage.BlobContainer{
-				ContainerProperties: &storage.ContainerProperties{
-					PublicAccess: storage.PublicAccessNone,
-				},
+			ip, ipNet, err := net.ParseCIDR(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid allowedIpRanges: %s, should be IPv4 address or CIDR range", v)
 			}
-			err = d.cloud.BlobClient.CreateContainer(ctx, subsID, resourceGroupName, accountName, containerName, blobContainer).Error()
-		}
-		if err != nil {
-			if strings.Contains(err.Error(), containerBeingDeletedDataplaneAPIError) ||
-				strings.Contains(err.Error(), containerBeingDeletedManagementAPIError) {
-				klog.Warningf("CreateContainer(%s, %s, %s) failed with error(%v), retry", resourceGroupName, accountName, containerName, err)
-				return false, nil
+			if ip.To4() == nil {
+				return nil, fmt.Errorf("invalid allowedIpRanges: %s, only IPv4 range is allowed", v)
 			}
-		}
-		return true, err
-	})
-}
-
-// DeleteBlobContainer deletes a blob container
-func (d *Driver) DeleteBlobContainer(ctx context.Context, subsID, resourceGroupName, accountName, containerName string, secrets map[string]string) error {
-	if containerName == "" {
-		return fmt.Errorf("containerName is empty")
-	}
-	return wait.ExponentialBackoff(d.cloud.RequestBackoff(), func() (bool, error) {
-		var err error
-		if len(secrets) > 0 {
-			container, getErr := getContainerReference(containerName, secrets, d.cloud.Environment)
-			if getErr != nil {
-				return true, getErr
+			switch ones, _ := ipNet.Mask.Size(); ones {
+			case 32:
+				ipRange = ip.String()
+			case 31:
+				return nil, fmt.Errorf("invalid allowedIpRanges: %s, /31 range is not supported, use individual IP addresses instead", v)
+			default:
+				ipRange = ipNet.String()
 			}
-			_, err = container.DeleteIfExists(nil)
-		} else {
-			err = d.cloud.BlobClient.DeleteContainer(ctx, subsID, resourceGroupName, accountName, containerName).Error()
 		}
-		if err != nil {
-			if strings.Contains(err.Error(), containerBeingDeletedDataplaneAPIError) ||
-				strings.Contains(err.Error(), containerBeingDeletedManagementAPIError) ||
-				strings.Contains(err.Error(), statusCodeNotFound) ||
-				strings.Contains(err.Error(), httpCodeNotFound) {
-				klog.Warningf("delete container(%s) on account(%s) failed with error(%v), return as success", containerName, accountName, err)
-				return true, nil
-			}
-			return false, fmt.Errorf("failed to delete container(%s) on account(%s), error: %w", containerName, accountName, err)
+		if !util.ContainsString(ipRanges, ipRange, nil) {
+			ipRanges = append(ipRanges, ipRange)
 		}
-		return true, err
-	})
-}
-
-// CopyBlobContainer copies a blob container in the same storage account
-func (d *Driver) copyBlobContainer(ctx context.Context, req *csi.CreateVolumeRequest, accountKey, dstContainerName, storageEndpointSuffix string) error {
-	var sourceVolumeID string
-	if req.GetVolumeContentSource() != nil && req.GetVolumeContentSource().GetVolume() != nil {
-		sourceVolumeID = req.GetVolumeContentSource().GetVolume().GetVolumeId()
-
-	}
-	resourceGroupName, accountName, srcContainerName, _, _, err := GetContainerInfo(sourceVolumeID) //nolint:dogsled
-	if err != nil {
-		return status.Error(codes.NotFound, err.Error())
-	}
-	if srcContainerName == "" || dstContainerName == "" {
-		return fmt.Errorf("srcContainerName(%s) or dstContainerName(%s) is empty", srcContainerName, dstContainerName)
 	}
+	return ipRanges, nil
+}
 
-	klog.V(2).Infof("generate sas token for account(%s)", accountName)
-	accountSasToken, genErr := generateSASToken(accountName, accountKey, storageEndpointSuffix, d.sasTokenExpirationMinutes)
-	if genErr != nil {
-		return genErr
+// applyExposurePreset expands exposure preset into networkEndpointType and allowBlobPublicAccess settings,
+// returns error if the preset conflicts with explicitly specified settings
+//   - private: no public blob access, access through private endpoint
+//   - internal: no public blob access, access through service endpoint of the vnet
+//   - public: anonymous blob read access with public network access
+func applyExposurePreset(exposure, protocol string, networkEndpointType *string, allowBlobPublicAccess **bool) error {
+	switch exposure {
+	case exposurePrivate:
+		if pointer.BoolDeref(*allowBlobPublicAccess, false) {
+			return fmt.Errorf("allowBlobPublicAccess could not be true when exposure is %s", exposure)
+		}
+		if *networkEndpointType != "" && !strings.EqualFold(*networkEndpointType, privateEndpoint) {
+			return fmt.Errorf("networkEndpointType(%s) conflicts with exposure(%s)", *networkEndpointType, exposure)
+		}
+		*networkEndpointType = privateEndpoint
+		*allowBlobPublicAccess = pointer.Bool(false)
+	case exposureInternal:
+		if pointer.BoolDeref(*allowBlobPublicAccess, false) {
+			return fmt.Errorf("allowBlobPublicAccess could not be true when exposure is %s", exposure)
+		}
+		if *networkEndpointType != "" {
+			return fmt.Errorf("networkEndpointType(%s) conflicts with exposure(%s)", *networkEndpointType, exposure)
+		}
+		*allowBlobPublicAccess = pointer.Bool(false)
+	case exposurePublic:
+		if !pointer.BoolDeref(*allowBlobPublicAccess, true) {
+			return fmt.Errorf("allowBlobPublicAccess could not be false when exposure is %s", exposure)
+		}
+		if *networkEndpointType != "" {
+			return fmt.Errorf("networkEndpointType(%s) conflicts with exposure(%s)", *networkEndpointType, exposure)
+		}
+		if protocol == NFS {
+			return fmt.Errorf("exposure(%s) is not supported for NFS protocol", exposure)
+		}
+		*allowBlobPublicAccess = pointer.Bool(true)
+	default:
+		return fmt.Errorf("exposure(%s) is not supported, supported exposure list: %v", exposure, supportedExposureList)
 	}
+	return nil
+}
 
-	timeAfter := time.After(waitForCopyTimeout)
-	timeTick := time.Tick(waitForCopyInterval)
-	srcPath := fmt.Sprintf("https://%s.blob.%s/%s%s", accountName, storageEndpointSuffix, srcContainerName, accountSasToken)
-	dstPath := fmt.Sprintf("https://%s.blob.%s/%s%s", accountName, storageEndpointSuffix, dstContainerName, accountSasToken)
-
-	jobState, percent, err := d.azcopy.GetAzcopyJob(dstContainerName)
-	klog.V(2).Infof("azcopy job status: %s, copy percent: %s%%, error: %v", jobState, percent, err)
-	if jobState == util.AzcopyJobError || jobState == util.AzcopyJobCompleted {
-		return err
-	}
-	klog.V(2).Infof("begin to copy blob container %s to %s", srcContainerName, dstContainerName)
-	for {
-		select {
-		case <-timeTick:
-			jobState, percent, err := d.azcopy.GetAzcopyJob(dstContainerName)
-			klog.V(2).Infof("azcopy job status: %s, copy percent: %s%%, error: %v", jobState, percent, err)
-			switch jobState {
-			case util.AzcopyJobError, util.AzcopyJobCompleted:
-				return err
-			case util.AzcopyJobNotFound:
-				klog.V(2).Infof("copy blob container %s to %s", srcContainerName, dstContainerName)
-				out, copyErr := exec.Command("azcopy", "copy", srcPath, dstPath, "--recursive", "--check-length=false").CombinedOutput()
-				if copyErr != nil {
-					klog.Warningf("CopyBlobContainer(%s, %s, %s) failed with error(%v): %v", resourceGroupName, accountName, dstPath, copyErr, string(out))
-				} else {
-					klog.V(2).Infof("copied blob container %s to %s successfully", srcContainerName, dstContainerName)
-				}
-				return copyErr
-			}
-		case <-timeAfter:
-			return fmt.Errorf("timeout waiting for copy blob container %s to %s succeed", srcContainerName, dstContainerName)
+// getBlobInventorySchedule returns the blob inventory schedule, case insensitive
+func getBlobInventorySchedule(schedule string) (storage.Schedule, error) {
+	for _, v := range storage.PossibleScheduleValues() {
+		if strings.EqualFold(schedule, string(v)) {
+			return v, nil
 		}
 	}
+	return "", fmt.Errorf("invalid %s: %s in storage class, supported values: %v", blobInventoryScheduleField, schedule, storage.PossibleScheduleValues())
 }
 
-// copyVolume copies a volume form volume or snapshot, snapshot is not supported now
-func (d *Driver) copyVolume(ctx context.Context, req *csi.CreateVolumeRequest, accountKey, dstContainerName, storageEndpointSuffix string) error {
-	vs := req.VolumeContentSource
-	switch vs.Type.(type) {
-	case *csi.VolumeContentSource_Snapshot:
-		return status.Errorf(codes.InvalidArgument, "copy volume from volumeSnapshot is not supported")
-	case *csi.VolumeContentSource_Volume:
-		return d.copyBlobContainer(ctx, req, accountKey, dstContainerName, storageEndpointSuffix)
-	default:
-		return status.Errorf(codes.InvalidArgument, "%v is not a proper volume source", vs)
+// getBlobInventoryFormat returns the blob inventory format, case insensitive
+func getBlobInventoryFormat(format string) (storage.Format, error) {
+	for _, v := range storage.PossibleFormatValues() {
+		if strings.EqualFold(format, string(v)) {
+			return v, nil
+		}
 	}
+	return "", fmt.Errorf("invalid %s: %s in storage class, supported values: %v", blobInventoryFormatField, format, storage.PossibleFormatValues())
 }
 
 // isValidVolumeCapabilities validates the given VolumeCapability array is valid
@@ -809,31 +5036,85 @@ func isValidVolumeCapabilities(volCaps []*csi.VolumeCapability) error {
 	return nil
 }
 
-func parseDays(dayStr string) (int32, error) {
+// isDisabledDays returns true if soft delete policy is disabled explicitly by 0 retention days
+func isDisabledDays(days *int32) bool {
+	return days != nil && *days == 0
+}
+
+// parseDays parses retention days of soft delete policy, 0 means the policy is disabled explicitly
+func parseDays(field, dayStr string) (*int32, error) {
 	days, err := strconv.Atoi(dayStr)
 	if err != nil {
-		return 0, status.Errorf(codes.InvalidArgument, fmt.Sprintf("invalid %s:%s in storage class", softDeleteBlobsField, dayStr))
+		return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("invalid %s:%s in storage class", field, dayStr))
 	}
-	if days <= 0 || days > 365 {
-		return 0, status.Errorf(codes.InvalidArgument, fmt.Sprintf("invalid %s:%s in storage class, should be in range [1, 365]", softDeleteBlobsField, dayStr))
+	if days < 0 || days > 365 {
+		return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("invalid %s:%s in storage class, should be in range [0, 365], 0 means disabled", field, dayStr))
+	}
+
+	return pointer.Int32(int32(days)), nil
+}
+
+// cachedSASToken is a sas token in sas token cache with its expiry time
+type cachedSASToken struct {
+	token  string
+	expiry time.Time
+}
+
+// getSASTokenCacheKey returns the key of sas token in cache, containerName is empty for account sas token,
+// accountKey is empty for user delegation sas token, a hash of the account key is in the cache key so that
+// sas tokens signed by a rotated account key are never reused
+func getSASTokenCacheKey(sasType, accountName, accountKey, containerName, permissions string) string {
+	var keyHash string
+	if accountKey != "" {
+		sum := sha256.Sum256([]byte(accountKey))
+		keyHash = hex.EncodeToString(sum[:8])
 	}
+	return fmt.Sprintf("%s#%s#%s#%s#%s", sasType, accountName, keyHash, containerName, permissions)
+}
 
-	return int32(days), nil
+// getCachedSASToken returns the sas token in cache, a new sas token is generated and cached on cache miss,
+// cached sas token is only reused when more than half of its lifetime is left so that azcopy job started with it
+// has enough time to finish
+func (d *Driver) getCachedSASToken(key string, generate func() (string, error)) (string, error) {
+	cache, err := d.sasTokenCache.Get(key, azcache.CacheReadTypeDefault)
+	if err != nil {
+		return "", err
+	}
+	lifetime := time.Duration(d.sasTokenExpirationMinutes) * time.Minute
+	if cache != nil {
+		if cached := cache.(*cachedSASToken); time.Until(cached.expiry) > lifetime/2 {
+			klog.V(4).Infof("use cached sas token(%s)", key)
+			return cached.token, nil
+		}
+	}
+	// expiry of the generated sas token is not earlier than this
+	expiry := time.Now().Add(lifetime)
+	token, err := generate()
+	if err != nil {
+		return "", err
+	}
+	d.sasTokenCache.Set(key, &cachedSASToken{token: token, expiry: expiry})
+	return token, nil
 }
 
-// generateSASToken generate a sas token for storage account
+// generateSASToken generate a sas token for storage account with read, list and write permissions
 func generateSASToken(accountName, accountKey, storageEndpointSuffix string, expiryTime int) (string, error) {
+	return generateSASTokenWithPermissions(accountName, accountKey, storageEndpointSuffix, expiryTime, sas.AccountPermissions{Read: true, List: true, Write: true})
+}
+
+// generateSASTokenWithPermissions generate a sas token for storage account with the permissions
+func generateSASTokenWithPermissions(accountName, accountKey, storageEndpointSuffix string, expiryTime int, permissions sas.AccountPermissions) (string, error) {
 	credential, err := azblob.NewSharedKeyCredential(accountName, accountKey)
 	if err != nil {
 		return "", status.Errorf(codes.Internal, fmt.Sprintf("failed to generate sas token in creating new shared key credential, accountName: %s, err: %s", accountName, err.Error()))
 	}
-	serviceClient, err := service.NewClientWithSharedKeyCredential(fmt.Sprintf("https://%s.blob.%s/", accountName, storageEndpointSuffix), credential, nil)
+	serviceClient, err := service.NewClientWithSharedKeyCredential(getBlobEndpoint(accountName, storageEndpointSuffix)+"/", credential, nil)
 	if err != nil {
 		return "", status.Errorf(codes.Internal, fmt.Sprintf("failed to generate sas token in creating new client with shared key credential, accountName: %s, err: %s", accountName, err.Error()))
 	}
 	sasURL, err := serviceClient.GetSASURL(
 		sas.AccountResourceTypes{Object: true, Service: false, Container: true},
-		sas.AccountPermissions{Read: true, List: true, Write: true},
+		permissions,
 		sas.AccountServices{Blob: true}, time.Now(), time.Now().Add(time.Duration(expiryTime)*time.Minute))
 	if err != nil {
 		return "", err
@@ -844,3 +5125,53 @@ func generateSASToken(accountName, accountKey, storageEndpointSuffix string, exp
 	}
 	return "?" + u.RawQuery, nil
 }
+
+// generateUserDelegationSASToken generate a user delegation sas token scoped to the container with the permissions,
+// the user delegation key is requested with the token credential which should have permission to generate it on the account
+func generateUserDelegationSASToken(ctx context.Context, credential azcore.TokenCredential, accountName, storageEndpointSuffix, containerName string, expiryTime int, permissions sas.ContainerPermissions) (string, error) {
+	serviceClient, err := service.NewClient(getBlobEndpoint(accountName, storageEndpointSuffix)+"/", credential, nil)
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "failed to generate user delegation sas token in creating new client with token credential, accountName: %s, err: %v", accountName, err)
+	}
+	startTime := time.Now().UTC()
+	expiry := startTime.Add(time.Duration(expiryTime) * time.Minute)
+	userDelegationCredential, err := serviceClient.GetUserDelegationCredential(ctx, service.KeyInfo{
+		Start:  to.Ptr(startTime.Format(sas.TimeFormat)),
+		Expiry: to.Ptr(expiry.Format(sas.TimeFormat)),
+	}, nil)
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "failed to get user delegation key on account(%s), err: %v", accountName, err)
+	}
+	queryParameters, err := sas.BlobSignatureValues{
+		Protocol:      sas.ProtocolHTTPS,
+		StartTime:     startTime,
+		ExpiryTime:    expiry,
+		Permissions:   permissions.String(),
+		ContainerName: containerName,
+	}.SignWithUserDelegation(userDelegationCredential)
+	if err != nil {
+		return "", err
+	}
+	return "?" + queryParameters.Encode(), nil
+}
+
+// generateContainerSASToken generate a service sas token scoped to the container with the permissions
+func generateContainerSASToken(accountName, accountKey, storageEndpointSuffix, containerName string, expiryTime int, permissions sas.ContainerPermissions) (string, error) {
+	credential, err := azblob.NewSharedKeyCredential(accountName, accountKey)
+	if err != nil {
+		return "", status.Errorf(codes.Internal, fmt.Sprintf("failed to generate sas token in creating new shared key credential, accountName: %s, err: %s", accountName, err.Error()))
+	}
+	containerClient, err := container.NewClientWithSharedKeyCredential(fmt.Sprintf("%s/%s", getBlobEndpoint(accountName, storageEndpointSuffix), containerName), credential, nil)
+	if err != nil {
+		return "", status.Errorf(codes.Internal, fmt.Sprintf("failed to generate sas token in creating new container client with shared key credential, accountName: %s, containerName: %s, err: %s", accountName, containerName, err.Error()))
+	}
+	sasURL, err := containerClient.GetSASURL(permissions, time.Now(), time.Now().Add(time.Duration(expiryTime)*time.Minute))
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(sasURL)
+	if err != nil {
+		return "", err
+	}
+	return "?" + u.RawQuery, nil
+}
@@ -18,14 +18,24 @@ package blob
 
 import (
 	"context"
+	"time"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/golang/protobuf/ptypes/wrappers"
 )
 
+const (
+	// timeout of listing storage accounts in Azure API reachability check of Probe
+	azureAPIProbeTimeout = 5 * time.Second
+	// result of Azure API reachability check is reused by Probe within the interval,
+	// so that frequent liveness probes do not call Azure API every time
+	azureAPIProbeInterval = time.Minute
+)
+
 // GetPluginInfo return the version and name of the plugin
 func (f *Driver) GetPluginInfo(ctx context.Context, req *csi.GetPluginInfoRequest) (*csi.GetPluginInfoResponse, error) {
 	if f.Name == "" {
@@ -43,24 +53,68 @@ func (f *Driver) GetPluginInfo(ctx context.Context, req *csi.GetPluginInfoReques
 }
 
 // Probe check whether the plugin is running or not.
-// This method does not need to return anything.
-// Currently the spec does not dictate what you should return either.
-// Hence, return an empty response
+// If Azure API probe failure threshold is set, Azure API reachability is checked and
+// not ready is returned once the check fails consecutively for threshold times,
+// so that the controller is restarted by liveness probe
 func (f *Driver) Probe(ctx context.Context, req *csi.ProbeRequest) (*csi.ProbeResponse, error) {
+	if f.azureAPIProbeFailureThreshold > 0 && !f.isAzureAPIReachable(ctx) {
+		return &csi.ProbeResponse{Ready: &wrappers.BoolValue{Value: false}}, nil
+	}
 	return &csi.ProbeResponse{Ready: &wrappers.BoolValue{Value: true}}, nil
 }
 
+// isAzureAPIReachable returns false once Azure API reachability check fails consecutively for threshold times,
+// the check is only run when the last check is older than azureAPIProbeInterval
+func (f *Driver) isAzureAPIReachable(ctx context.Context) bool {
+	f.azureAPIProbeMutex.Lock()
+	defer f.azureAPIProbeMutex.Unlock()
+	if time.Since(f.azureAPIProbeLastCheck) >= azureAPIProbeInterval {
+		f.azureAPIProbeLastCheck = time.Now()
+		if err := f.checkAzureAPIReachability(ctx); err != nil {
+			f.azureAPIProbeFailures++
+			klog.Warningf("Azure API reachability check failed(%d/%d) with error: %v", f.azureAPIProbeFailures, f.azureAPIProbeFailureThreshold, err)
+		} else {
+			f.azureAPIProbeFailures = 0
+		}
+	}
+	return f.azureAPIProbeFailures < f.azureAPIProbeFailureThreshold
+}
+
+// checkAzureAPIReachability checks whether Azure management endpoint is reachable by listing storage accounts
+// in driver resource group, the check is skipped if storage account client is not initialized
+func (f *Driver) checkAzureAPIReachability(ctx context.Context) error {
+	if f.cloud == nil || f.cloud.StorageAccountClient == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, azureAPIProbeTimeout)
+	defer cancel()
+	if _, rerr := f.cloud.StorageAccountClient.ListByResourceGroup(ctx, f.cloud.SubscriptionID, f.cloud.ResourceGroup); rerr != nil {
+		return rerr.Error()
+	}
+	return nil
+}
+
 // GetPluginCapabilities returns the capabilities of the plugin
 func (f *Driver) GetPluginCapabilities(ctx context.Context, req *csi.GetPluginCapabilitiesRequest) (*csi.GetPluginCapabilitiesResponse, error) {
-	return &csi.GetPluginCapabilitiesResponse{
-		Capabilities: []*csi.PluginCapability{
-			{
-				Type: &csi.PluginCapability_Service_{
-					Service: &csi.PluginCapability_Service{
-						Type: csi.PluginCapability_Service_CONTROLLER_SERVICE,
-					},
+	capabilities := []*csi.PluginCapability{
+		{
+			Type: &csi.PluginCapability_Service_{
+				Service: &csi.PluginCapability_Service{
+					Type: csi.PluginCapability_Service_CONTROLLER_SERVICE,
 				},
 			},
 		},
+	}
+	if f.enableTopology {
+		capabilities = append(capabilities, &csi.PluginCapability{
+			Type: &csi.PluginCapability_Service_{
+				Service: &csi.PluginCapability_Service{
+					Type: csi.PluginCapability_Service_VOLUME_ACCESSIBILITY_CONSTRAINTS,
+				},
+			},
+		})
+	}
+	return &csi.GetPluginCapabilitiesResponse{
+		Capabilities: capabilities,
 	}, nil
 }
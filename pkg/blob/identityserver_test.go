@@ -18,10 +18,17 @@ package blob
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 	"testing"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2021-09-01/storage"
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/storageaccountclient/mockstorageaccountclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
 )
 
 func TestGetPluginInfo(t *testing.T) {
@@ -60,6 +67,38 @@ func TestProbe(t *testing.T) {
 	assert.Equal(t, resp.Ready.Value, true)
 }
 
+func TestProbeAzureAPIReachability(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	d := NewFakeDriver()
+	d.azureAPIProbeFailureThreshold = 2
+	d.cloud.ResourceGroup = "rg"
+	d.cloud.SubscriptionID = "subsID"
+	mockStorageAccountsClient := mockstorageaccountclient.NewMockInterface(ctrl)
+	d.cloud.StorageAccountClient = mockStorageAccountsClient
+	listErr := retry.GetError(&http.Response{StatusCode: http.StatusServiceUnavailable}, fmt.Errorf("dial tcp: i/o timeout"))
+	gomock.InOrder(
+		mockStorageAccountsClient.EXPECT().ListByResourceGroup(gomock.Any(), "subsID", "rg").Return(nil, listErr).Times(2),
+		mockStorageAccountsClient.EXPECT().ListByResourceGroup(gomock.Any(), "subsID", "rg").Return([]storage.Account{}, nil),
+		mockStorageAccountsClient.EXPECT().ListByResourceGroup(gomock.Any(), "subsID", "rg").Return(nil, listErr),
+	)
+
+	// ready is reported until failures reach the threshold, and failure count is reset on success
+	for i, expectedReady := range []bool{true, false, true, true} {
+		// expire the last check result so that Azure API is checked again
+		d.azureAPIProbeLastCheck = time.Time{}
+		resp, err := d.Probe(context.Background(), &csi.ProbeRequest{})
+		assert.NoError(t, err)
+		assert.Equal(t, expectedReady, resp.Ready.Value, "probe %d", i)
+	}
+
+	// result of the last check is reused within the probe interval without calling Azure API
+	resp, err := d.Probe(context.Background(), &csi.ProbeRequest{})
+	assert.NoError(t, err)
+	assert.True(t, resp.Ready.Value)
+}
+
 func TestGetPluginCapabilities(t *testing.T) {
 	d := NewFakeDriver()
 	req := csi.GetPluginCapabilitiesRequest{}
@@ -67,4 +106,11 @@ func TestGetPluginCapabilities(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, resp)
 	assert.Equal(t, resp.XXX_sizecache, int32(0))
+	assert.Len(t, resp.GetCapabilities(), 1)
+
+	d.enableTopology = true
+	resp, err = d.GetPluginCapabilities(context.Background(), &req)
+	assert.NoError(t, err)
+	assert.Len(t, resp.GetCapabilities(), 2)
+	assert.Equal(t, csi.PluginCapability_Service_VOLUME_ACCESSIBILITY_CONSTRAINTS, resp.GetCapabilities()[1].GetService().GetType())
 }
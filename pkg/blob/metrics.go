@@ -0,0 +1,67 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blob
+
+import (
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+const (
+	// container is retained by container soft delete policy of the account and could be restored
+	deleteTypeSoft = "soft"
+	// container is removed permanently
+	deleteTypeHard = "hard"
+	// container soft delete policy of the account could not be determined, e.g. data plane API is used
+	deleteTypeUnknown = "unknown"
+)
+
+var (
+	deleteVolumeCount = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      blobCSIDriverName,
+			Name:           "delete_volume_total",
+			Help:           "Number of containers deleted in DeleteVolume by delete type (soft, hard or unknown)",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"delete_type"},
+	)
+	storageAccountCreatedCount = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      blobCSIDriverName,
+			Name:           "storage_account_created_total",
+			Help:           "Number of storage accounts created by driver in CreateVolume instead of reusing a matching account",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"sku", "kind"},
+	)
+	copyBlobContainerThroughput = metrics.NewHistogram(
+		&metrics.HistogramOpts{
+			Namespace:      blobCSIDriverName,
+			Name:           "copy_blob_container_throughput_bytes_per_second",
+			Help:           "Throughput of azcopy copy in volume cloning and snapshot, only observed when transferred bytes are reported by azcopy",
+			Buckets:        metrics.ExponentialBuckets(1024*1024, 2, 12),
+			StabilityLevel: metrics.ALPHA,
+		},
+	)
+)
+
+func init() {
+	legacyregistry.MustRegister(deleteVolumeCount)
+	legacyregistry.MustRegister(copyBlobContainerThroughput)
+	legacyregistry.MustRegister(storageAccountCreatedCount)
+}
@@ -577,9 +577,19 @@ func (d *Driver) NodeGetCapabilities(ctx context.Context, req *csi.NodeGetCapabi
 
 // NodeGetInfo return info of the node on which this plugin is running
 func (d *Driver) NodeGetInfo(ctx context.Context, req *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
-	return &csi.NodeGetInfoResponse{
+	resp := &csi.NodeGetInfoResponse{
 		NodeId: d.NodeID,
-	}, nil
+	}
+	if d.enableTopology {
+		if d.cloud == nil || d.cloud.Location == "" {
+			klog.Warningf("location of node(%s) is unknown, skip reporting topology", d.NodeID)
+		} else {
+			resp.AccessibleTopology = &csi.Topology{
+				Segments: map[string]string{topologyRegionKey: strings.ToLower(d.cloud.Location)},
+			}
+		}
+	}
+	return resp, nil
 }
 
 // NodeExpandVolume node expand volume
@@ -57,6 +57,14 @@ func TestNodeGetInfo(t *testing.T) {
 	resp, err := d.NodeGetInfo(context.Background(), &req)
 	assert.NoError(t, err)
 	assert.Equal(t, resp.GetNodeId(), fakeNodeID)
+	assert.Nil(t, resp.GetAccessibleTopology())
+
+	// region of node is reported if topology is enabled
+	d.enableTopology = true
+	d.cloud.Location = "EastUS"
+	resp, err = d.NodeGetInfo(context.Background(), &req)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{topologyRegionKey: "eastus"}, resp.GetAccessibleTopology().GetSegments())
 }
 
 func TestNodeGetCapabilities(t *testing.T) {
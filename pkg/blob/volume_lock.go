@@ -24,6 +24,8 @@ import (
 
 const (
 	volumeOperationAlreadyExistsFmt = "An operation with the given Volume ID %s already exists"
+	volumeCloneInProgressFmt        = "An operation with the given Volume ID %s already exists, azcopy job status: %s, copy percent: %s%%"
+	volumeOperationsExceededFmt     = "Max concurrent volume operations(%d) are in progress, operation on Volume ID %s will be retried"
 )
 
 // VolumeLocks implements a map with atomic operations. It stores a set of all volume IDs
@@ -56,3 +58,39 @@ func (vl *volumeLocks) Release(volumeID string) {
 	defer vl.mux.Unlock()
 	vl.locks.Delete(volumeID)
 }
+
+// volumeOperationLimiter limits the number of in-flight volume operations across all volumes,
+// there is no limit if max is not positive
+type volumeOperationLimiter struct {
+	max int
+	sem chan struct{}
+}
+
+func newVolumeOperationLimiter(max int) *volumeOperationLimiter {
+	l := &volumeOperationLimiter{max: max}
+	if max > 0 {
+		l.sem = make(chan struct{}, max)
+	}
+	return l
+}
+
+// TryAcquire tries to acquire a slot for a volume operation and returns true if successful.
+// If max operations are already in progress, returns false without waiting.
+func (l *volumeOperationLimiter) TryAcquire() bool {
+	if l.sem == nil {
+		return true
+	}
+	select {
+	case l.sem <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *volumeOperationLimiter) Release() {
+	if l.sem == nil {
+		return
+	}
+	<-l.sem
+}
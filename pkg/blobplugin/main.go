@@ -24,6 +24,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"sigs.k8s.io/blob-csi-driver/pkg/blob"
 
@@ -60,6 +61,29 @@ var (
 	enableAznfsMount                       = flag.Bool("enable-aznfs-mount", false, "replace nfs mount with aznfs mount")
 	volStatsCacheExpireInMinutes           = flag.Int("vol-stats-cache-expire-in-minutes", 10, "The cache expire time in minutes for volume stats cache")
 	sasTokenExpirationMinutes              = flag.Int("sas-token-expiration-minutes", 1440, "sas token expiration minutes during volume cloning")
+	clusterName                            = flag.String("cluster-name", "", "cluster name which would be tagged on storage accounts created by driver")
+	strictVolumeIDParsing                  = flag.Bool("strict-volume-id-parsing", false, "return InvalidArgument error on unparseable volume ID in DeleteVolume instead of success")
+	deleteMaxTotalDuration                 = flag.Duration("delete-max-total-duration", 0, "max total time spent on retrying container deletion in DeleteVolume, 0 means no limit")
+	azcopyPollInterval                     = flag.Duration("azcopy-poll-interval", 5*time.Second, "min interval of polling azcopy job status during volume cloning, used when copy is near completion")
+	azcopyPollMaxInterval                  = flag.Duration("azcopy-poll-max-interval", 0, "max interval of polling azcopy job status during volume cloning, used in the early stage of copy, values less than azcopy-poll-interval (default) mean polling at fixed azcopy-poll-interval")
+	azcopyPollJitterFactor                 = flag.Float64("azcopy-poll-jitter-factor", 0, "jitter factor added to azcopy job status polling interval, e.g. 0.2 means up to 20% extra wait time, 0 means no jitter")
+	azcopyJobsLogInterval                  = flag.Duration("azcopy-jobs-log-interval", 0, "interval of logging container, state and copy percent of in-flight azcopy clone jobs in controller, 0 means in-flight clone jobs are not logged")
+	enableTopology                         = flag.Bool("enable-topology", false, "report region of node in NodeGetInfo and return region of storage account as accessible topology in CreateVolume, should be enabled on both controller and node")
+	enableBlobVersioningOnReuse            = flag.Bool("enable-blob-versioning-on-reuse", false, "enable blob versioning on existing storage account when enableBlobVersioning is requested, otherwise return error if versioning is not enabled")
+	azcopyConcurrencyValue                 = flag.Int("azcopy-concurrency-value", 0, "AZCOPY_CONCURRENCY_VALUE of azcopy copy in volume cloning, azcopy default is used if 0")
+	azcopyBlockSizeMB                      = flag.Int("azcopy-block-size-mb", 0, "block size in MiB of azcopy copy in volume cloning, azcopy default is used if 0")
+	azcopyLogLevel                         = flag.String("azcopy-log-level", "", "log level of azcopy copy in volume cloning, e.g. DEBUG, INFO, WARNING, ERROR, azcopy default is used if empty")
+	azcopyLogDir                           = flag.String("azcopy-log-dir", "", "parent directory of per volume azcopy log locations in volume cloning, logs are kept on clone failure and removed on success, azcopy default log location is used if empty")
+	azcopyLogMaxAge                        = flag.Duration("azcopy-log-max-age", 7*24*time.Hour, "max age of azcopy log locations kept in --azcopy-log-dir on clone failure, older log locations are removed before a new copy starts, 0 means no limit")
+	listVolumesStorageAccounts             = flag.String("list-volumes-storage-accounts", "", "comma separated storage accounts in driver resource group listed in ListVolumes and ListSnapshots, in addition to storage accounts created by driver in the subscription")
+	useContainerSasToken                   = flag.Bool("use-container-sas-token", false, "generate container scoped service sas token for source and destination containers instead of account sas token during volume cloning")
+	accountBackoffJitterFactor             = flag.Float64("account-backoff-jitter-factor", 0, "jitter factor added to retry backoff of storage account search and creation in CreateVolume, e.g. 0.2 means up to 20% extra wait time, 0 means no jitter")
+	perVolumeSecretName                    = flag.Bool("per-volume-secret-name", false, "store account key in a secret per volume named azure-storage-account-{accountname}-{containername}-secret, instead of a secret shared by all volumes on the same account in the namespace, only applies to volumes created after it's changed")
+	enableListVolumes                      = flag.Bool("enable-list-volumes", false, "report LIST_VOLUMES capability in controller and record provisioned capacity in container metadata so that it could be reported in ListVolumes")
+	enableVolumeIDV2                       = flag.Bool("enable-volume-id-v2", false, "return volume id in v2 format with version prefix, only set it after node plugins on all nodes are upgraded to the version which parses v2 volume id")
+	maxConcurrentVolumeOperations          = flag.Int("max-concurrent-volume-operations", 0, "max number of in-flight CreateVolume and DeleteVolume operations in controller, further requests are aborted and retried by csi-provisioner, 0 means no limit")
+	azureAPIProbeFailureThreshold          = flag.Int("azure-api-probe-failure-threshold", 0, "number of consecutive failures of listing storage accounts in driver resource group in Probe before reporting not ready so that controller is restarted by liveness probe, the check runs at most once per minute, 0 disables the check, should only be set on controller")
+	maxAccountFallbacks                    = flag.Int("max-account-fallbacks", 0, "max number of new storage accounts created in CreateVolume when the storage account picked by driver reaches its container limit, 0 means no fallback")
 )
 
 func main() {
@@ -107,6 +131,29 @@ func handle() {
 		EnableAznfsMount:                       *enableAznfsMount,
 		VolStatsCacheExpireInMinutes:           *volStatsCacheExpireInMinutes,
 		SasTokenExpirationMinutes:              *sasTokenExpirationMinutes,
+		ClusterName:                            *clusterName,
+		StrictVolumeIDParsing:                  *strictVolumeIDParsing,
+		DeleteMaxTotalDuration:                 *deleteMaxTotalDuration,
+		AzcopyPollInterval:                     *azcopyPollInterval,
+		AzcopyPollMaxInterval:                  *azcopyPollMaxInterval,
+		AzcopyPollJitterFactor:                 *azcopyPollJitterFactor,
+		AzcopyJobsLogInterval:                  *azcopyJobsLogInterval,
+		EnableBlobVersioningOnReuse:            *enableBlobVersioningOnReuse,
+		EnableTopology:                         *enableTopology,
+		ListVolumesStorageAccounts:             *listVolumesStorageAccounts,
+		AzcopyConcurrencyValue:                 *azcopyConcurrencyValue,
+		AzcopyBlockSizeMB:                      *azcopyBlockSizeMB,
+		AzcopyLogLevel:                         *azcopyLogLevel,
+		AzcopyLogDir:                           *azcopyLogDir,
+		AzcopyLogMaxAge:                        *azcopyLogMaxAge,
+		UseContainerSasToken:                   *useContainerSasToken,
+		MaxAccountFallbacks:                    *maxAccountFallbacks,
+		AccountBackoffJitterFactor:             *accountBackoffJitterFactor,
+		PerVolumeSecretName:                    *perVolumeSecretName,
+		EnableVolumeIDV2:                       *enableVolumeIDV2,
+		EnableListVolumes:                      *enableListVolumes,
+		MaxConcurrentVolumeOperations:          *maxConcurrentVolumeOperations,
+		AzureAPIProbeFailureThreshold:          *azureAPIProbeFailureThreshold,
 	}
 	driver := blob.NewDriver(&driverOptions)
 	if driver == nil {
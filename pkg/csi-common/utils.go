@@ -59,14 +59,17 @@ const (
 	CreatedBlobContainer   = "CreatedBlobContainer"
 	DeletingBlobContainer  = "DeletingBlobContainer"
 	DeletedBlobContainer   = "DeletedBlobContainer"
+	RestoredBlobContainer  = "RestoredBlobContainer"
+	CreatedStorageAccount  = "CreatedStorageAccount"
 )
 
 const (
 	// Driver "Warning" event Reason list
-	FailedToInitializeDriver = "Failed"
-	FailedToProvisionVolume  = "Failed"
-	FailedAuthentication     = "FailedAuthentication"
-	InvalidAuthentication    = "InvalidAuthentication"
+	FailedToInitializeDriver  = "Failed"
+	FailedToProvisionVolume   = "Failed"
+	FailedAuthentication      = "FailedAuthentication"
+	InvalidAuthentication     = "InvalidAuthentication"
+	StorageAccountSkuMismatch = "StorageAccountSkuMismatch"
 )
 
 // Event correlation is done on the client side: need to use a global variable for the
@@ -83,9 +83,19 @@ type PVCAnnotatorInterface interface {
 }
 
 func (c *PVCAnnotator) requestAuthIsValid(auth string) bool {
+	return IsValidStorageAuthentication(auth)
+}
+
+// IsValidStorageAuthentication checks whether auth is a storage authentication supported by edgecache
+func IsValidStorageAuthentication(auth string) bool {
 	return slices.Contains(validStorageAuthentications, auth)
 }
 
+// ValidStorageAuthentications returns storage authentications supported by edgecache
+func ValidStorageAuthentications() []string {
+	return append([]string{}, validStorageAuthentications...)
+}
+
 func (c *PVCAnnotator) buildAnnotations(pv *v1.PersistentVolume, cfg config.AzureAuthConfig, providedAuth BlobAuth) (map[string]string, error) {
 	annotations := map[string]string{
 		volumeStateAnnotation:           "not created",
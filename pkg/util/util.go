@@ -17,12 +17,16 @@ limitations under the License.
 package util
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/go-ini/ini"
 	"github.com/pkg/errors"
@@ -45,6 +49,34 @@ const (
 	AzcopyJobCompleted AzcopyJobState = "Completed"
 )
 
+var (
+	// azcopyFatalErrorPatterns are azcopy output patterns of authentication and authorization failures
+	azcopyFatalErrorPatterns = []string{
+		"AuthenticationFailed",
+		"AuthorizationFailure",
+		"AuthorizationPermissionMismatch",
+		"AuthorizationResourceTypeMismatch",
+		"InvalidAuthenticationInfo",
+		"Server failed to authenticate the request",
+	}
+	// azcopyRetriableErrorPatterns are azcopy output patterns of network errors and throttling
+	azcopyRetriableErrorPatterns = []string{
+		"ServerBusy",
+		"Server Busy",
+		"TooManyRequests",
+		"OperationTimedOut",
+		"InternalError",
+		"connection reset by peer",
+		"connection refused",
+		"i/o timeout",
+		"TLS handshake timeout",
+		"no such host",
+		"unexpected EOF",
+	}
+	// azcopyBytesTransferredRegex matches the number of transferred bytes in azcopy job summary
+	azcopyBytesTransferredRegex = regexp.MustCompile(`TotalBytesTransferred:\s*(\d+)`)
+)
+
 // RoundUpBytes rounds up the volume size in bytes up to multiplications of GiB
 // in the unit of Bytes
 func RoundUpBytes(volumeSizeBytes int64) int64 {
@@ -248,10 +280,188 @@ func (ec *ExecCommand) RunCommand(cmd string) (string, error) {
 
 type Azcopy struct {
 	ExecCmd EXEC
+	// LookPath searches for the azcopy executable, exec.LookPath is used if nil
+	LookPath func(file string) (string, error)
+	// CopyCmd runs azcopy with args and returns the combined output, exec.CommandContext is used if nil
+	CopyCmd func(ctx context.Context, args ...string) ([]byte, error)
+	// ConcurrencyValue is set as AZCOPY_CONCURRENCY_VALUE env of azcopy copy, azcopy default is used if not positive
+	ConcurrencyValue int
+	// BlockSizeMB is set as --block-size-mb of azcopy copy, azcopy default is used if not positive
+	BlockSizeMB int
+	// LogLevel is set as --log-level of azcopy copy, azcopy default is used if empty
+	LogLevel string
+	// LogDir is the parent directory of per destination container AZCOPY_LOG_LOCATION of azcopy copy,
+	// azcopy default log location is used if empty
+	LogDir string
+	// LogMaxAge is the max age of log locations kept in LogDir, older log locations are removed by CleanupLogs,
+	// log locations are never removed by age if it's not positive
+	LogMaxAge time.Duration
+
+	mutex sync.Mutex
+	// path of the azcopy executable, only successful lookup is cached
+	path string
+}
+
+// EnsureInstalled checks whether azcopy executable could be found in PATH
+func (ac *Azcopy) EnsureInstalled() error {
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+	if ac.path != "" {
+		return nil
+	}
+	if ac.LookPath == nil {
+		ac.LookPath = exec.LookPath
+	}
+	path, err := ac.LookPath("azcopy")
+	if err != nil {
+		return err
+	}
+	klog.V(2).Infof("found azcopy executable at %s", path)
+	ac.path = path
+	return nil
+}
+
+// Copy runs "azcopy copy" from srcPath to dstPath recursively once, retries are left to the caller,
+// azcopy logs are written to logLocation if not empty, azcopy process is killed when ctx is done
+func (ac *Azcopy) Copy(ctx context.Context, srcPath, dstPath, logLocation string, extraArgs ...string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	out, err := ac.getCopyCmd(logLocation)(ctx, ac.GetCopyArgs(srcPath, dstPath, extraArgs...)...)
+	return string(out), err
+}
+
+// Resume runs "azcopy jobs resume" of an interrupted job, sas tokens are not persisted
+// in azcopy job plan so they are supplied again, azcopy logs are written to logLocation if not empty,
+// azcopy process is killed when ctx is done
+func (ac *Azcopy) Resume(ctx context.Context, jobID, srcSasToken, dstSasToken, logLocation string) (string, error) {
+	args := []string{"jobs", "resume", jobID}
+	if srcSasToken != "" {
+		args = append(args, "--source-sas="+strings.TrimPrefix(srcSasToken, "?"))
+	}
+	if dstSasToken != "" {
+		args = append(args, "--destination-sas="+strings.TrimPrefix(dstSasToken, "?"))
+	}
+	if ac.LogLevel != "" {
+		args = append(args, "--log-level="+ac.LogLevel)
+	}
+	out, err := ac.getCopyCmd(logLocation)(ctx, args...)
+	return string(out), err
 }
 
-// GetAzcopyJob get the azcopy job status if job existed
-func (ac *Azcopy) GetAzcopyJob(dstBlobContainer string) (AzcopyJobState, string, error) {
+// getCopyCmd returns the function running azcopy with args
+func (ac *Azcopy) getCopyCmd(logLocation string) func(ctx context.Context, args ...string) ([]byte, error) {
+	if ac.CopyCmd != nil {
+		return ac.CopyCmd
+	}
+	return func(ctx context.Context, args ...string) ([]byte, error) {
+		cmd := exec.CommandContext(ctx, "azcopy", args...)
+		if env := ac.GetCopyEnv(logLocation); len(env) > 0 {
+			cmd.Env = append(os.Environ(), env...)
+		}
+		return cmd.CombinedOutput()
+	}
+}
+
+// IsAzcopyFatalError checks whether azcopy output contains a failure which could not be
+// recovered by retrying, e.g. authentication or authorization failure
+func IsAzcopyFatalError(out string) bool {
+	for _, pattern := range azcopyFatalErrorPatterns {
+		if strings.Contains(out, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAzcopyRetriableError checks whether azcopy output contains a transient failure,
+// e.g. network error or throttling, fatal failure is never retriable
+func IsAzcopyRetriableError(out string) bool {
+	if IsAzcopyFatalError(out) {
+		return false
+	}
+	for _, pattern := range azcopyRetriableErrorPatterns {
+		if strings.Contains(out, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetAzcopyBytesTransferred returns the number of bytes transferred in azcopy job summary,
+// 0 is returned if it could not be found in the output
+func GetAzcopyBytesTransferred(out string) int64 {
+	matches := azcopyBytesTransferredRegex.FindStringSubmatch(out)
+	if len(matches) != 2 {
+		return 0
+	}
+	bytes, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return bytes
+}
+
+// GetCopyArgs returns the arguments of "azcopy copy" from srcPath to dstPath, extraArgs are appended at the end
+func (ac *Azcopy) GetCopyArgs(srcPath, dstPath string, extraArgs ...string) []string {
+	args := []string{"copy", srcPath, dstPath, "--recursive", "--check-length=false"}
+	if ac.BlockSizeMB > 0 {
+		args = append(args, fmt.Sprintf("--block-size-mb=%d", ac.BlockSizeMB))
+	}
+	if ac.LogLevel != "" {
+		args = append(args, "--log-level="+ac.LogLevel)
+	}
+	return append(args, extraArgs...)
+}
+
+// GetCopyEnv returns the extra environment variables of "azcopy copy", AZCOPY_LOG_LOCATION is set if logLocation is not empty
+func (ac *Azcopy) GetCopyEnv(logLocation string) []string {
+	var env []string
+	if ac.ConcurrencyValue > 0 {
+		env = append(env, fmt.Sprintf("AZCOPY_CONCURRENCY_VALUE=%d", ac.ConcurrencyValue))
+	}
+	if logLocation != "" {
+		env = append(env, "AZCOPY_LOG_LOCATION="+logLocation)
+	}
+	return env
+}
+
+// GetLogLocation returns the azcopy log location of the copy into dstBlobContainer, empty if LogDir is not set
+func (ac *Azcopy) GetLogLocation(dstBlobContainer string) string {
+	if ac.LogDir == "" {
+		return ""
+	}
+	return filepath.Join(ac.LogDir, dstBlobContainer)
+}
+
+// CleanupLogs removes log locations in LogDir which are not modified within LogMaxAge,
+// logs of failed copies are kept in LogDir for diagnosis and would fill up the disk otherwise
+func (ac *Azcopy) CleanupLogs() {
+	if ac.LogDir == "" || ac.LogMaxAge <= 0 {
+		return
+	}
+	entries, err := os.ReadDir(ac.LogDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			klog.Warningf("failed to read azcopy log dir(%s): %v", ac.LogDir, err)
+		}
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) <= ac.LogMaxAge {
+			continue
+		}
+		logLocation := filepath.Join(ac.LogDir, entry.Name())
+		klog.V(2).Infof("remove azcopy log location(%s) last modified at %v", logLocation, info.ModTime())
+		if err := os.RemoveAll(logLocation); err != nil {
+			klog.Warningf("failed to remove azcopy log location(%s): %v", logLocation, err)
+		}
+	}
+}
+
+// GetAzcopyJob get the azcopy job status, copy percent and job id if job existed
+func (ac *Azcopy) GetAzcopyJob(dstBlobContainer string) (AzcopyJobState, string, string, error) {
 	cmdStr := fmt.Sprintf("azcopy jobs list | grep %s -B 3", dstBlobContainer)
 	// cmd output example:
 	// JobId: ed1c3833-eaff-fe42-71d7-513fb065a9d9
@@ -270,18 +480,18 @@ func (ac *Azcopy) GetAzcopyJob(dstBlobContainer string) (AzcopyJobState, string,
 	// if grep command returns nothing, the exec will return exit status 1 error, so filter this error
 	if err != nil && err.Error() != "exit status 1" {
 		klog.Warningf("failed to get azcopy job with error: %v, jobState: %v", err, AzcopyJobError)
-		return AzcopyJobError, "", fmt.Errorf("couldn't list jobs in azcopy %v", err)
+		return AzcopyJobError, "", "", fmt.Errorf("couldn't list jobs in azcopy %v", err)
 	}
 	jobid, jobState, err := parseAzcopyJobList(out, dstBlobContainer)
 	if err != nil || jobState == AzcopyJobError {
 		klog.Warningf("failed to get azcopy job with error: %v, jobState: %v", err, jobState)
-		return AzcopyJobError, "", fmt.Errorf("couldn't parse azcopy job list in azcopy %v", err)
+		return AzcopyJobError, "", "", fmt.Errorf("couldn't parse azcopy job list in azcopy %v", err)
 	}
 	if jobState == AzcopyJobCompleted {
-		return jobState, "100.0", err
+		return jobState, "100.0", jobid, err
 	}
 	if jobid == "" {
-		return jobState, "", err
+		return jobState, "", "", err
 	}
 	cmdPercentStr := fmt.Sprintf("azcopy jobs show %s | grep Percent", jobid)
 	// cmd out example:
@@ -289,14 +499,39 @@ func (ac *Azcopy) GetAzcopyJob(dstBlobContainer string) (AzcopyJobState, string,
 	summary, err := ac.ExecCmd.RunCommand(cmdPercentStr)
 	if err != nil {
 		klog.Warningf("failed to get azcopy job with error: %v, jobState: %v", err, AzcopyJobError)
-		return AzcopyJobError, "", fmt.Errorf("couldn't show jobs summary in azcopy %v", err)
+		return AzcopyJobError, "", jobid, fmt.Errorf("couldn't show jobs summary in azcopy %v", err)
 	}
 	jobState, percent, err := parseAzcopyJobShow(summary)
 	if err != nil || jobState == AzcopyJobError {
 		klog.Warningf("failed to get azcopy job with error: %v, jobState: %v", err, jobState)
-		return AzcopyJobError, "", fmt.Errorf("couldn't parse azcopy job show in azcopy %v", err)
+		return AzcopyJobError, "", jobid, fmt.Errorf("couldn't parse azcopy job show in azcopy %v", err)
+	}
+	return jobState, percent, jobid, nil
+}
+
+// CancelAzcopyJob cancels the in progress azcopy job copying into dstBlobContainer, job plan of a killed azcopy process
+// stays in progress and would be resumed by a later copy otherwise, id of the canceled job is returned, it's empty
+// if there is no in progress job
+func (ac *Azcopy) CancelAzcopyJob(dstBlobContainer string) (string, error) {
+	if ac.ExecCmd == nil {
+		ac.ExecCmd = &ExecCommand{}
+	}
+	out, err := ac.ExecCmd.RunCommand(fmt.Sprintf("azcopy jobs list | grep %s -B 3", dstBlobContainer))
+	// if grep command returns nothing, the exec will return exit status 1 error, so filter this error
+	if err != nil && err.Error() != "exit status 1" {
+		return "", fmt.Errorf("couldn't list jobs in azcopy %v", err)
+	}
+	jobid, jobState, err := parseAzcopyJobList(out, dstBlobContainer)
+	if err != nil {
+		return "", fmt.Errorf("couldn't parse azcopy job list in azcopy %v", err)
+	}
+	if jobState != AzcopyJobRunning || jobid == "" {
+		return "", nil
+	}
+	if out, err := ac.ExecCmd.RunCommand(fmt.Sprintf("azcopy jobs cancel %s", jobid)); err != nil {
+		return jobid, fmt.Errorf("couldn't cancel azcopy job %s: %v, output: %s", jobid, err, strings.TrimSpace(out))
 	}
-	return jobState, percent, nil
+	return jobid, nil
 }
 
 // parseAzcopyJobList parse command azcopy jobs list, get jobid and state from joblist containing dstBlobContainer
@@ -17,8 +17,12 @@ limitations under the License.
 package util
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
@@ -512,13 +516,106 @@ func TestGetAzcopyJob(t *testing.T) {
 
 		azcopyFunc := &Azcopy{}
 		azcopyFunc.ExecCmd = m
-		jobState, percent, err := azcopyFunc.GetAzcopyJob(dstBlobContainer)
+		jobState, percent, _, err := azcopyFunc.GetAzcopyJob(dstBlobContainer)
 		if jobState != test.expectedJobState || percent != test.expectedPercent || !reflect.DeepEqual(err, test.expectedErr) {
 			t.Errorf("test[%s]: unexpected jobState: %v, percent: %v, err: %v, expected jobState: %v, percent: %v, err: %v", test.desc, jobState, percent, err, test.expectedJobState, test.expectedPercent, test.expectedErr)
 		}
 	}
 }
 
+func TestCancelAzcopyJob(t *testing.T) {
+	inProgressJob := "JobId: ed1c3833-eaff-fe42-71d7-513fb065a9d9\nStart Time: Monday, 07-Aug-23 03:29:54 UTC\nStatus: InProgress\nCommand: copy https://{accountName}.blob.core.windows.net/{srcBlobContainer}{SAStoken} https://{accountName}.blob.core.windows.net/{dstBlobContainer}{SAStoken} --recursive --check-length=false"
+	tests := []struct {
+		desc          string
+		listStr       string
+		listErr       error
+		enableCancel  bool
+		cancelErr     error
+		expectedJobID string
+		expectedErr   error
+	}{
+		{
+			desc:        "list azcopy jobs error",
+			listErr:     fmt.Errorf("error"),
+			expectedErr: fmt.Errorf("couldn't list jobs in azcopy error"),
+		},
+		{
+			desc:    "no job found",
+			listErr: fmt.Errorf("exit status 1"),
+		},
+		{
+			desc:    "completed job is not canceled",
+			listStr: "JobId: ed1c3833-eaff-fe42-71d7-513fb065a9d9\nStart Time: Monday, 07-Aug-23 03:29:54 UTC\nStatus: Completed\nCommand: copy",
+		},
+		{
+			desc:          "in progress job is canceled",
+			listStr:       inProgressJob,
+			enableCancel:  true,
+			expectedJobID: "ed1c3833-eaff-fe42-71d7-513fb065a9d9",
+		},
+		{
+			desc:          "cancel azcopy job error",
+			listStr:       inProgressJob,
+			enableCancel:  true,
+			cancelErr:     fmt.Errorf("error"),
+			expectedJobID: "ed1c3833-eaff-fe42-71d7-513fb065a9d9",
+			expectedErr:   fmt.Errorf("couldn't cancel azcopy job ed1c3833-eaff-fe42-71d7-513fb065a9d9: error, output: "),
+		},
+	}
+	for _, test := range tests {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		m := NewMockEXEC(ctrl)
+		m.EXPECT().RunCommand(gomock.Eq("azcopy jobs list | grep dstBlobContainer -B 3")).Return(test.listStr, test.listErr)
+		if test.enableCancel {
+			m.EXPECT().RunCommand(gomock.Eq("azcopy jobs cancel ed1c3833-eaff-fe42-71d7-513fb065a9d9")).Return("", test.cancelErr)
+		}
+
+		ac := &Azcopy{ExecCmd: m}
+		jobID, err := ac.CancelAzcopyJob("dstBlobContainer")
+		if jobID != test.expectedJobID || !reflect.DeepEqual(err, test.expectedErr) {
+			t.Errorf("test[%s]: unexpected jobID: %q, err: %v, expected jobID: %q, err: %v", test.desc, jobID, err, test.expectedJobID, test.expectedErr)
+		}
+	}
+}
+
+func TestAzcopyResume(t *testing.T) {
+	var args []string
+	ac := &Azcopy{CopyCmd: func(_ context.Context, a ...string) ([]byte, error) {
+		args = a
+		return []byte("Final Job Status: Completed"), nil
+	}}
+	out, err := ac.Resume(context.Background(), "jobid", "?sv=src", "?sv=dst", "")
+	if err != nil || out != "Final Job Status: Completed" {
+		t.Errorf("unexpected output: %s, error: %v", out, err)
+	}
+	expectedArgs := []string{"jobs", "resume", "jobid", "--source-sas=sv=src", "--destination-sas=sv=dst"}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("args: %v, expected: %v", args, expectedArgs)
+	}
+
+	if _, err := ac.Resume(context.Background(), "jobid", "", "", ""); err != nil || !reflect.DeepEqual(args, []string{"jobs", "resume", "jobid"}) {
+		t.Errorf("unexpected args: %v, error: %v", args, err)
+	}
+}
+
+func TestAzcopyCopyCanceled(t *testing.T) {
+	calls := 0
+	ac := &Azcopy{CopyCmd: func(_ context.Context, _ ...string) ([]byte, error) {
+		calls++
+		return []byte("failed"), fmt.Errorf("copy failed")
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ac.Copy(ctx, "src", "dst", ""); !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error: %v, expected: %v", err, context.Canceled)
+	}
+	if calls != 0 {
+		t.Errorf("azcopy called %d times after context is canceled, expected 0", calls)
+	}
+}
+
 func TestParseAzcopyJobList(t *testing.T) {
 	tests := []struct {
 		desc             string
@@ -611,3 +708,255 @@ func TestParseAzcopyJobShow(t *testing.T) {
 		}
 	}
 }
+
+func TestEnsureAzcopyInstalled(t *testing.T) {
+	lookPathCount := 0
+	ac := &Azcopy{
+		LookPath: func(file string) (string, error) {
+			lookPathCount++
+			if lookPathCount == 1 {
+				return "", exec.ErrNotFound
+			}
+			return "/usr/bin/" + file, nil
+		},
+	}
+	if err := ac.EnsureInstalled(); !errors.Is(err, exec.ErrNotFound) {
+		t.Errorf("unexpected error: %v, expected: %v", err, exec.ErrNotFound)
+	}
+	for i := 0; i < 2; i++ {
+		if err := ac.EnsureInstalled(); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if lookPathCount != 2 {
+		t.Errorf("successful lookup should be cached, lookPath called %d times", lookPathCount)
+	}
+}
+
+func TestAzcopyCopy(t *testing.T) {
+	tests := []struct {
+		desc        string
+		copyErr     error
+		expectedOut string
+		expectedErr error
+	}{
+		{
+			desc:        "copy succeeds",
+			expectedOut: "succeeded",
+		},
+		{
+			desc:        "copy fails without retry",
+			copyErr:     fmt.Errorf("copy failed"),
+			expectedOut: "failed",
+			expectedErr: fmt.Errorf("copy failed"),
+		},
+	}
+
+	for _, test := range tests {
+		calls := 0
+		ac := &Azcopy{
+			CopyCmd: func(_ context.Context, args ...string) ([]byte, error) {
+				calls++
+				expectedArgs := []string{"copy", "src", "dst", "--recursive", "--check-length=false"}
+				if !reflect.DeepEqual(args, expectedArgs) {
+					t.Errorf("test(%s): unexpected azcopy args: %v, expected: %v", test.desc, args, expectedArgs)
+				}
+				if test.copyErr != nil {
+					return []byte("failed"), test.copyErr
+				}
+				return []byte("succeeded"), nil
+			},
+		}
+		out, err := ac.Copy(context.Background(), "src", "dst", "")
+		if !reflect.DeepEqual(err, test.expectedErr) {
+			t.Errorf("test(%s): unexpected error: %v, expected: %v", test.desc, err, test.expectedErr)
+		}
+		if out != test.expectedOut {
+			t.Errorf("test(%s): output: %s, expected: %s", test.desc, out, test.expectedOut)
+		}
+		if calls != 1 {
+			t.Errorf("test(%s): azcopy called %d times, expected 1", test.desc, calls)
+		}
+	}
+}
+
+func TestGetLogLocation(t *testing.T) {
+	if logLocation := (&Azcopy{}).GetLogLocation("dst"); logLocation != "" {
+		t.Errorf("unexpected log location: %s, expected empty", logLocation)
+	}
+	if logLocation := (&Azcopy{LogDir: "/tmp/azcopy-logs"}).GetLogLocation("dst"); logLocation != "/tmp/azcopy-logs/dst" {
+		t.Errorf("unexpected log location: %s, expected /tmp/azcopy-logs/dst", logLocation)
+	}
+}
+
+func TestCleanupLogs(t *testing.T) {
+	logDir := t.TempDir()
+	for _, name := range []string{"old", "new"} {
+		if err := os.MkdirAll(filepath.Join(logDir, name), 0750); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	oldTime := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(filepath.Join(logDir, "old"), oldTime, oldTime); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// log locations are not removed by age if LogMaxAge is not set
+	(&Azcopy{LogDir: logDir}).CleanupLogs()
+	if _, err := os.Stat(filepath.Join(logDir, "old")); err != nil {
+		t.Errorf("log location should not be removed: %v", err)
+	}
+
+	(&Azcopy{LogDir: logDir, LogMaxAge: time.Hour}).CleanupLogs()
+	if _, err := os.Stat(filepath.Join(logDir, "old")); !os.IsNotExist(err) {
+		t.Errorf("log location older than max age should be removed, error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(logDir, "new")); err != nil {
+		t.Errorf("log location within max age should not be removed: %v", err)
+	}
+
+	// log dir which does not exist is ignored
+	(&Azcopy{LogDir: filepath.Join(logDir, "notexist"), LogMaxAge: time.Hour}).CleanupLogs()
+}
+
+func TestAzcopyResumeLogLevel(t *testing.T) {
+	var args []string
+	ac := &Azcopy{LogLevel: "DEBUG", CopyCmd: func(_ context.Context, a ...string) ([]byte, error) {
+		args = a
+		return nil, nil
+	}}
+	if _, err := ac.Resume(context.Background(), "jobid", "", "", "/tmp/azcopy-logs/dst"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if expectedArgs := []string{"jobs", "resume", "jobid", "--log-level=DEBUG"}; !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("args: %v, expected: %v", args, expectedArgs)
+	}
+}
+
+func TestGetAzcopyBytesTransferred(t *testing.T) {
+	tests := []struct {
+		out           string
+		expectedBytes int64
+	}{
+		{
+			out:           "",
+			expectedBytes: 0,
+		},
+		{
+			out:           "Job 1 summary\nElapsed Time (Minutes): 0.0334\nNumber of File Transfers: 2\nTotalBytesTransferred: 5242880\nFinal Job Status: Completed",
+			expectedBytes: 5242880,
+		},
+		{
+			out:           "TotalBytesTransferred: invalid",
+			expectedBytes: 0,
+		},
+	}
+
+	for _, test := range tests {
+		if bytes := GetAzcopyBytesTransferred(test.out); bytes != test.expectedBytes {
+			t.Errorf("GetAzcopyBytesTransferred(%q) = %d, expected %d", test.out, bytes, test.expectedBytes)
+		}
+	}
+}
+
+func TestIsAzcopyRetriableError(t *testing.T) {
+	tests := []struct {
+		desc              string
+		out               string
+		expectedFatal     bool
+		expectedRetriable bool
+	}{
+		{
+			desc: "empty output",
+		},
+		{
+			desc: "unknown error",
+			out:  "failed to perform copy command due to error: invalid source",
+		},
+		{
+			desc:              "network error",
+			out:               "dial tcp: lookup account.blob.core.windows.net: i/o timeout",
+			expectedRetriable: true,
+		},
+		{
+			desc:              "throttling",
+			out:               "RESPONSE Status: 503 The server is busy. ServerBusy",
+			expectedRetriable: true,
+		},
+		{
+			desc:          "authentication failure",
+			out:           "RESPONSE Status: 403 Server failed to authenticate the request. AuthenticationFailed",
+			expectedFatal: true,
+		},
+		{
+			desc:          "authentication failure with network error",
+			out:           "connection reset by peer, AuthenticationFailed",
+			expectedFatal: true,
+		},
+	}
+
+	for _, test := range tests {
+		if fatal := IsAzcopyFatalError(test.out); fatal != test.expectedFatal {
+			t.Errorf("test(%s): IsAzcopyFatalError returned %v, expected %v", test.desc, fatal, test.expectedFatal)
+		}
+		if retriable := IsAzcopyRetriableError(test.out); retriable != test.expectedRetriable {
+			t.Errorf("test(%s): IsAzcopyRetriableError returned %v, expected %v", test.desc, retriable, test.expectedRetriable)
+		}
+	}
+}
+
+func TestGetAzcopyCopyArgsAndEnv(t *testing.T) {
+	tests := []struct {
+		desc             string
+		concurrencyValue int
+		blockSizeMB      int
+		logLevel         string
+		logLocation      string
+		extraArgs        []string
+		expectedArgs     []string
+		expectedEnv      []string
+	}{
+		{
+			desc:         "azcopy defaults",
+			expectedArgs: []string{"copy", "src", "dst", "--recursive", "--check-length=false"},
+		},
+		{
+			desc:             "concurrency value and block size are set",
+			concurrencyValue: 32,
+			blockSizeMB:      8,
+			expectedArgs:     []string{"copy", "src", "dst", "--recursive", "--check-length=false", "--block-size-mb=8"},
+			expectedEnv:      []string{"AZCOPY_CONCURRENCY_VALUE=32"},
+		},
+		{
+			desc:             "negative values are ignored",
+			concurrencyValue: -1,
+			blockSizeMB:      -1,
+			expectedArgs:     []string{"copy", "src", "dst", "--recursive", "--check-length=false"},
+		},
+		{
+			desc:         "extra args are appended",
+			blockSizeMB:  8,
+			extraArgs:    []string{"--preserve-permissions=true"},
+			expectedArgs: []string{"copy", "src", "dst", "--recursive", "--check-length=false", "--block-size-mb=8", "--preserve-permissions=true"},
+		},
+		{
+			desc:             "log level and log location are set",
+			concurrencyValue: 32,
+			logLevel:         "DEBUG",
+			logLocation:      "/tmp/azcopy-logs/dst",
+			extraArgs:        []string{"--preserve-permissions=true"},
+			expectedArgs:     []string{"copy", "src", "dst", "--recursive", "--check-length=false", "--log-level=DEBUG", "--preserve-permissions=true"},
+			expectedEnv:      []string{"AZCOPY_CONCURRENCY_VALUE=32", "AZCOPY_LOG_LOCATION=/tmp/azcopy-logs/dst"},
+		},
+	}
+
+	for _, test := range tests {
+		ac := &Azcopy{ConcurrencyValue: test.concurrencyValue, BlockSizeMB: test.blockSizeMB, LogLevel: test.logLevel}
+		if args := ac.GetCopyArgs("src", "dst", test.extraArgs...); !reflect.DeepEqual(args, test.expectedArgs) {
+			t.Errorf("test(%s): unexpected azcopy args: %v, expected: %v", test.desc, args, test.expectedArgs)
+		}
+		if env := ac.GetCopyEnv(test.logLocation); !reflect.DeepEqual(env, test.expectedEnv) {
+			t.Errorf("test(%s): unexpected azcopy env: %v, expected: %v", test.desc, env, test.expectedEnv)
+		}
+	}
+}